@@ -106,7 +106,7 @@ func (self *Buffer) ReadInt64() int64 {
 	i |= int64(self.ReadByte()) << 24
 	i |= int64(self.ReadByte()) << 32
 	i |= int64(self.ReadByte()) << 40
-	i |= int64(self.ReadByte()) << 18
+	i |= int64(self.ReadByte()) << 48
 	i |= int64(self.ReadByte()) << 56
 	return i
 }
@@ -0,0 +1,46 @@
+package common
+
+/*
+ * 存储和执行过程中需要返回给客户端的错误代码
+ */
+const (
+	ER_BAD_FIELD_ERROR      = 1054
+	ER_DUP_KEYNAME          = 1061
+	ER_DUP_ENTRY            = 1062
+	ER_MULTIPLE_PRI_KEY     = 1068
+	ER_KEY_COLUMN_NOT_EXIST = 1072
+	ER_FILE_EXISTS_ERROR    = 1086
+	ER_CANT_DROP_KEY        = 1091
+	ER_LOCK_WAIT_TIMEOUT    = 1205
+	ER_LOCK_DEADLOCK        = 1213
+	ER_WRONG_VALUE_FOR_VAR  = 1231
+	ER_NOT_SUPPORTED_YET    = 1235
+	ER_SP_DOES_NOT_EXIST    = 1305
+	ER_XAER_NOTA            = 1397
+	ER_XAER_RMFAIL          = 1399
+	ER_XAER_OUTSIDE         = 1400
+	ER_XAER_DUPID           = 1440
+
+	ER_WARN_DATA_OUT_OF_RANGE          = 1264
+	ER_TRUNCATED_WRONG_VALUE_FOR_FIELD = 1366
+	ER_CANT_CHANGE_TX_CHARACTERISTICS  = 1568
+)
+
+// 带有错误代码和SQL状态的错误, 由服务端转换为错误包
+type SQLError struct {
+	Code     uint16
+	SqlState string
+	Message  string
+}
+
+func NewSQLError(code uint16, sqlState string, message string) *SQLError {
+	return &SQLError{
+		Code:     code,
+		SqlState: sqlState,
+		Message:  message,
+	}
+}
+
+func (self *SQLError) Error() string {
+	return self.Message
+}
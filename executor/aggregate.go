@@ -0,0 +1,233 @@
+package executor
+
+import (
+	"Relatdb/meta"
+)
+
+var aggregateFunctionNames = map[string]bool{
+	"count": true,
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+	"avg":   true,
+}
+
+func isAggregateFunction(name string) bool {
+	return aggregateFunctionNames[name]
+}
+
+type Aggregator interface {
+	Accumulate(value meta.Value)
+	Result() meta.Value
+}
+
+func NewAggregator(name string) Aggregator {
+	switch name {
+	case "count":
+		return &CountAggregator{}
+	case "sum":
+		return &SumAggregator{}
+	case "min":
+		return &MinMaxAggregator{isMax: false}
+	case "max":
+		return &MinMaxAggregator{isMax: true}
+	case "avg":
+		return &AvgAggregator{}
+	default:
+		panic("unsupported aggregate function: " + name)
+	}
+}
+
+func isNullValue(value meta.Value) bool {
+	return value == nil || value.GetType() == meta.NullValueType
+}
+
+type CountAggregator struct {
+	count int64
+}
+
+func (self *CountAggregator) Accumulate(value meta.Value) {
+	if !isNullValue(value) {
+		self.count++
+	}
+}
+
+func (self *CountAggregator) Result() meta.Value {
+	return meta.Int64Value(self.count)
+}
+
+type SumAggregator struct {
+	hasValue bool
+	isFloat  bool
+	intSum   int64
+	floatSum float64
+}
+
+func (self *SumAggregator) Accumulate(value meta.Value) {
+	if isNullValue(value) {
+		return
+	}
+	self.hasValue = true
+	if value.GetType() == meta.Float64ValueType || value.GetType() == meta.StringValueType {
+		self.isFloat = true
+	}
+	self.intSum += value.ToInt64()
+	self.floatSum += value.ToFloat64()
+}
+
+func (self *SumAggregator) Result() meta.Value {
+	if !self.hasValue {
+		return meta.CONST_NULL_VALUE
+	}
+	if self.isFloat {
+		return meta.Float64Value(self.floatSum)
+	}
+	return meta.Int64Value(self.intSum)
+}
+
+type MinMaxAggregator struct {
+	isMax bool
+	value meta.Value
+}
+
+func (self *MinMaxAggregator) Accumulate(value meta.Value) {
+	if isNullValue(value) {
+		return
+	}
+	if self.value == nil {
+		self.value = value
+		return
+	}
+	comp := compareNotNullValues(value, self.value)
+	if self.isMax && comp > 0 || !self.isMax && comp < 0 {
+		self.value = value
+	}
+}
+
+func (self *MinMaxAggregator) Result() meta.Value {
+	if self.value == nil {
+		return meta.CONST_NULL_VALUE
+	}
+	return self.value
+}
+
+type AvgAggregator struct {
+	count int64
+	sum   float64
+}
+
+func (self *AvgAggregator) Accumulate(value meta.Value) {
+	if isNullValue(value) {
+		return
+	}
+	self.count++
+	self.sum += value.ToFloat64()
+}
+
+func (self *AvgAggregator) Result() meta.Value {
+	if self.count == 0 {
+		return meta.CONST_NULL_VALUE
+	}
+	return meta.Float64Value(self.sum / float64(self.count))
+}
+
+// 聚合函数, argument为nil表示count(*)
+type AggregateFunction struct {
+	Name     string
+	Argument RowEvaluator
+}
+
+type aggregateGroup struct {
+	values      []meta.Value
+	aggregators []Aggregator
+}
+
+/*
+聚合, 输出行为: 分组字段... | 聚合函数结果...
+没有分组字段时, 即使没有输入行也会输出一行
+*/
+type AggregateOperator struct {
+	child     Operator
+	columns   []meta.Value
+	groupBy   []RowEvaluator
+	functions []*AggregateFunction
+	groups    []*aggregateGroup
+	position  int
+}
+
+func NewAggregateOperator(
+	child Operator, columns []meta.Value,
+	groupBy []RowEvaluator, functions []*AggregateFunction,
+) *AggregateOperator {
+	return &AggregateOperator{
+		child:     child,
+		columns:   columns,
+		groupBy:   groupBy,
+		functions: functions,
+	}
+}
+
+func (self *AggregateOperator) GetColumns() []meta.Value {
+	return self.columns
+}
+
+func (self *AggregateOperator) newGroup(values []meta.Value) *aggregateGroup {
+	aggregators := make([]Aggregator, len(self.functions))
+	for i, function := range self.functions {
+		aggregators[i] = NewAggregator(function.Name)
+	}
+	return &aggregateGroup{
+		values:      values,
+		aggregators: aggregators,
+	}
+}
+
+func (self *AggregateOperator) Open() {
+	self.child.Open()
+	self.groups = nil
+	self.position = 0
+	groupMap := make(map[string]*aggregateGroup)
+	for row := self.child.Next(); row != nil; row = self.child.Next() {
+		values := make([]meta.Value, len(self.groupBy))
+		key := ""
+		for i, evaluator := range self.groupBy {
+			values[i] = evaluator(row)
+			key += string(values[i].ToBytes())
+		}
+		group := groupMap[key]
+		if group == nil {
+			group = self.newGroup(values)
+			groupMap[key] = group
+			self.groups = append(self.groups, group)
+		}
+		for i, function := range self.functions {
+			if function.Argument == nil {
+				group.aggregators[i].Accumulate(meta.IntValue(1))
+			} else {
+				group.aggregators[i].Accumulate(function.Argument(row))
+			}
+		}
+	}
+	if len(self.groups) == 0 && len(self.groupBy) == 0 {
+		self.groups = append(self.groups, self.newGroup(nil))
+	}
+}
+
+func (self *AggregateOperator) Next() []meta.Value {
+	if self.position >= len(self.groups) {
+		return nil
+	}
+	group := self.groups[self.position]
+	self.position++
+	row := make([]meta.Value, 0, len(group.values)+len(group.aggregators))
+	row = append(row, group.values...)
+	for _, aggregator := range group.aggregators {
+		row = append(row, aggregator.Result())
+	}
+	return row
+}
+
+func (self *AggregateOperator) Close() {
+	self.groups = nil
+	self.child.Close()
+}
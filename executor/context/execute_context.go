@@ -2,9 +2,24 @@ package context
 
 import (
 	"Relatdb/store"
+	"Relatdb/transaction"
+)
+
+const (
+	//自动提交的系统变量名, 值为1时每条语句作为单独的事务提交
+	AUTO_COMMIT_VARIABLE = "autocommit"
+	//隔离级别的系统变量名
+	TRANSACTION_ISOLATION_VARIABLE = "transaction_isolation"
+	//SET TRANSACTION设置的只对下一个事务生效的隔离级别, 开始事务时清除
+	NEXT_TRANSACTION_ISOLATION_VARIABLE = "next_transaction_isolation"
+	//等待行锁的超时秒数
+	LOCK_WAIT_TIMEOUT_VARIABLE = "innodb_lock_wait_timeout"
 )
 
 type Connection interface {
+	GetConnectionId() uint64
+	GetUserName() string
+	IsClientFoundRows() bool
 	GetDatabase() string
 	SetDatabase(database string)
 }
@@ -12,10 +27,15 @@ type Connection interface {
 type Session interface {
 	GetVariable(name string) string
 	SetVariable(name string, value string)
+	IsAutoCommit() bool
+	GetTrx() *transaction.Trx
+	SetTrx(trx *transaction.Trx)
 }
 
 type ExecuteContext interface {
 	GetConnection() Connection
 	GetSession() Session
 	GetStore() store.Store
+	GetGlobalVariable(name string) string
+	SetGlobalVariable(name string, value string)
 }
@@ -6,12 +6,21 @@ import (
 	"Relatdb/index/bptree"
 	"Relatdb/meta"
 	"Relatdb/parser/ast"
+	"Relatdb/transaction"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Executor struct {
-	ctx  context.ExecuteContext
-	stmt ast.Statement
+	ctx            context.ExecuteContext
+	stmt           ast.Statement
+	readView       *transaction.ReadView      //不在事务中时语句的读视图
+	isolationLevel transaction.IsolationLevel //不在事务中时语句的隔离级别
+	lockTrx        *transaction.Trx           //锁定读所在的事务, 为nil时使用一致性读
+	lockMode       transaction.LockMode
 }
 
 func NewExecutor(ctx context.ExecuteContext, stmt ast.Statement) *Executor {
@@ -51,6 +60,16 @@ func (self *Executor) evalExpression(expr ast.Expression) meta.Value {
 	case *ast.VariableRef:
 		variableName := self.evalExpression(expr.Name).ToString()
 		return meta.StringValue(self.ctx.GetSession().GetVariable(variableName))
+	case *ast.CallExpression:
+		arguments := make([]meta.Value, len(expr.Arguments))
+		for i, argument := range expr.Arguments {
+			arguments[i] = self.evalExpression(argument)
+		}
+		return self.callFunction(calleeName(expr), arguments)
+	case *ast.NullLiteral, *ast.BinaryExpression, *ast.UnaryExpression, *ast.IsNullExpression,
+		*ast.InExpression, *ast.BetweenExpression, *ast.LikeExpression:
+		//不引用列的表达式, 对一行空数据求值
+		return self.compileExpression(nil, expr)(nil)
 	default:
 		panic(fmt.Errorf("unsupported expression type: %T", expr))
 	}
@@ -68,10 +87,16 @@ func (self *Executor) Execute() RecordSet {
 		return self.executeShowStatement(stmt)
 	case *ast.SetVariableStatement:
 		return self.executeSetVariableStatement(stmt)
+	case *ast.SetTransactionStatement:
+		return self.executeSetTransactionStatement(stmt)
 	case *ast.CreateTableStatement:
 		return self.executeCreateTableStatement(stmt)
 	case *ast.DropTableStatement:
 		return self.executeDropTableStatement(stmt)
+	case *ast.CreateIndexStatement:
+		return self.executeCreateIndexStatement(stmt)
+	case *ast.DropIndexStatement:
+		return self.executeDropIndexStatement(stmt)
 	case *ast.InsertStatement:
 		return self.executeInsertStatement(stmt)
 	case *ast.DeleteStatement:
@@ -80,30 +105,63 @@ func (self *Executor) Execute() RecordSet {
 		return self.executeUpdateStatement(stmt)
 	case *ast.SelectStatement:
 		return self.executeSelectStatement(stmt)
+	case *ast.BeginStatement:
+		return self.executeBeginStatement(stmt)
+	case *ast.CommitStatement:
+		return self.executeCommitStatement(stmt)
+	case *ast.RollbackStatement:
+		return self.executeRollbackStatement(stmt)
+	case *ast.SavepointStatement:
+		return self.executeSavepointStatement(stmt)
+	case *ast.ReleaseSavepointStatement:
+		return self.executeReleaseSavepointStatement(stmt)
+	case *ast.XaStatement:
+		return self.executeXaStatement(stmt)
+	case *ast.FlushStatement:
+		return self.executeFlushStatement(stmt)
+	case *ast.BackupStatement:
+		return self.executeBackupStatement(stmt)
 	default:
 		panic(fmt.Errorf("unsupported statement type: %T", stmt))
 	}
 }
 
 func (self *Executor) executeCreateDatabaseStatement(stmt *ast.CreateDatabaseStatement) RecordSet {
+	self.commitTrx()
 	store := self.ctx.GetStore()
 	databaseName := self.evalExpression(stmt.Name).ToString()
 	database := meta.NewDataBase(databaseName)
 	store.CreateDatabase(database)
-	return NewRecordSet(0, 0, nil, nil)
+	return NewRecordSet(0, 0, nil)
 }
 
 func (self *Executor) executeDropDatabaseStatement(stmt *ast.DropDatabaseStatement) RecordSet {
+	self.commitTrx()
 	store := self.ctx.GetStore()
 	databaseName := self.evalExpression(stmt.Name).ToString()
 	store.DropDatabase(databaseName)
-	return NewRecordSet(0, 0, nil, nil)
+	return NewRecordSet(0, 0, nil)
+}
+
+func (self *Executor) executeFlushStatement(stmt *ast.FlushStatement) RecordSet {
+	self.ctx.GetStore().FlushLogs()
+	return NewRecordSet(0, 0, nil)
+}
+
+// 所有数据库共用预写日志, 指定的数据库需要存在, 备份包含全部数据库
+func (self *Executor) executeBackupStatement(stmt *ast.BackupStatement) RecordSet {
+	store := self.ctx.GetStore()
+	if stmt.Database != nil {
+		store.GetDatabase(self.evalExpression(stmt.Database).ToString())
+	}
+	store.Backup(stmt.Dir.Text)
+	return NewRecordSet(0, 0, nil)
 }
 
 func (self *Executor) executeUseStatement(stmt *ast.UseStatement) RecordSet {
 	connection := self.ctx.GetConnection()
 	connection.SetDatabase(self.evalExpression(stmt.Database).ToString())
-	return NewRecordSet(0, 0, nil, nil)
+	return NewRecordSet(0, 0, nil)
 }
 
 func (self *Executor) executeShowStatement(stmt *ast.ShowStatement) RecordSet {
@@ -115,6 +173,11 @@ func (self *Executor) executeShowStatement(stmt *ast.ShowStatement) RecordSet {
 			meta.StringValue("Engine"), meta.StringValue("Support"), meta.StringValue("Comment"),
 			meta.StringValue("Transactions"), meta.StringValue("XA"), meta.StringValue("Savepoints"),
 		}
+		rows = append(rows, []meta.Value{
+			meta.StringValue("Icna"), meta.StringValue("DEFAULT"),
+			meta.StringValue("Supports transactions, row-level locking, and savepoints"),
+			meta.StringValue("YES"), meta.StringValue("YES"), meta.StringValue("YES"),
+		})
 	case ast.ShowDatabases:
 		columns = []meta.Value{meta.StringValue("Database")}
 		rows = append(rows, []meta.Value{meta.StringValue("default")})
@@ -130,19 +193,95 @@ func (self *Executor) executeShowStatement(stmt *ast.ShowStatement) RecordSet {
 		columns = []meta.Value{meta.StringValue("Variable_name"), meta.StringValue("Value")}
 	case ast.ShowStatus:
 		columns = []meta.Value{meta.StringValue("Variable_name"), meta.StringValue("Value")}
+		for _, variable := range self.ctx.GetStore().GetStatus() {
+			rows = append(rows, []meta.Value{meta.StringValue(variable.Name), meta.StringValue(variable.Value)})
+		}
 	}
-	return NewRecordSet(0, 0, columns, rows)
+	return NewRecordSet(0, 0, NewValuesOperator(columns, rows))
 }
 
+// 系统变量的值检查后保存为统一的格式, GLOBAL的修改对之后的新会话生效
 func (self *Executor) executeSetVariableStatement(stmt *ast.SetVariableStatement) RecordSet {
 	session := self.ctx.GetSession()
 	name := self.evalExpression(stmt.Name).ToString()
 	value := self.evalExpression(stmt.Value).ToString()
-	session.SetVariable(name, value)
-	return NewRecordSet(0, 0, nil, nil)
+	global := isGlobalScope(stmt.Scope)
+	switch strings.ToLower(name) {
+	case context.AUTO_COMMIT_VARIABLE:
+		name, value = context.AUTO_COMMIT_VARIABLE, parseAutoCommit(value)
+		//开启自动提交时提交当前事务
+		if !global && value == "1" && !session.IsAutoCommit() {
+			self.commitTrx()
+		}
+	case context.TRANSACTION_ISOLATION_VARIABLE:
+		name, value = context.TRANSACTION_ISOLATION_VARIABLE, parseIsolationLevel(value).String()
+	case context.LOCK_WAIT_TIMEOUT_VARIABLE:
+		if seconds, err := strconv.Atoi(value); err != nil || seconds <= 0 {
+			panic(newWrongValueError(context.LOCK_WAIT_TIMEOUT_VARIABLE, value))
+		}
+		name = context.LOCK_WAIT_TIMEOUT_VARIABLE
+	}
+	if global {
+		self.ctx.SetGlobalVariable(name, value)
+	} else {
+		session.SetVariable(name, value)
+	}
+	return NewRecordSet(0, 0, nil)
+}
+
+func isGlobalScope(scope *ast.Identifier) bool {
+	return scope != nil && strings.EqualFold(scope.Name, "GLOBAL")
+}
+
+func newWrongValueError(name string, value string) error {
+	return common.NewSQLError(common.ER_WRONG_VALUE_FOR_VAR, "42000",
+		fmt.Sprintf("Variable '%s' can't be set to the value of '%s'", name, value))
+}
+
+func parseAutoCommit(value string) string {
+	switch strings.ToUpper(value) {
+	case "1", "ON", "TRUE":
+		return "1"
+	case "0", "OFF", "FALSE":
+		return "0"
+	default:
+		panic(newWrongValueError(context.AUTO_COMMIT_VARIABLE, value))
+	}
+}
+
+func parseIsolationLevel(value string) transaction.IsolationLevel {
+	level, ok := transaction.ParseIsolationLevel(value)
+	if !ok {
+		panic(newWrongValueError(context.TRANSACTION_ISOLATION_VARIABLE, value))
+	}
+	return level
+}
+
+// SET TRANSACTION没有GLOBAL或SESSION时只对下一个事务生效, 事务中不能设置
+func (self *Executor) executeSetTransactionStatement(stmt *ast.SetTransactionStatement) RecordSet {
+	session := self.ctx.GetSession()
+	words := make([]string, len(stmt.IsolationLevel))
+	for i, word := range stmt.IsolationLevel {
+		words[i] = word.Name
+	}
+	level := parseIsolationLevel(strings.Join(words, " ")).String()
+	switch {
+	case stmt.Scope == nil:
+		if session.GetTrx() != nil {
+			panic(common.NewSQLError(common.ER_CANT_CHANGE_TX_CHARACTERISTICS, "25001",
+				"Transaction characteristics can't be changed while a transaction is in progress"))
+		}
+		session.SetVariable(context.NEXT_TRANSACTION_ISOLATION_VARIABLE, level)
+	case isGlobalScope(stmt.Scope):
+		self.ctx.SetGlobalVariable(context.TRANSACTION_ISOLATION_VARIABLE, level)
+	default:
+		session.SetVariable(context.TRANSACTION_ISOLATION_VARIABLE, level)
+	}
+	return NewRecordSet(0, 0, nil)
 }
 
 func (self *Executor) executeCreateTableStatement(stmt *ast.CreateTableStatement) RecordSet {
+	self.commitTrx()
 	connection := self.ctx.GetConnection()
 	store := self.ctx.GetStore()
 	databaseName := connection.GetDatabase()
@@ -150,7 +289,7 @@ func (self *Executor) executeCreateTableStatement(stmt *ast.CreateTableStatement
 	if !stmt.IfNotExists || !store.ExistTable(databaseName, tableName) {
 		fieldLength := len(stmt.ColumnDefinitions)
 		fields := make([]*meta.Field, fieldLength)
-		var primaryFiled *meta.Field
+		var primaryFields []*meta.Field
 		fieldMap := make(map[string]*meta.Field, fieldLength)
 		var clusterIndex meta.Index
 		var secondaryIndexes []meta.Index
@@ -161,19 +300,98 @@ func (self *Executor) executeCreateTableStatement(stmt *ast.CreateTableStatement
 				self.evalExpressionOrDefaultValue(definition.Comment, "").ToString(),
 			)
 			if field.Flag&common.PRIMARY_KEY_FLAG != 0 {
-				primaryFiled = field
-				clusterIndex = bptree.NewBPTree(field.Name, []*meta.Field{primaryFiled}, field.Flag)
+				if primaryFields != nil {
+					panic(common.NewSQLError(common.ER_MULTIPLE_PRI_KEY, "42000", "Multiple primary key defined"))
+				}
+				primaryFields = []*meta.Field{field}
+			} else if field.Flag&common.UNIQUE_KEY_FLAG != 0 {
+				//字段上的UNIQUE创建以字段名命名的唯一索引
+				index := bptree.NewBPTree(newIndexName(secondaryIndexes, field.Name), []*meta.Field{field}, common.UNIQUE_KEY_FLAG)
+				secondaryIndexes = append(secondaryIndexes, index)
 			}
 			fields[i] = field
 			fieldMap[field.Name] = field
 		}
-		table := meta.NewTable(databaseName, tableName, fields, primaryFiled, fieldMap, clusterIndex, secondaryIndexes)
+		for _, constraint := range stmt.Constraints {
+			indexFields := self.getKeyFields(fieldMap, constraint.ColumnNames)
+			if constraint.Type == ast.ConstraintPrimaryKey {
+				if primaryFields != nil {
+					panic(common.NewSQLError(common.ER_MULTIPLE_PRI_KEY, "42000", "Multiple primary key defined"))
+				}
+				for _, field := range indexFields {
+					field.Flag |= common.PRIMARY_KEY_FLAG
+				}
+				primaryFields = indexFields
+				continue
+			}
+			secondaryIndexes = append(secondaryIndexes, self.newTableKey(secondaryIndexes, constraint, indexFields))
+		}
+		//没有主键时使用隐藏的行ID作为聚簇索引的Key
+		if primaryFields == nil {
+			field := meta.NewField(
+				uint(fieldLength), meta.ROW_ID_FIELD_NAME, common.FIELD_TYPE_LONGLONG,
+				common.PRIMARY_KEY_FLAG|common.NOT_NULL_FLAG, meta.CONST_NULL_VALUE, "",
+			)
+			fields = append(fields, field)
+			fieldMap[field.Name] = field
+			primaryFields = []*meta.Field{field}
+		}
+		clusterIndex = bptree.NewBPTree(meta.PRIMARY_KEY_NAME, primaryFields, common.PRIMARY_KEY_FLAG)
+		table := meta.NewTable(databaseName, tableName, fields, primaryFields, fieldMap, clusterIndex, secondaryIndexes)
 		store.CreateTable(table)
 	}
-	return NewRecordSet(0, 0, nil, nil)
+	return NewRecordSet(0, 0, nil)
+}
+
+/*
+CREATE TABLE中的UNIQUE KEY和KEY/INDEX, 没有指定名称时使用第一个字段的名称
+单个字段的唯一索引在字段上标记UNIQUE_KEY_FLAG, 其他索引在第一个字段上标记MULTIPLE_KEY_FLAG
+*/
+func (self *Executor) newTableKey(indexes []meta.Index, constraint *ast.ConstraintDefinition, fields []*meta.Field) meta.Index {
+	var indexName string
+	if constraint.Name != nil {
+		indexName = self.evalExpression(constraint.Name).ToString()
+		if slices.ContainsFunc(indexes, func(index meta.Index) bool { return index.GetName() == indexName }) {
+			panic(common.NewSQLError(common.ER_DUP_KEYNAME, "42000", fmt.Sprintf("Duplicate key name '%s'", indexName)))
+		}
+	} else {
+		indexName = newIndexName(indexes, fields[0].Name)
+	}
+	flag := uint(common.MULTIPLE_KEY_FLAG)
+	if constraint.Type == ast.ConstraintUniqueKey {
+		flag = common.UNIQUE_KEY_FLAG
+	}
+	if flag == common.UNIQUE_KEY_FLAG && len(fields) == 1 {
+		fields[0].Flag |= common.UNIQUE_KEY_FLAG
+	} else if fields[0].Flag&(common.PRIMARY_KEY_FLAG|common.UNIQUE_KEY_FLAG) == 0 {
+		fields[0].Flag |= common.MULTIPLE_KEY_FLAG
+	}
+	return bptree.NewBPTree(indexName, fields, flag)
+}
+
+// 没有指定名称的索引: 与已有的索引重名时加上_2, _3等后缀
+func newIndexName(indexes []meta.Index, name string) string {
+	indexName := name
+	for i := 2; slices.ContainsFunc(indexes, func(index meta.Index) bool { return index.GetName() == indexName }); i++ {
+		indexName = fmt.Sprintf("%s_%d", name, i)
+	}
+	return indexName
+}
+
+// 索引的字段, 字段不存在时返回错误
+func (self *Executor) getKeyFields(fieldMap map[string]*meta.Field, columnNames []*ast.ColumnName) []*meta.Field {
+	fields := make([]*meta.Field, len(columnNames))
+	for i, columnName := range columnNames {
+		name := self.evalExpression(columnName.Name).ToString()
+		if fields[i] = fieldMap[name]; fields[i] == nil {
+			panic(common.NewSQLError(common.ER_KEY_COLUMN_NOT_EXIST, "42000", fmt.Sprintf("Key column '%s' doesn't exist in table", name)))
+		}
+	}
+	return fields
 }
 
 func (self *Executor) executeDropTableStatement(stmt *ast.DropTableStatement) RecordSet {
+	self.commitTrx()
 	connection := self.ctx.GetConnection()
 	store := self.ctx.GetStore()
 	for _, name := range stmt.Names {
@@ -183,7 +401,57 @@ func (self *Executor) executeDropTableStatement(stmt *ast.DropTableStatement) Re
 		}
 		store.DropTable(databaseName, self.evalExpression(name.Name).ToString())
 	}
-	return NewRecordSet(0, 0, nil, nil)
+	return NewRecordSet(0, 0, nil)
+}
+
+// CREATE [UNIQUE] INDEX: 回填已有的行, 唯一索引有重复的值时失败, 不支持SPATIAL和FULLTEXT索引
+func (self *Executor) executeCreateIndexStatement(stmt *ast.CreateIndexStatement) RecordSet {
+	self.commitTrx()
+	table := self.getTable(stmt.TableName)
+	indexName := self.evalExpression(stmt.Name).ToString()
+	if self.existIndex(table, indexName) {
+		if stmt.IfNotExists {
+			return NewRecordSet(0, 0, nil)
+		}
+		panic(common.NewSQLError(common.ER_DUP_KEYNAME, "42000", fmt.Sprintf("Duplicate key name '%s'", indexName)))
+	}
+	var flag uint
+	switch stmt.Type {
+	case ast.IndexTypeNone:
+		flag = common.MULTIPLE_KEY_FLAG
+	case ast.IndexTypeUnique:
+		flag = common.UNIQUE_KEY_FLAG
+	default:
+		panic(common.NewSQLError(common.ER_NOT_SUPPORTED_YET, "42000", "This version of MySQL doesn't yet support 'SPATIAL or FULLTEXT index'"))
+	}
+	fields := self.getKeyFields(table.FieldMap, stmt.ColumnNames)
+	self.ctx.GetStore().CreateIndex(table.DatabaseName, table.Name, bptree.NewBPTree(indexName, fields, flag))
+	return NewRecordSet(0, 0, nil)
+}
+
+// DROP INDEX: 删除二级索引和存储文件, 不能删除主键
+func (self *Executor) executeDropIndexStatement(stmt *ast.DropIndexStatement) RecordSet {
+	self.commitTrx()
+	table := self.getTable(stmt.TableName)
+	indexName := self.evalExpression(stmt.Name).ToString()
+	if !self.existIndex(table, indexName) {
+		if stmt.IfExists {
+			return NewRecordSet(0, 0, nil)
+		}
+		panic(common.NewSQLError(common.ER_CANT_DROP_KEY, "42000", fmt.Sprintf("Can't DROP '%s'; check that column/key exists", indexName)))
+	}
+	self.ctx.GetStore().DropIndex(table.DatabaseName, table.Name, indexName)
+	return NewRecordSet(0, 0, nil)
+}
+
+// 按存储中的索引快照查找二级索引, 其他连接可能同时建索引和删索引
+func (self *Executor) existIndex(table *meta.Table, indexName string) bool {
+	for _, index := range self.ctx.GetStore().GetIndexes(table.DatabaseName, table.Name)[1:] {
+		if index.GetName() == indexName {
+			return true
+		}
+	}
+	return false
 }
 
 func (self *Executor) executeInsertStatement(stmt *ast.InsertStatement) RecordSet {
@@ -194,6 +462,7 @@ func (self *Executor) executeInsertStatement(stmt *ast.InsertStatement) RecordSe
 		databaseName = self.evalExpression(stmt.TableName.Schema).ToString()
 	}
 	tableName := self.evalExpression(stmt.TableName.Name).ToString()
+	table := store.GetTable(databaseName, tableName)
 	columns := make([]string, len(stmt.ColumnNames))
 	for i, columnName := range stmt.ColumnNames {
 		columns[i] = self.evalExpression(columnName.Name).ToString()
@@ -206,29 +475,244 @@ func (self *Executor) executeInsertStatement(stmt *ast.InsertStatement) RecordSe
 		values := make([]meta.Value, len(originalValues))
 		for j, originalValue := range originalValues {
 			values[j] = self.evalExpression(originalValue)
+			var field *meta.Field
+			if len(columns) > 0 {
+				field = table.GetField(columns[j])
+			} else if j < len(table.Fields) {
+				field = table.Fields[j]
+			}
+			if field != nil {
+				values[j] = convertFieldValue(field, values[j], i+1)
+			}
 		}
 		rows[i] = values
 	}
-	store.Insert(databaseName, tableName, columns, rows)
-	return NewRecordSet(uint64(len(rows)), 0, nil, nil)
+	self.executeInTrx(func(trx *transaction.Trx) {
+		store.Insert(trx, databaseName, tableName, columns, rows)
+	})
+	return NewRecordSet(uint64(len(rows)), 0, nil)
 }
 
 func (self *Executor) executeDeleteStatement(stmt *ast.DeleteStatement) RecordSet {
-	return NewRecordSet(0, 0, nil, nil)
+	table := self.getTable(stmt.TableName)
+	var affectedRows uint64
+	self.executeInTrx(func(trx *transaction.Trx) {
+		rows := self.findMatchRows(trx, table, stmt.Where, stmt.Order, stmt.Limit)
+		affectedRows = self.ctx.GetStore().Delete(trx, table.DatabaseName, table.Name, rows)
+	})
+	return NewRecordSet(affectedRows, 0, nil)
+}
+
+// 查找UPDATE/DELETE需要修改的行, 修改索引前先读取全部匹配的行, 读取最新的版本并加排他锁
+func (self *Executor) findMatchRows(
+	trx *transaction.Trx, table *meta.Table, where ast.Expression, order *ast.OrderByClause, limit *ast.Limit,
+) [][]meta.Value {
+	self.lockTrx, self.lockMode = trx, transaction.LOCK_X
+	operator := self.buildWhereOperator(NewTableScanOperator(table, self.getTableScan(table, where)), where)
+	if order != nil {
+		operator = NewSortOperator(operator, self.compileOrderBy(operator.GetColumns(), nil, order))
+	}
+	if limit != nil {
+		operator = self.buildLimitOperator(operator, limit)
+	}
+	return readAllRows(operator)
+}
+
+func readAllRows(operator Operator) [][]meta.Value {
+	operator.Open()
+	defer operator.Close()
+	var rows [][]meta.Value
+	for row := operator.Next(); row != nil; row = operator.Next() {
+		rows = append(rows, row)
+	}
+	return rows
 }
 
 func (self *Executor) executeUpdateStatement(stmt *ast.UpdateStatement) RecordSet {
-	return NewRecordSet(0, 0, nil, nil)
+	table := self.getTable(stmt.TableName)
+	columns := NewTableScanOperator(table, nil).GetColumns()
+	fieldIndexes := make([]uint, len(stmt.AssignExpressions))
+	evaluators := make([]RowEvaluator, len(stmt.AssignExpressions))
+	for i, expr := range stmt.AssignExpressions {
+		assignExpression := expr.(*ast.AssignExpression)
+		name := expressionName(assignExpression.Left)
+		field := table.GetField(name)
+		if field == nil {
+			panic(common.NewSQLError(common.ER_BAD_FIELD_ERROR, "42S22", fmt.Sprintf("Unknown column '%s' in 'field list'", name)))
+		}
+		fieldIndexes[i] = field.Index
+		evaluators[i] = self.compileExpression(columns, assignExpression.Right)
+	}
+	var matchRows, oldRows, newRows [][]meta.Value
+	self.executeInTrx(func(trx *transaction.Trx) {
+		matchRows = self.findMatchRows(trx, table, stmt.Where, stmt.Order, stmt.Limit)
+		for j, row := range matchRows {
+			//按顺序赋值, 后面的赋值表达式使用前面赋值后的值
+			newRow := slices.Clone(row)
+			for i, evaluator := range evaluators {
+				fieldIndex := fieldIndexes[i]
+				newRow[fieldIndex] = convertFieldValue(table.Fields[fieldIndex], evaluator(newRow), j+1)
+			}
+			if !slices.EqualFunc(row, newRow, func(a meta.Value, b meta.Value) bool {
+				return compareValues(a, b) == 0
+			}) {
+				oldRows = append(oldRows, row)
+				newRows = append(newRows, newRow)
+			}
+		}
+		self.ctx.GetStore().Update(trx, table.DatabaseName, table.Name, oldRows, newRows)
+	})
+	//CLIENT_FOUND_ROWS: 返回匹配的行数, 否则返回实际修改的行数
+	if self.ctx.GetConnection().IsClientFoundRows() {
+		return NewRecordSet(uint64(len(matchRows)), 0, nil)
+	}
+	return NewRecordSet(uint64(len(newRows)), 0, nil)
 }
 
-func (self *Executor) executeSelectStatement(stmt *ast.SelectStatement) RecordSet {
-	columns := make([]meta.Value, len(stmt.Fields))
-	rows := make([][]meta.Value, 0)
-	row := make([]meta.Value, len(stmt.Fields))
-	for i, field := range stmt.Fields {
-		columns[i] = self.evalExpressionOrDefaultValue(field.AsName, self.evalExpression(field.Expr))
-		row[i] = columns[i]
+func (self *Executor) getTable(tableName *ast.TableName) *meta.Table {
+	connection := self.ctx.GetConnection()
+	store := self.ctx.GetStore()
+	databaseName := connection.GetDatabase()
+	if tableName.Schema != nil {
+		databaseName = self.evalExpression(tableName.Schema).ToString()
+	}
+	return store.GetTable(databaseName, self.evalExpression(tableName.Name).ToString())
+}
+
+/*
+在会话的事务中执行修改, 没有开始事务时:
+自动提交模式下作为单独的事务提交, 否则开始新的事务, 直到COMMIT或ROLLBACK结束
+语句执行失败时只撤销本条语句的修改, 死锁时回滚整个事务
+*/
+func (self *Executor) executeInTrx(execute func(trx *transaction.Trx)) {
+	store := self.ctx.GetStore()
+	trx := self.getTrx()
+	if trx != nil && trx.GetXaState() == transaction.XA_IDLE {
+		panic(newXaRmFailError(trx.GetXaState()))
+	}
+	autoCommit := trx == nil
+	if autoCommit {
+		trx = self.beginTrx()
+	}
+	trx.SetLockWaitTimeout(self.getLockWaitTimeout())
+	savepoint := trx.GetSavepoint()
+	defer func() {
+		if err := recover(); err != nil {
+			if autoCommit {
+				trx.Rollback(store)
+			} else if isDeadlock(err) {
+				self.ctx.GetSession().SetTrx(nil)
+				trx.Rollback(store)
+			} else {
+				trx.RollbackToSavepoint(savepoint, store)
+			}
+			panic(err)
+		}
+	}()
+	execute(trx)
+	if autoCommit {
+		trx.Commit()
+	}
+}
+
+func isDeadlock(err any) bool {
+	sqlError, ok := err.(*common.SQLError)
+	return ok && sqlError.Code == common.ER_LOCK_DEADLOCK
+}
+
+func (self *Executor) getLockWaitTimeout() time.Duration {
+	value := self.ctx.GetSession().GetVariable(context.LOCK_WAIT_TIMEOUT_VARIABLE)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
 	}
-	rows = append(rows, row)
-	return NewRecordSet(0, 0, columns, rows)
+	return transaction.DEFAULT_LOCK_WAIT_TIMEOUT
+}
+
+// 会话的当前事务, 关闭自动提交时没有事务则开始新的事务
+func (self *Executor) getTrx() *transaction.Trx {
+	session := self.ctx.GetSession()
+	if session.GetTrx() == nil && !session.IsAutoCommit() {
+		session.SetTrx(self.beginTrx())
+	}
+	return session.GetTrx()
+}
+
+func (self *Executor) beginTrx() *transaction.Trx {
+	return self.ctx.GetStore().BeginTrx(self.takeIsolationLevel())
+}
+
+// 下一个事务的隔离级别, SET TRANSACTION设置的隔离级别只使用一次
+func (self *Executor) takeIsolationLevel() transaction.IsolationLevel {
+	session := self.ctx.GetSession()
+	name := session.GetVariable(context.NEXT_TRANSACTION_ISOLATION_VARIABLE)
+	if name != "" {
+		session.SetVariable(context.NEXT_TRANSACTION_ISOLATION_VARIABLE, "")
+	} else {
+		name = session.GetVariable(context.TRANSACTION_ISOLATION_VARIABLE)
+	}
+	if level, ok := transaction.ParseIsolationLevel(name); ok {
+		return level
+	}
+	return transaction.DEFAULT_ISOLATION_LEVEL
+}
+
+// 提交会话的当前事务
+func (self *Executor) commitTrx() {
+	session := self.ctx.GetSession()
+	if trx := session.GetTrx(); trx != nil {
+		checkNotXaTrx(trx)
+		session.SetTrx(nil)
+		trx.Commit()
+	}
+}
+
+// 开始新的事务, 之前的事务会被提交
+func (self *Executor) executeBeginStatement(stmt *ast.BeginStatement) RecordSet {
+	self.commitTrx()
+	self.ctx.GetSession().SetTrx(self.beginTrx())
+	return NewRecordSet(0, 0, nil)
+}
+
+func (self *Executor) executeCommitStatement(stmt *ast.CommitStatement) RecordSet {
+	self.commitTrx()
+	return NewRecordSet(0, 0, nil)
+}
+
+func (self *Executor) executeRollbackStatement(stmt *ast.RollbackStatement) RecordSet {
+	session := self.ctx.GetSession()
+	trx := session.GetTrx()
+	if stmt.Savepoint != nil {
+		//回滚到保存点时事务继续, 保存点之后获得的行锁不释放
+		name := self.evalExpression(stmt.Savepoint).ToString()
+		if trx == nil || !trx.RollbackToNamedSavepoint(name, self.ctx.GetStore()) {
+			panic(newSavepointNotExistsError(name))
+		}
+		return NewRecordSet(0, 0, nil)
+	}
+	if trx != nil {
+		checkNotXaTrx(trx)
+		session.SetTrx(nil)
+		trx.Rollback(self.ctx.GetStore())
+	}
+	return NewRecordSet(0, 0, nil)
+}
+
+// 自动提交时不在事务中的保存点没有作用
+func (self *Executor) executeSavepointStatement(stmt *ast.SavepointStatement) RecordSet {
+	if trx := self.getTrx(); trx != nil {
+		trx.SetSavepoint(self.evalExpression(stmt.Name).ToString())
+	}
+	return NewRecordSet(0, 0, nil)
+}
+
+func (self *Executor) executeReleaseSavepointStatement(stmt *ast.ReleaseSavepointStatement) RecordSet {
+	name := self.evalExpression(stmt.Name).ToString()
+	if trx := self.ctx.GetSession().GetTrx(); trx == nil || !trx.ReleaseSavepoint(name) {
+		panic(newSavepointNotExistsError(name))
+	}
+	return NewRecordSet(0, 0, nil)
+}
+
+func newSavepointNotExistsError(name string) error {
+	return common.NewSQLError(common.ER_SP_DOES_NOT_EXIST, "42000", fmt.Sprintf("SAVEPOINT %s does not exist", name))
 }
@@ -0,0 +1,1341 @@
+package executor
+
+import (
+	"Relatdb/common"
+	"Relatdb/executor/context"
+	"Relatdb/meta"
+	"Relatdb/parser"
+	"Relatdb/store"
+	"Relatdb/store/icna"
+	"Relatdb/transaction"
+	"Relatdb/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConnection struct {
+	database  string
+	foundRows bool
+}
+
+func (self *testConnection) GetConnectionId() uint64 {
+	return 1
+}
+
+func (self *testConnection) GetUserName() string {
+	return "root"
+}
+
+func (self *testConnection) IsClientFoundRows() bool {
+	return self.foundRows
+}
+
+func (self *testConnection) GetDatabase() string {
+	return self.database
+}
+
+func (self *testConnection) SetDatabase(database string) {
+	self.database = database
+}
+
+type testSession struct {
+	variableMap map[string]string
+	trx         *transaction.Trx
+}
+
+func (self *testSession) GetVariable(name string) string {
+	return self.variableMap[name]
+}
+
+func (self *testSession) SetVariable(name string, value string) {
+	self.variableMap[name] = value
+}
+
+func (self *testSession) IsAutoCommit() bool {
+	return self.variableMap[context.AUTO_COMMIT_VARIABLE] == "1"
+}
+
+func (self *testSession) GetTrx() *transaction.Trx {
+	return self.trx
+}
+
+func (self *testSession) SetTrx(trx *transaction.Trx) {
+	self.trx = trx
+}
+
+type testContext struct {
+	connection      *testConnection
+	session         *testSession
+	store           store.Store
+	globalVariables map[string]string
+}
+
+func (self *testContext) GetConnection() context.Connection {
+	return self.connection
+}
+
+func (self *testContext) GetSession() context.Session {
+	return self.session
+}
+
+func (self *testContext) GetGlobalVariable(name string) string {
+	return self.globalVariables[name]
+}
+
+func (self *testContext) SetGlobalVariable(name string, value string) {
+	self.globalVariables[name] = value
+}
+
+func (self *testContext) GetStore() store.Store {
+	return self.store
+}
+
+func newTestContext(t *testing.T) *testContext {
+	ctx := newTestContextByPath(t.TempDir())
+	t.Cleanup(ctx.store.Close)
+	return ctx
+}
+
+// 使用较小的缓冲池, 让测试覆盖页的淘汰
+func newTestContextByPath(path string) *testContext {
+	return newTestContextByOptions(&icna.Options{
+		Path:           path,
+		BufferPoolSize: 16,
+	})
+}
+
+func newTestContextByOptions(options *icna.Options) *testContext {
+	store := icna.NewIcnaStore(options)
+	store.Init()
+	return newTestContextByStore(store)
+}
+
+// 共用存储的另一个连接
+func newTestContextByStore(store store.Store) *testContext {
+	return &testContext{
+		connection:      &testConnection{database: "default"},
+		session:         &testSession{variableMap: map[string]string{context.AUTO_COMMIT_VARIABLE: "1"}},
+		store:           store,
+		globalVariables: map[string]string{},
+	}
+}
+
+func execute(ctx context.ExecuteContext, sql string) RecordSet {
+	var recordSet RecordSet
+	for _, stmt := range parser.CreateParser(1, sql, true, true).Parse() {
+		recordSet = NewExecutor(ctx, stmt).Execute()
+	}
+	return recordSet
+}
+
+func readRows(recordSet RecordSet) [][]meta.Value {
+	defer recordSet.Close()
+	var rows [][]meta.Value
+	for row := recordSet.Next(); row != nil; row = recordSet.Next() {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func rowsToStrings(rows [][]meta.Value) [][]string {
+	result := make([][]string, len(rows))
+	for i, row := range rows {
+		result[i] = make([]string, len(row))
+		for j, value := range row {
+			if value.GetType() == meta.NullValueType {
+				result[i][j] = "NULL"
+			} else {
+				result[i][j] = value.ToString()
+			}
+		}
+	}
+	return result
+}
+
+func assertRows(t *testing.T, recordSet RecordSet, expected [][]string) {
+	t.Helper()
+	actual := rowsToStrings(readRows(recordSet))
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d rows, got %d: %v", len(expected), len(actual), actual)
+	}
+	for i := range expected {
+		if len(actual[i]) != len(expected[i]) {
+			t.Fatalf("row %d: expected %v, got %v", i, expected[i], actual[i])
+		}
+		for j := range expected[i] {
+			if actual[i][j] != expected[i][j] {
+				t.Fatalf("row %d: expected %v, got %v", i, expected[i], actual[i])
+			}
+		}
+	}
+}
+
+func createUserTable(ctx context.ExecuteContext) {
+	execute(ctx, `
+		create table User(
+			id INT PRIMARY KEY AUTO_INCREMENT COMMENT '主键',
+			email VARCHAR(50) COMMENT '邮箱',
+			age INT UNSIGNED DEFAULT 1 COMMENT '年龄'
+		);
+		insert into User VALUES (3,'3@qq.com',30),(1,'1@qq.com',10);
+		insert into User(id,email) VALUES (2,'2@qq.com');
+	`)
+}
+
+func TestSelect(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+
+	recordSet := execute(ctx, "select * from User")
+	columns := recordSet.GetColumns()
+	if len(columns) != 3 || columns[0].ToString() != "id" || columns[2].ToString() != "age" {
+		t.Fatalf("unexpected columns: %v", columns)
+	}
+	assertRows(t, recordSet, [][]string{
+		{"1", "1@qq.com", "10"},
+		{"2", "2@qq.com", "1"},
+		{"3", "3@qq.com", "30"},
+	})
+
+	assertRows(t, execute(ctx, "select email, id from User order by age desc limit 2"), [][]string{
+		{"3@qq.com", "3"},
+		{"1@qq.com", "1"},
+	})
+	assertRows(t, execute(ctx, "select id from User limit 1, 5"), [][]string{{"2"}, {"3"}})
+}
+
+func TestSelectManyRows(t *testing.T) {
+	ctx := newTestContext(t)
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	for i := 500; i > 0; i-- {
+		execute(ctx, "insert into T VALUES ("+meta.IntValue(i).ToString()+",'abcdefghijabcdefghij')")
+	}
+	rows := readRows(execute(ctx, "select id from T"))
+	if len(rows) != 500 {
+		t.Fatalf("expected 500 rows, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if row[0].ToInt() != i+1 {
+			t.Fatalf("row %d out of order: %v", i, row[0])
+		}
+	}
+}
+
+func TestSelectAggregate(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	execute(ctx, "insert into User VALUES (4,'4@qq.com',30)")
+
+	assertRows(t, execute(ctx, "select count(*), sum(age), min(email), max(age), avg(age) from User"), [][]string{
+		{"4", "71", "1@qq.com", "30", "17.75"},
+	})
+	assertRows(t, execute(ctx, "select age, count(*) as c from User group by age order by c desc, age"), [][]string{
+		{"30", "2"},
+		{"1", "1"},
+		{"10", "1"},
+	})
+	assertRows(t, execute(ctx, "select count(*) from (select id from User limit 2)"), [][]string{{"2"}})
+}
+
+func TestSelectWhere(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	execute(ctx, "insert into User VALUES (4,'4@qq.com',null)")
+
+	assertRows(t, execute(ctx, "select id from User where age >= 10 and id != 3"), [][]string{{"1"}})
+	assertRows(t, execute(ctx, "select id from User where age = 1 or email like '3%'"), [][]string{{"2"}, {"3"}})
+	assertRows(t, execute(ctx, "select id from User where not (age > 5)"), [][]string{{"2"}})
+	assertRows(t, execute(ctx, "select id from User where age is null"), [][]string{{"4"}})
+	assertRows(t, execute(ctx, "select id from User where age in (1, 30) or id between 4 and 5"), [][]string{
+		{"2"}, {"3"}, {"4"},
+	})
+	assertRows(t, execute(ctx, "select id, age * 2 + 1 from User where age not in (10, null) or age <> age"), [][]string{})
+	assertRows(t, execute(ctx, "select age from User where age + 0.5 > 10 order by age desc"), [][]string{{"30"}, {"10"}})
+	assertRows(t, execute(ctx, "select age, count(*) as c from User group by age having c > 0 and age is not null"), [][]string{
+		{"10", "1"}, {"1", "1"}, {"30", "1"},
+	})
+	assertRows(t, execute(ctx, "select null and 0, null or 1, null = null, 7 / 2, 7 % 0, -(1 + 2)"), [][]string{
+		{"0", "1", "NULL", "3.5", "NULL", "-3"},
+	})
+	//字符串按开头的数字部分判断真假
+	assertRows(t, execute(ctx, "select '1abc' and 1, ' 2x' or 0, not 'abc', '0.0x' or 0, '.5' and 1, '-1e2z' and 1, 'e1' or 0"), [][]string{
+		{"1", "1", "1", "0", "1", "1", "0"},
+	})
+	assertRows(t, execute(ctx, "select id from User where email and id < 3"), [][]string{{"1"}, {"2"}})
+
+	//整数运算超出BIGINT的范围时返回错误, 不回绕
+	execute(ctx, "create table B(id INT PRIMARY KEY, big BIGINT)")
+	execute(ctx, "insert into B VALUES (1, 9223372036854775807), (2, -9223372036854775807 - 1)")
+	assertSQLError(t, <-executeAsync(ctx, "update B set big = big + 1 where id = 1"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "update B set big = big - 1 where id = 2"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "update B set big = big * 2 where id = 1"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "update B set big = -big where id = 2"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertRows(t, execute(ctx, "select big - 1, -big from B where id = 1"), [][]string{{"9223372036854775806", "-9223372036854775807"}})
+	assertRows(t, execute(ctx, "select big from B where id = 2"), [][]string{{"-9223372036854775808"}})
+}
+
+// 语句中的字符串转换为小写, 比较和LIKE不区分大小写
+func TestStringCase(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	execute(ctx, "insert into User VALUES (4,'Four@QQ.com',4)")
+	assertRows(t, execute(ctx, "select email from User where email = 'FOUR@qq.COM'"), [][]string{{"four@qq.com"}})
+	assertRows(t, execute(ctx, "select id from User where email like 'F%' or email like '%@QQ.COM' and id < 2"), [][]string{{"1"}, {"4"}})
+	assertRows(t, execute(ctx, "select id from User where email > 'E'"), [][]string{{"4"}})
+}
+
+func TestDelete(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+
+	recordSet := execute(ctx, "delete from User where age >= 10 or age is null")
+	if recordSet.GetAffectedRows() != 2 {
+		t.Fatalf("expected 2 affected rows, got %d", recordSet.GetAffectedRows())
+	}
+	assertRows(t, execute(ctx, "select id from User"), [][]string{{"2"}})
+	execute(ctx, "insert into User VALUES (1,'1@qq.com',10),(3,'3@qq.com',30)")
+	recordSet = execute(ctx, "delete from User order by age desc limit 1")
+	if recordSet.GetAffectedRows() != 1 {
+		t.Fatalf("expected 1 affected row, got %d", recordSet.GetAffectedRows())
+	}
+	assertRows(t, execute(ctx, "select id from User"), [][]string{{"1"}, {"2"}})
+	assertRows(t, execute(ctx, "select count(*) from User where id = 3"), [][]string{{"0"}})
+
+	//等待唯一索引的锁超时时删除失败, 不少计影响的行数
+	execute(ctx, "create table U(id INT PRIMARY KEY, email VARCHAR(50) UNIQUE)")
+	execute(ctx, "insert into U VALUES (1,'1@qq.com'),(2,'2@qq.com')")
+	other := newTestContextByStore(ctx.store)
+	execute(other, "begin")
+	//写入重复的值失败后仍然持有值的锁
+	assertSQLError(t, <-executeAsync(other, "insert into U VALUES (3,'2@qq.com')"), common.ER_DUP_ENTRY)
+	execute(ctx, "set innodb_lock_wait_timeout = 1")
+	assertSQLError(t, <-executeAsync(ctx, "delete from U"), common.ER_LOCK_WAIT_TIMEOUT)
+	execute(other, "rollback")
+	assertRows(t, execute(ctx, "select id from U"), [][]string{{"1"}, {"2"}})
+}
+
+func TestDeleteManyRows(t *testing.T) {
+	ctx := newTestContext(t)
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	for i := 2000; i > 0; i-- {
+		execute(ctx, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", i, i))
+	}
+	if affectedRows := execute(ctx, "delete from T where id % 3 != 0").GetAffectedRows(); affectedRows != 1334 {
+		t.Fatalf("expected 1334 affected rows, got %d", affectedRows)
+	}
+	assertRows(t, execute(ctx, "select count(*), min(id), max(id) from T"), [][]string{{"666", "3", "1998"}})
+	for i := 1; i <= 2000; i++ {
+		if i%3 != 0 {
+			execute(ctx, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", i, i))
+		}
+	}
+	assertRows(t, execute(ctx, "select count(*) from T"), [][]string{{"2000"}})
+	execute(ctx, "delete from T")
+	assertRows(t, execute(ctx, "select count(*) from T"), [][]string{{"0"}})
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+
+	recordSet := execute(ctx, "update User set age = age + 1, email = 'x' where age < 20")
+	if recordSet.GetAffectedRows() != 2 {
+		t.Fatalf("expected 2 affected rows, got %d", recordSet.GetAffectedRows())
+	}
+	assertRows(t, execute(ctx, "select * from User"), [][]string{
+		{"1", "x", "11"},
+		{"2", "x", "2"},
+		{"3", "3@qq.com", "30"},
+	})
+	//赋值使用前面赋值后的值
+	execute(ctx, "update User set age = 5, email = age where id = 3")
+	assertRows(t, execute(ctx, "select email, age from User where id = 3"), [][]string{{"5", "5"}})
+
+	//没有修改的行不计入影响行数, CLIENT_FOUND_ROWS时返回匹配的行数
+	if affectedRows := execute(ctx, "update User set email = 'x'").GetAffectedRows(); affectedRows != 1 {
+		t.Fatalf("expected 1 affected row, got %d", affectedRows)
+	}
+	ctx.connection.foundRows = true
+	if affectedRows := execute(ctx, "update User set email = 'x'").GetAffectedRows(); affectedRows != 3 {
+		t.Fatalf("expected 3 matched rows, got %d", affectedRows)
+	}
+}
+
+func TestUpdatePrimaryKey(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+
+	execute(ctx, "update User set id = id + 10 order by id desc")
+	assertRows(t, execute(ctx, "select id, email from User"), [][]string{
+		{"11", "1@qq.com"},
+		{"12", "2@qq.com"},
+		{"13", "3@qq.com"},
+	})
+
+	//主键重复时整条语句不生效
+	func() {
+		defer func() {
+			err, ok := recover().(*common.SQLError)
+			if !ok || err.Code != common.ER_DUP_ENTRY {
+				t.Fatalf("expected duplicate entry error, got %v", err)
+			}
+		}()
+		execute(ctx, "update User set id = id + 1 where id < 13 order by id")
+	}()
+	assertRows(t, execute(ctx, "select id from User"), [][]string{{"11"}, {"12"}, {"13"}})
+
+	func() {
+		defer func() {
+			err, ok := recover().(*common.SQLError)
+			if !ok || err.Code != common.ER_DUP_ENTRY {
+				t.Fatalf("expected duplicate entry error, got %v", err)
+			}
+		}()
+		execute(ctx, "insert into User VALUES (1,'1@qq.com',1),(11,'11@qq.com',11)")
+	}()
+	assertRows(t, execute(ctx, "select id from User"), [][]string{{"11"}, {"12"}, {"13"}})
+
+	//写入的值转换为字段的类型, 小数写入整数主键时四舍五入
+	execute(ctx, "update User set id = id / 2 where id = 11")
+	assertRows(t, execute(ctx, "select id from User"), [][]string{{"6"}, {"12"}, {"13"}})
+	assertSQLError(t, <-executeAsync(ctx, "update User set id = id / 2 - 0.5 where id = 13"), common.ER_DUP_ENTRY)
+	execute(ctx, "insert into User VALUES ('7', 7, 7.4)")
+	assertRows(t, execute(ctx, "select * from User where id = 7"), [][]string{{"7", "7", "7"}})
+	assertSQLError(t, <-executeAsync(ctx, "insert into User VALUES ('8a','8@qq.com',8)"), common.ER_TRUNCATED_WRONG_VALUE_FOR_FIELD)
+	assertSQLError(t, <-executeAsync(ctx, "update User set age = 'x' where id = 7"), common.ER_TRUNCATED_WRONG_VALUE_FOR_FIELD)
+	assertRows(t, execute(ctx, "select id, age from User"), [][]string{{"6", "10"}, {"7", "7"}, {"12", "1"}, {"13", "30"}})
+
+	//超出字段取值范围的值返回错误, 无符号字段不接受负数
+	assertSQLError(t, <-executeAsync(ctx, "insert into User VALUES (8,'8@qq.com',-5)"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "update User set age = age - 8 where id = 7"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "insert into User VALUES (8,'8@qq.com',4294967296)"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "insert into User VALUES (2147483648,'8@qq.com',8)"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "insert into User VALUES (8,'8@qq.com','1e30')"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "insert into User VALUES ('-1e30','8@qq.com',8)"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	execute(ctx, "insert into User VALUES (-2147483648,'8@qq.com',4294967295)")
+	assertRows(t, execute(ctx, "select id, age from User where id < 0"), [][]string{{"-2147483648", "4294967295"}})
+	execute(ctx, "create table N(a TINYINT, b SMALLINT UNSIGNED, c BIGINT, d FLOAT)")
+	execute(ctx, "insert into N VALUES (-128, 65535, -9223372036854775808, 1.5)")
+	assertSQLError(t, <-executeAsync(ctx, "insert into N VALUES (128, 0, 0, 0)"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "insert into N VALUES (0, 65536, 0, 0)"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "insert into N VALUES (0, 0, 9300000000000000000.5, 0)"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertSQLError(t, <-executeAsync(ctx, "insert into N VALUES (0, 0, 0, '1e39')"), common.ER_WARN_DATA_OUT_OF_RANGE)
+	assertRows(t, execute(ctx, "select * from N"), [][]string{{"-128", "65535", "-9223372036854775808", "1.5"}})
+}
+
+func TestRestart(t *testing.T) {
+	path := t.TempDir()
+	ctx := newTestContextByPath(path)
+	createUserTable(ctx)
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	for i := 1; i <= 3000; i++ {
+		execute(ctx, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", i, i))
+	}
+	execute(ctx, "delete from T where id > 1000 and id <= 2000")
+	execute(ctx, "update T set name = 'updated' where id % 100 = 0")
+	ctx.store.Close()
+
+	ctx = newTestContextByPath(path)
+	defer ctx.store.Close()
+	assertRows(t, execute(ctx, "select * from User"), [][]string{
+		{"1", "1@qq.com", "10"},
+		{"2", "2@qq.com", "1"},
+		{"3", "3@qq.com", "30"},
+	})
+	assertRows(t, execute(ctx, "select count(*), min(id), max(id) from T"), [][]string{{"2000", "1", "3000"}})
+	assertRows(t, execute(ctx, "select count(*) from T where name = 'updated'"), [][]string{{"20"}})
+	execute(ctx, "insert into T VALUES (1500,'name-1500')")
+	assertRows(t, execute(ctx, "select name from T where id = 1500"), [][]string{{"name-1500"}})
+}
+
+func TestRecovery(t *testing.T) {
+	path := t.TempDir()
+	//不关闭也不写回脏页, 模拟进程崩溃
+	ctx := newTestContextByOptions(&icna.Options{Path: path, FlushInterval: time.Hour})
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	for i := 1; i <= 500; i++ {
+		execute(ctx, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", i, i))
+	}
+	execute(ctx, "delete from T where id > 100 and id <= 200")
+	execute(ctx, "update T set name = 'updated' where id % 50 = 0")
+	func() {
+		defer func() {
+			recover()
+		}()
+		execute(ctx, "insert into T VALUES (1001,'name-1001'),(1002,'name-1002'),(1,'name-1')")
+	}()
+	execute(ctx, "create table L(message VARCHAR(20))")
+	execute(ctx, "insert into L VALUES ('a'),('b')")
+	execute(ctx, "delete from L where message = 'b'")
+
+	ctx = newTestContextByPath(path)
+	defer ctx.store.Close()
+	assertRows(t, execute(ctx, "select count(*), min(id), max(id) from T"), [][]string{{"400", "1", "500"}})
+	assertRows(t, execute(ctx, "select count(*) from T where name = 'updated'"), [][]string{{"8"}})
+	assertRows(t, execute(ctx, "select name from T where id = 1"), [][]string{{"name-1"}})
+	//重做的行推进隐藏的行ID, 恢复之后清除的行ID不会重新使用
+	execute(ctx, "insert into L VALUES ('c')")
+	keys := readIndexKeys(ctx.store.GetTable("default", "l").ClusterIndex.Scan(nil, nil, false), 2)
+	assertIndexKeys(t, keys, 2, "a-1", "c-3")
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	execute(ctx, "begin")
+	execute(ctx, "insert into User VALUES (1001,'trx-1',1)")
+	execute(ctx, "rollback")
+	assertRows(t, execute(ctx, "select count(*) from User where id = 1001"), [][]string{{"0"}})
+
+	execute(ctx, "start transaction")
+	execute(ctx, "insert into User VALUES (1001,'trx-1',1)")
+	//语句失败时只撤销本条语句
+	func() {
+		defer func() {
+			recover()
+		}()
+		execute(ctx, "insert into User VALUES (1002,'trx-2',2),(1001,'trx-1',1)")
+	}()
+	execute(ctx, "update User set email = 'trx-updated' where id = 1001")
+	execute(ctx, "commit")
+	assertRows(t, execute(ctx, "select id, email from User where id > 1000"), [][]string{{"1001", "trx-updated"}})
+}
+
+func TestAutoCommit(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	execute(ctx, "set autocommit = 0")
+	execute(ctx, "insert into User VALUES (1001,'trx-1',1)")
+	if ctx.session.GetTrx() == nil {
+		t.Fatal("expected an implicit transaction when autocommit is off")
+	}
+	execute(ctx, "rollback")
+	assertRows(t, execute(ctx, "select count(*) from User where id = 1001"), [][]string{{"0"}})
+
+	execute(ctx, "insert into User VALUES (1001,'trx-1',1)")
+	//开启自动提交时提交当前事务
+	execute(ctx, "set autocommit = 1")
+	if ctx.session.GetTrx() != nil {
+		t.Fatal("expected the transaction to be committed")
+	}
+	execute(ctx, "rollback")
+	assertRows(t, execute(ctx, "select count(*), @@autocommit from User where id = 1001"), [][]string{{"1", "1"}})
+}
+
+// 记录打开的读视图数量的存储
+type readViewCountStore struct {
+	store.Store
+	views int
+}
+
+func (self *readViewCountStore) CreateReadView() *transaction.ReadView {
+	self.views++
+	return self.Store.CreateReadView()
+}
+
+func (self *readViewCountStore) CloseReadView(view *transaction.ReadView) {
+	self.views--
+	self.Store.CloseReadView(view)
+}
+
+// 打开结果集失败时关闭结果集仍然释放语句的读视图
+func TestReadViewReleasedOnOpenFailure(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	countStore := &readViewCountStore{Store: ctx.store}
+	ctx.store = countStore
+	recordSet := execute(ctx, "select * from User")
+	execute(ctx, "drop table User")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected table not exists")
+			}
+		}()
+		defer recordSet.Close()
+		recordSet.Next()
+	}()
+	if countStore.views != 0 {
+		t.Fatalf("expected no open read views, got %d", countStore.views)
+	}
+}
+
+func TestSnapshotRead(t *testing.T) {
+	reader := newTestContext(t)
+	writer := newTestContextByStore(reader.store)
+	createUserTable(writer)
+
+	execute(reader, "begin")
+	assertRows(t, execute(reader, "select count(*) from User"), [][]string{{"3"}})
+	execute(writer, "insert into User VALUES (4,'4@qq.com',40)")
+	execute(writer, "delete from User where id = 1")
+	execute(writer, "update User set email = 'updated' where id = 2")
+	execute(writer, "update User set id = 30 where id = 3")
+	//事务中读取开始时的快照
+	assertRows(t, execute(reader, "select id, email from User"), [][]string{
+		{"1", "1@qq.com"},
+		{"2", "2@qq.com"},
+		{"3", "3@qq.com"},
+	})
+	execute(reader, "commit")
+	assertRows(t, execute(reader, "select id, email from User"), [][]string{
+		{"2", "updated"},
+		{"4", "4@qq.com"},
+		{"30", "3@qq.com"},
+	})
+
+	//读不到没有提交的修改, 事务自己的修改可见
+	execute(writer, "begin")
+	execute(writer, "insert into User VALUES (5,'5@qq.com',50)")
+	execute(writer, "delete from User where id = 2")
+	assertRows(t, execute(reader, "select id from User"), [][]string{{"2"}, {"4"}, {"30"}})
+	assertRows(t, execute(writer, "select id from User"), [][]string{{"4"}, {"5"}, {"30"}})
+	execute(writer, "rollback")
+	assertRows(t, execute(reader, "select id from User"), [][]string{{"2"}, {"4"}, {"30"}})
+
+	//删除后重新插入相同的主键
+	execute(reader, "begin")
+	assertRows(t, execute(reader, "select count(*) from User"), [][]string{{"3"}})
+	execute(writer, "delete from User where id = 4")
+	execute(writer, "insert into User VALUES (4,'new',41)")
+	assertRows(t, execute(reader, "select email from User where id = 4"), [][]string{{"4@qq.com"}})
+	execute(reader, "commit")
+	assertRows(t, execute(reader, "select email from User where id = 4"), [][]string{{"new"}})
+}
+
+func TestIsolationLevel(t *testing.T) {
+	reader := newTestContext(t)
+	writer := newTestContextByStore(reader.store)
+	createUserTable(writer)
+
+	//读未提交读到没有提交的修改
+	execute(reader, "set session transaction isolation level read uncommitted")
+	execute(writer, "begin")
+	execute(writer, "insert into User VALUES (4,'4@qq.com',40)")
+	assertRows(t, execute(reader, "select count(*), @@transaction_isolation from User"), [][]string{{"4", "READ-UNCOMMITTED"}})
+	execute(writer, "rollback")
+
+	//读已提交每条语句读到已经提交的修改, 可重复读只读事务开始时的快照
+	execute(reader, "set transaction_isolation = 'read-committed'")
+	execute(reader, "begin")
+	assertRows(t, execute(reader, "select count(*) from User"), [][]string{{"3"}})
+	execute(writer, "insert into User VALUES (4,'4@qq.com',40)")
+	assertRows(t, execute(reader, "select count(*) from User"), [][]string{{"4"}})
+	execute(reader, "commit")
+	execute(reader, "set transaction isolation level repeatable read")
+	execute(reader, "begin")
+	assertRows(t, execute(reader, "select count(*) from User"), [][]string{{"4"}})
+	execute(writer, "delete from User where id = 4")
+	assertRows(t, execute(reader, "select count(*) from User"), [][]string{{"4"}})
+	//SET TRANSACTION不能在事务中执行
+	func() {
+		defer func() {
+			err, ok := recover().(*common.SQLError)
+			if !ok || err.Code != common.ER_CANT_CHANGE_TX_CHARACTERISTICS {
+				t.Fatalf("expected can't change transaction characteristics error, got %v", err)
+			}
+		}()
+		execute(reader, "set transaction isolation level serializable")
+	}()
+	execute(reader, "commit")
+	//只对下一个事务生效
+	assertRows(t, execute(reader, "select @@transaction_isolation"), [][]string{{"READ-COMMITTED"}})
+
+	//串行化: 事务中的查询加共享锁, 并发的事务修改读取过的范围时等待, 互相等待时死锁
+	execute(reader, "set session transaction isolation level serializable")
+	execute(writer, "set session transaction isolation level serializable")
+	execute(reader, "begin")
+	execute(writer, "begin")
+	assertRows(t, execute(reader, "select count(*) from User"), [][]string{{"3"}})
+	assertRows(t, execute(writer, "select count(*) from User"), [][]string{{"3"}})
+	done := executeAsync(reader, "insert into User VALUES (10,'10@qq.com',10)")
+	assertBlocked(t, done)
+	assertSQLError(t, <-executeAsync(writer, "insert into User VALUES (11,'11@qq.com',11)"), common.ER_LOCK_DEADLOCK)
+	if writer.session.GetTrx() != nil {
+		t.Fatal("expected the deadlocked transaction to be rolled back")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	execute(reader, "commit")
+	assertRows(t, execute(writer, "select id from User where id >= 10"), [][]string{{"10"}})
+
+	//按主键查询只锁定读取的行, 并发的事务修改其他的行不会等待或失败
+	execute(reader, "begin")
+	execute(writer, "begin")
+	assertRows(t, execute(reader, "select age from User where id = 1"), [][]string{{"10"}})
+	execute(writer, "update User set age = 21 where id = 2")
+	execute(writer, "commit")
+	done = executeAsync(writer, "update User set age = 11 where id = 1")
+	assertBlocked(t, done)
+	execute(reader, "update User set age = 12 where id = 3")
+	execute(reader, "commit")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, execute(reader, "select id, age from User"), [][]string{{"1", "11"}, {"2", "21"}, {"3", "12"}, {"10", "10"}})
+}
+
+// 在另一个协程中执行, 返回执行结束时的错误
+func executeAsync(ctx context.ExecuteContext, sql string) chan any {
+	done := make(chan any, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		execute(ctx, sql)
+	}()
+	return done
+}
+
+func assertBlocked(t *testing.T, done chan any) {
+	select {
+	case err := <-done:
+		t.Fatalf("expected the statement to wait for the lock, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func assertSQLError(t *testing.T, err any, code uint16) {
+	sqlError, ok := err.(*common.SQLError)
+	if !ok || sqlError.Code != code {
+		t.Fatalf("expected error %d, got %v", code, err)
+	}
+}
+
+func TestRowLock(t *testing.T) {
+	a := newTestContext(t)
+	b := newTestContextByStore(a.store)
+	createUserTable(a)
+
+	//修改同一行时等待持有锁的事务提交
+	execute(a, "begin")
+	execute(a, "update User set age = age + 1 where id = 1")
+	done := executeAsync(b, "update User set age = age + 10 where id = 1")
+	assertBlocked(t, done)
+	execute(a, "commit")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, execute(a, "select age from User where id = 1"), [][]string{{"21"}})
+
+	//next-key锁阻止向读取的范围内插入
+	execute(a, "begin")
+	assertRows(t, execute(a, "select count(*) from User where age > 100 for update"), [][]string{{"0"}})
+	done = executeAsync(b, "insert into User VALUES (4,'4@qq.com',200)")
+	assertBlocked(t, done)
+	assertRows(t, execute(a, "select count(*) from User where age > 100 lock in share mode"), [][]string{{"0"}})
+	execute(a, "commit")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	//等待超时只撤销本条语句
+	execute(b, "set innodb_lock_wait_timeout = 1")
+	execute(a, "begin")
+	execute(a, "insert into User VALUES (6,'6@qq.com',60)")
+	execute(b, "begin")
+	execute(b, "insert into User VALUES (5,'5@qq.com',50)")
+	assertSQLError(t, <-executeAsync(b, "insert into User VALUES (6,'6@qq.com',60)"), common.ER_LOCK_WAIT_TIMEOUT)
+	execute(a, "rollback")
+	execute(b, "commit")
+	assertRows(t, execute(a, "select id from User where id > 3"), [][]string{{"4"}, {"5"}})
+
+	//互相等待时后请求的事务作为死锁的牺牲者回滚
+	execute(a, "begin")
+	execute(b, "begin")
+	execute(a, "insert into User VALUES (10,'10@qq.com',10)")
+	execute(b, "insert into User VALUES (11,'11@qq.com',11)")
+	done = executeAsync(a, "insert into User VALUES (11,'a@qq.com',11)")
+	assertBlocked(t, done)
+	assertSQLError(t, <-executeAsync(b, "insert into User VALUES (10,'b@qq.com',10)"), common.ER_LOCK_DEADLOCK)
+	if b.session.GetTrx() != nil {
+		t.Fatal("expected the deadlock victim to be rolled back")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	execute(a, "commit")
+	assertRows(t, execute(a, "select email from User where id >= 10"), [][]string{{"10@qq.com"}, {"a@qq.com"}})
+}
+
+func TestConcurrentInsert(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	var dones []chan any
+	for i := range 4 {
+		sql := "insert into User VALUES "
+		for j := range 50 {
+			id := 100 + j*4 + i
+			if j > 0 {
+				sql += ","
+			}
+			sql += fmt.Sprintf("(%d,'%d@qq.com',%d)", id, id, id)
+		}
+		dones = append(dones, executeAsync(newTestContextByStore(ctx.store), sql))
+	}
+	for _, done := range dones {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertRows(t, execute(ctx, "select count(*) from User"), [][]string{{"203"}})
+}
+
+// 一个连接建表和删表, 另一个连接和后台清除同时读取表的映射, 使用-race运行时检查映射的并发读写
+func TestConcurrentDDL(t *testing.T) {
+	ctx := newTestContextByOptions(&icna.Options{Path: t.TempDir(), FlushInterval: time.Millisecond})
+	t.Cleanup(ctx.store.Close)
+	createUserTable(ctx)
+	done := make(chan any)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		ddlCtx := newTestContextByStore(ctx.store)
+		for i := range 50 {
+			execute(ddlCtx, fmt.Sprintf("create table T%d(id INT PRIMARY KEY)", i))
+			execute(ddlCtx, fmt.Sprintf("drop table T%d", i))
+		}
+	}()
+	for i := range 50 {
+		execute(ctx, fmt.Sprintf("insert into User VALUES (%d,'%d@qq.com',%d)", 100+i, i, i))
+		execute(ctx, fmt.Sprintf("delete from User where id = %d", 100+i))
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, execute(ctx, "select count(*) from User"), [][]string{{"3"}})
+}
+
+// 分批扫描期间删除表, 下一批不能读取已经关闭的索引
+func TestScanDroppedTable(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	for i := range icna.SCAN_BATCH_SIZE {
+		execute(ctx, fmt.Sprintf("insert into User VALUES (%d,'%d@qq.com',%d)", 100+i, i, i))
+	}
+	iterator := ctx.store.Scan(nil, "default", "user")
+	for range icna.SCAN_BATCH_SIZE {
+		iterator.Next()
+	}
+	execute(newTestContextByStore(ctx.store), "drop table User")
+	defer func() {
+		if err := recover(); err != "table not exists: user" {
+			t.Fatalf("expected table not exists, got %v", err)
+		}
+	}()
+	iterator.HasNext()
+}
+
+func TestSavepoint(t *testing.T) {
+	ctx := newTestContext(t)
+	createUserTable(ctx)
+	execute(ctx, "begin")
+	execute(ctx, "insert into User VALUES (4,'4@qq.com',40)")
+	execute(ctx, "savepoint a")
+	execute(ctx, "update User set age = 0 where id = 4")
+	execute(ctx, "savepoint b")
+	execute(ctx, "delete from User where id = 1")
+	execute(ctx, "rollback to savepoint a")
+	assertRows(t, execute(ctx, "select id, age from User where id in (1,4)"), [][]string{{"1", "10"}, {"4", "40"}})
+	//之后设置的保存点被删除, 回滚到的保存点保留
+	func() {
+		defer func() {
+			assertSQLError(t, recover(), common.ER_SP_DOES_NOT_EXIST)
+		}()
+		execute(ctx, "rollback to b")
+	}()
+	execute(ctx, "delete from User where id = 2")
+	execute(ctx, "rollback work to A")
+	execute(ctx, "release savepoint a")
+	func() {
+		defer func() {
+			assertSQLError(t, recover(), common.ER_SP_DOES_NOT_EXIST)
+		}()
+		execute(ctx, "rollback to savepoint a")
+	}()
+	execute(ctx, "commit")
+	assertRows(t, execute(ctx, "select id from User"), [][]string{{"1"}, {"2"}, {"3"}, {"4"}})
+}
+
+func TestXa(t *testing.T) {
+	path := t.TempDir()
+	//不关闭也不写回脏页, 模拟进程崩溃
+	ctx := newTestContextByOptions(&icna.Options{Path: path, FlushInterval: time.Hour})
+	createUserTable(ctx)
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	execute(ctx, "insert into T VALUES (1,'name-1'),(2,'name-2')")
+	execute(ctx, "xa start 'trx-1'")
+	execute(ctx, "insert into User VALUES (4,'4@qq.com',40)")
+	execute(ctx, "update User set age = 11 where id = 1")
+	assertSQLError(t, <-executeAsync(ctx, "commit"), common.ER_XAER_RMFAIL)
+	execute(ctx, "xa end 'trx-1'")
+	assertSQLError(t, <-executeAsync(ctx, "select * from User for update"), common.ER_XAER_RMFAIL)
+	execute(ctx, "xa prepare 'trx-1'")
+	//xid区分大小写
+	execute(ctx, "xa start 'Trx-2','B',2")
+	execute(ctx, "delete from T where id = 2")
+	execute(ctx, "xa end 'Trx-2','B',2")
+	execute(ctx, "xa prepare 'Trx-2','B',2")
+	other := newTestContextByStore(ctx.store)
+	execute(other, "xa start 'trx-2','b',2")
+	execute(other, "xa end 'trx-2','b',2")
+	execute(other, "xa rollback 'trx-2','b',2")
+
+	//已经准备的事务在重启后保留修改和行锁, 提交之前其他事务读不到
+	ctx = newTestContextByPath(path)
+	defer ctx.store.Close()
+	assertRows(t, execute(ctx, "xa recover"), [][]string{{"1", "5", "0", "trx-1"}, {"2", "5", "1", "Trx-2B"}})
+	assertRows(t, execute(ctx, "select id, age from User"), [][]string{{"1", "10"}, {"2", "1"}, {"3", "30"}})
+	assertRows(t, execute(ctx, "select id from T"), [][]string{{"1"}, {"2"}})
+	execute(ctx, "set innodb_lock_wait_timeout = 1")
+	assertSQLError(t, <-executeAsync(ctx, "update User set age = 0 where id = 1"), common.ER_LOCK_WAIT_TIMEOUT)
+	assertSQLError(t, <-executeAsync(ctx, "delete from T where id = 2"), common.ER_LOCK_WAIT_TIMEOUT)
+	execute(ctx, "xa commit 'trx-1'")
+	assertSQLError(t, <-executeAsync(ctx, "xa rollback 'trx-2','b',2"), common.ER_XAER_NOTA)
+	execute(ctx, "xa rollback 'Trx-2','B',2")
+	assertSQLError(t, <-executeAsync(ctx, "xa commit 'trx-1'"), common.ER_XAER_NOTA)
+	assertRows(t, execute(ctx, "select id, age from User"), [][]string{{"1", "11"}, {"2", "1"}, {"3", "30"}, {"4", "40"}})
+	assertRows(t, execute(ctx, "select id from T"), [][]string{{"1"}, {"2"}})
+
+	//一阶段提交, xid不能重复, 普通事务中不能开始XA事务
+	other = newTestContextByStore(ctx.store)
+	execute(ctx, "xa start 'trx-3'")
+	execute(ctx, "insert into User VALUES (5,'5@qq.com',50)")
+	assertSQLError(t, <-executeAsync(other, "xa start 'trx-3'"), common.ER_XAER_DUPID)
+	assertSQLError(t, <-executeAsync(ctx, "xa commit 'trx-3' one phase"), common.ER_XAER_RMFAIL)
+	execute(ctx, "xa end 'trx-3'")
+	execute(ctx, "xa commit 'trx-3' one phase")
+	execute(other, "begin")
+	assertSQLError(t, <-executeAsync(other, "xa start 'trx-4'"), common.ER_XAER_OUTSIDE)
+	execute(other, "commit")
+	assertRows(t, execute(ctx, "select count(*) from User"), [][]string{{"5"}})
+	assertRows(t, execute(ctx, "xa recover"), [][]string{})
+}
+
+func TestCheckpoint(t *testing.T) {
+	path, archivePath := t.TempDir(), t.TempDir()
+	//不关闭也不写回脏页, 模拟进程崩溃
+	ctx := newTestContextByOptions(&icna.Options{
+		Path: path, FlushInterval: time.Hour, LogSegmentSize: 4096, LogArchivePath: archivePath,
+	})
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	for i := 1; i <= 300; i++ {
+		execute(ctx, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", i, i))
+	}
+	execute(ctx, "flush logs")
+	status := make(map[string]string)
+	for _, row := range rowsToStrings(readRows(execute(ctx, "show status"))) {
+		status[row[0]] = row[1]
+	}
+	archived, _ := os.ReadDir(archivePath)
+	if status["Icna_log_segments"] != "1" || status["Icna_log_segments_removed"] != strconv.Itoa(len(archived)) || len(archived) < 2 {
+		t.Fatalf("expected the old log segments to be archived, got %v and %d archived", status, len(archived))
+	}
+	if status["Icna_checkpoint_lsn"] != status["Icna_log_lsn"] {
+		t.Fatalf("expected the checkpoint to cover the whole log, got %v", status)
+	}
+
+	//检查点之后的修改从剩下的日志恢复
+	for i := 301; i <= 400; i++ {
+		execute(ctx, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", i, i))
+	}
+	execute(ctx, "update T set name = 'updated' where id % 100 = 0")
+	ctx = newTestContextByPath(path)
+	defer ctx.store.Close()
+	assertRows(t, execute(ctx, "select count(*), min(id), max(id) from T"), [][]string{{"400", "1", "400"}})
+	assertRows(t, execute(ctx, "select count(*) from T where name = 'updated'"), [][]string{{"4"}})
+}
+
+// 回填索引期间持有锁, 后台刷新不能运行, 缓冲池不能超出容量持续增长
+func TestBufferPoolBound(t *testing.T) {
+	ctx := newTestContextByOptions(&icna.Options{Path: t.TempDir(), BufferPoolSize: 16, FlushInterval: time.Hour})
+	defer ctx.store.Close()
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(200))")
+	sql := "insert into T VALUES "
+	for i := range 2000 {
+		if i > 0 {
+			sql += ","
+		}
+		sql += fmt.Sprintf("(%d,'%0150d')", i, i)
+	}
+	execute(ctx, sql)
+	execute(ctx, "create index idx_name on T(name)")
+	for _, row := range rowsToStrings(readRows(execute(ctx, "show status"))) {
+		if pages, _ := strconv.Atoi(row[1]); row[0] == "Icna_buffer_pool_pages" && pages > 32 {
+			t.Fatalf("expected the buffer pool to stay near its capacity, got %d pages", pages)
+		}
+	}
+	assertRows(t, execute(ctx, "select count(*) from T where name = '"+fmt.Sprintf("%0150d", 1999)+"'"), [][]string{{"1"}})
+}
+
+func TestGroupCommit(t *testing.T) {
+	path := t.TempDir()
+	//不关闭也不写回脏页, 模拟进程崩溃
+	ctx := newTestContextByOptions(&icna.Options{Path: path, FlushInterval: time.Hour})
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	var dones []chan any
+	for i := range 16 {
+		done := make(chan any, 1)
+		go func(other *testContext) {
+			defer func() {
+				done <- recover()
+			}()
+			for j := range 20 {
+				id := i*20 + j + 1
+				execute(other, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", id, id))
+			}
+		}(newTestContextByStore(ctx.store))
+		dones = append(dones, done)
+	}
+	for _, done := range dones {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//提交返回之前已经同步到磁盘
+	ctx = newTestContextByPath(path)
+	defer ctx.store.Close()
+	assertRows(t, execute(ctx, "select count(*), min(id), max(id) from T"), [][]string{{"320", "1", "320"}})
+}
+
+// 复制目录中的全部文件, 用于基础备份
+func copyDir(t *testing.T, from string, to string) {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.MkdirAll(to, os.ModePerm)
+	for _, entry := range entries {
+		source, target := utils.ConcatFilePaths(from, entry.Name()), utils.ConcatFilePaths(to, entry.Name())
+		if entry.IsDir() {
+			copyDir(t, source, target)
+		} else if err = utils.CopyFile(source, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPointInTimeRecovery(t *testing.T) {
+	path, basePath, archivePath := t.TempDir(), t.TempDir(), t.TempDir()
+	options := &icna.Options{Path: path, LogSegmentSize: 4096, LogArchivePath: archivePath}
+	ctx := newTestContextByOptions(options)
+	createUserTable(ctx)
+	ctx.store.Close()
+	copyDir(t, path, basePath)
+
+	ctx = newTestContextByOptions(options)
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	for i := 1; i <= 100; i++ {
+		execute(ctx, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", i, i))
+	}
+	execute(ctx, "flush logs")
+	execute(ctx, "update User set age = 0 where id = 1")
+	var lsn uint64
+	for _, row := range rowsToStrings(readRows(execute(ctx, "show status"))) {
+		if row[0] == "Icna_log_lsn" {
+			lsn, _ = strconv.ParseUint(row[1], 10, 64)
+		}
+	}
+	execute(ctx, "delete from T where id > 50")
+	time.Sleep(10 * time.Millisecond)
+	target := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	//误删的表和之后的修改
+	execute(ctx, "drop table User")
+	execute(ctx, "insert into T VALUES (1000,'name-1000')")
+	ctx.store.Close()
+	copyDir(t, utils.ConcatFilePaths(path, icna.LOG_DIR), archivePath)
+
+	//恢复到删除表之前的时间, 恢复之后使用新的归档目录
+	restorePath, restoreArchivePath := t.TempDir(), t.TempDir()
+	copyDir(t, basePath, restorePath)
+	copyDir(t, archivePath, restoreArchivePath)
+	ctx = newTestContextByOptions(&icna.Options{
+		Path: restorePath, LogArchivePath: restoreArchivePath, RecoveryTarget: &transaction.RecoveryTarget{Time: target},
+	})
+	assertRows(t, execute(ctx, "select id, age from User"), [][]string{{"1", "0"}, {"2", "1"}, {"3", "30"}})
+	assertRows(t, execute(ctx, "select count(*), max(id) from T"), [][]string{{"50", "50"}})
+	ctx.store.Close()
+
+	//恢复到指定的日志, 之后没有提交的事务被撤销
+	restorePath = t.TempDir()
+	copyDir(t, basePath, restorePath)
+	ctx = newTestContextByOptions(&icna.Options{
+		Path: restorePath, LogArchivePath: archivePath, RecoveryTarget: &transaction.RecoveryTarget{Lsn: lsn},
+	})
+	defer ctx.store.Close()
+	assertRows(t, execute(ctx, "select id, age from User"), [][]string{{"1", "0"}, {"2", "1"}, {"3", "30"}})
+	assertRows(t, execute(ctx, "select count(*), max(id) from T"), [][]string{{"100", "100"}})
+}
+
+func TestBackup(t *testing.T) {
+	//备份目录保留字符串原来的大小写
+	backupPath := filepath.Join(t.TempDir(), "Backup")
+	path := t.TempDir()
+	ctx := newTestContextByOptions(&icna.Options{Path: path, FlushInterval: 10 * time.Millisecond, LogSegmentSize: 4096})
+	createUserTable(ctx)
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	//备份期间按顺序写入并提交
+	stop, done := make(chan struct{}), make(chan any, 1)
+	go func(writer *testContext) {
+		defer func() {
+			done <- recover()
+		}()
+		for id := 1; ; id++ {
+			select {
+			case <-stop:
+				return
+			default:
+				execute(writer, fmt.Sprintf("insert into T VALUES (%d,'name-%d')", id, id))
+			}
+		}
+	}(newTestContextByStore(ctx.store))
+	//备份时没有提交的事务
+	other := newTestContextByStore(ctx.store)
+	execute(other, "begin")
+	execute(other, "update User set age = 0 where id = 1")
+	time.Sleep(50 * time.Millisecond)
+	committed := readRows(execute(ctx, "select count(*) from T"))[0][0].ToString()
+	execute(ctx, "backup database to '"+backupPath+"'")
+	execute(other, "commit")
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	assertSQLError(t, <-executeAsync(ctx, "backup database to '"+backupPath+"'"), common.ER_FILE_EXISTS_ERROR)
+	ctx.store.Close()
+
+	//从备份启动, 得到备份结束时已经提交的修改
+	ctx = newTestContextByPath(backupPath)
+	defer ctx.store.Close()
+	assertRows(t, execute(ctx, "select id, age from User"), [][]string{{"1", "10"}, {"2", "1"}, {"3", "30"}})
+	rows := rowsToStrings(readRows(execute(ctx, "select count(*), min(id), max(id) from T")))
+	count, _ := strconv.Atoi(rows[0][0])
+	before, _ := strconv.Atoi(committed)
+	if count < before || rows[0][1] != "1" || rows[0][2] != rows[0][0] {
+		t.Fatalf("inconsistent backup: %v, %d rows committed before backup", rows, before)
+	}
+}
+
+// 按顺序读取迭代器中Entry的前几个字段
+func readIndexKeys(iterator meta.IndexIterator, fieldCount int) []string {
+	var keys []string
+	for iterator.HasNext() {
+		values := iterator.Next().GetValues()[:fieldCount]
+		key := make([]string, len(values))
+		for i, value := range values {
+			key[i] = value.ToString()
+		}
+		keys = append(keys, strings.Join(key, "-"))
+	}
+	return keys
+}
+
+func assertIndexKeys(t *testing.T, keys []string, count int, first string, last string) {
+	if len(keys) != count || (count > 0 && (keys[0] != first || keys[count-1] != last)) {
+		t.Fatalf("expected %d keys from %s to %s, got %v", count, first, last, keys)
+	}
+}
+
+// 主键不变时原地修改, 主键改变时移动
+func TestUpdateIndexEntry(t *testing.T) {
+	ctx := newTestContext(t)
+	defer ctx.store.Close()
+	execute(ctx, "create table T(id INT PRIMARY KEY, name VARCHAR(50))")
+	execute(ctx, "insert into T VALUES (1,'a'),(2,'b'),(3,'c')")
+	execute(ctx, "update T set name = 'cccccccccccccccccccc' where id = 3")
+	execute(ctx, "update T set id = 4 where id = 1")
+	assertRows(t, execute(ctx, "select id, name from T"), [][]string{{"2", "b"}, {"3", "cccccccccccccccccccc"}, {"4", "a"}})
+}
+
+func TestCreateIndex(t *testing.T) {
+	path := t.TempDir()
+	ctx := newTestContextByOptions(&icna.Options{Path: path, FlushInterval: time.Hour})
+	createUserTable(ctx)
+	getIndexKeys := func(indexName string) []string {
+		index := ctx.store.GetTable("default", "user").GetSecondaryIndex(indexName)
+		if index == nil {
+			return nil
+		}
+		return readIndexKeys(index.Scan(nil, nil, false), 2)
+	}
+	assertIndexRemoved := func(indexName string) {
+		_, err := os.Stat(utils.ConcatFilePaths(path, "user_"+indexName+".data"))
+		if !os.IsNotExist(err) || getIndexKeys(indexName) != nil {
+			t.Fatalf("index %s should be removed", indexName)
+		}
+	}
+
+	//回填时发现重复的值, 删除索引文件
+	execute(ctx, "insert into User VALUES (4,'1@qq.com',40)")
+	assertSQLError(t, <-executeAsync(ctx, "create unique index idx_email on User(email)"), common.ER_DUP_ENTRY)
+	assertIndexRemoved("idx_email")
+
+	//已删除的行在回填之前被清除, 唯一索引中的NULL不冲突
+	execute(ctx, "delete from User where id = 4")
+	execute(ctx, "create unique index idx_email on User(email)")
+	execute(ctx, "create unique index if not exists idx_email on User(age)")
+	execute(ctx, "create index idx_age on User(age)")
+	execute(ctx, "insert into User(id,age) VALUES (5,20),(6,20)")
+	assertIndexKeys(t, getIndexKeys("idx_email"), 5, "-5", "3@qq.com-3")
+	assertIndexKeys(t, getIndexKeys("idx_age"), 5, "1-2", "30-3")
+	assertSQLError(t, <-executeAsync(ctx, "insert into User VALUES (7,'2@qq.com',70)"), common.ER_DUP_ENTRY)
+	assertSQLError(t, <-executeAsync(ctx, "create index idx_age on User(email)"), common.ER_DUP_KEYNAME)
+	assertSQLError(t, <-executeAsync(ctx, "create index idx_name on User(name)"), common.ER_KEY_COLUMN_NOT_EXIST)
+	assertSQLError(t, <-executeAsync(ctx, "drop index idx_name on User"), common.ER_CANT_DROP_KEY)
+	execute(ctx, "drop index if exists idx_name on User")
+
+	//不关闭也不写回脏页, 恢复时按日志重建索引
+	execute(ctx, "update User set email = '4@qq.com' where id = 1")
+	ctx = newTestContextByPath(path)
+	assertIndexKeys(t, getIndexKeys("idx_email"), 5, "-5", "4@qq.com-1")
+	assertIndexKeys(t, getIndexKeys("idx_age"), 5, "1-2", "30-3")
+	execute(ctx, "drop index idx_age on User")
+	assertIndexRemoved("idx_age")
+	ctx.store.Close()
+
+	ctx = newTestContextByPath(path)
+	defer ctx.store.Close()
+	assertIndexRemoved("idx_age")
+	assertSQLError(t, <-executeAsync(ctx, "update User set email = '3@qq.com' where id = 2"), common.ER_DUP_ENTRY)
+	assertRows(t, execute(ctx, "select id, email from User where id = 2"), [][]string{{"2", "2@qq.com"}})
+}
+
+func TestSecondaryIndex(t *testing.T) {
+	a := newTestContext(t)
+	b := newTestContextByStore(a.store)
+	execute(a, `
+		create table Account(
+			id INT,
+			email VARCHAR(50) UNIQUE,
+			name VARCHAR(20),
+			age INT,
+			PRIMARY KEY (id),
+			KEY (age, name),
+			UNIQUE KEY uk_name (name)
+		);
+		insert into Account VALUES (1,'1@qq.com','a',10),(2,'2@qq.com','b',20),(3,'3@qq.com','c',20);
+	`)
+	table := a.store.GetTable("default", "account")
+	var indexNames []string
+	for _, index := range table.SecondaryIndexes {
+		indexNames = append(indexNames, index.GetName())
+	}
+	if strings.Join(indexNames, ",") != "email,age,uk_name" || table.PrimaryFields[0].Name != "id" {
+		t.Fatalf("unexpected indexes: %v", indexNames)
+	}
+	//二级索引的Entry为索引字段的值和主键
+	assertIndexKeys(t, readIndexKeys(table.GetSecondaryIndex("age").Scan(nil, nil, false), 3), 3, "10-a-1", "20-c-3")
+	assertSQLError(t, <-executeAsync(a, "create table T(id INT PRIMARY KEY, a INT, PRIMARY KEY (a))"), common.ER_MULTIPLE_PRI_KEY)
+	assertSQLError(t, <-executeAsync(a, "create table T(id INT PRIMARY KEY, KEY (a))"), common.ER_KEY_COLUMN_NOT_EXIST)
+	assertSQLError(t, <-executeAsync(a, "create table T(id INT PRIMARY KEY, a INT UNIQUE, KEY a (id))"), common.ER_DUP_KEYNAME)
+
+	//按索引查找, 二级索引按主键到聚簇索引读取完整的行
+	assertRows(t, execute(a, "select id, name from Account where email = '2@qq.com'"), [][]string{{"2", "b"}})
+	assertRows(t, execute(a, "select id from Account where 20 = age and name = 'c'"), [][]string{{"3"}})
+	assertRows(t, execute(a, "select id from Account where age = 20 and id > 2"), [][]string{{"3"}})
+	rows := readIndexKeys(a.store.IndexLookup(nil, "default", "account", "age", []meta.Value{meta.IntValue(20)}), 1)
+	assertIndexKeys(t, rows, 2, "2", "3")
+
+	//字段上的UNIQUE生效, 删除之后可以插入相同的值
+	assertSQLError(t, <-executeAsync(a, "insert into Account VALUES (4,'1@qq.com','d',40)"), common.ER_DUP_ENTRY)
+	execute(a, "delete from Account where id = 1")
+	execute(a, "insert into Account VALUES (4,'1@qq.com','a',40)")
+	assertRows(t, execute(a, "select id from Account where email = '1@qq.com'"), [][]string{{"4"}})
+
+	//其他事务去掉的唯一值在提交之前不能写入
+	execute(a, "begin")
+	execute(a, "update Account set email = '5@qq.com' where id = 2")
+	done := executeAsync(b, "insert into Account VALUES (5,'2@qq.com','e',50)")
+	assertBlocked(t, done)
+	execute(a, "rollback")
+	assertSQLError(t, <-done, common.ER_DUP_ENTRY)
+
+	//读视图按索引仍然可以读到之后删除和修改之前的版本
+	execute(a, "begin")
+	assertRows(t, execute(a, "select id from Account where email = '3@qq.com'"), [][]string{{"3"}})
+	execute(b, "delete from Account where id = 3")
+	execute(b, "insert into Account VALUES (6,'3@qq.com','f',60)")
+	execute(b, "update Account set email = '7@qq.com' where id = 2")
+	assertRows(t, execute(a, "select id from Account where email = '3@qq.com'"), [][]string{{"3"}})
+	assertRows(t, execute(a, "select id from Account where email = '2@qq.com'"), [][]string{{"2"}})
+	assertRows(t, execute(a, "select id from Account where email = '7@qq.com'"), [][]string{})
+	execute(a, "commit")
+	assertRows(t, execute(a, "select id from Account where email = '3@qq.com'"), [][]string{{"6"}})
+	assertRows(t, execute(a, "select id from Account where email = '7@qq.com'"), [][]string{{"2"}})
+}
+
+func TestCompositeKey(t *testing.T) {
+	path := t.TempDir()
+	ctx := newTestContextByPath(path)
+	execute(ctx, `
+		create table Score(
+			class INT,
+			no INT,
+			name VARCHAR(20),
+			score INT,
+			PRIMARY KEY (class, no),
+			UNIQUE KEY uk_name (class, name),
+			INDEX idx_score (score)
+		);
+		insert into Score VALUES (2,1,'c',80),(1,2,'b',90),(1,1,'a',70);
+	`)
+	//聚簇索引按主键的全部字段依次比较
+	assertRows(t, execute(ctx, "select * from Score"), [][]string{
+		{"1", "1", "a", "70"},
+		{"1", "2", "b", "90"},
+		{"2", "1", "c", "80"},
+	})
+	err := <-executeAsync(ctx, "insert into Score VALUES (1,2,'d',60)")
+	assertSQLError(t, err, common.ER_DUP_ENTRY)
+	if err.(*common.SQLError).Message != "Duplicate entry '1-2' for key 'PRIMARY'" {
+		t.Fatalf("unexpected message: %v", err)
+	}
+	assertSQLError(t, <-executeAsync(ctx, "insert into Score VALUES (1,3,'a',60)"), common.ER_DUP_ENTRY)
+	execute(ctx, "insert into Score VALUES (2,2,'a',60)")
+	assertRows(t, execute(ctx, "select no from Score where class = 1 and name = 'b'"), [][]string{{"2"}})
+	assertRows(t, execute(ctx, "select name from Score where class = 2"), [][]string{{"c"}, {"a"}})
+	execute(ctx, "update Score set class = 3 where class = 2 and no = 1")
+	assertRows(t, execute(ctx, "select class, no from Score where score = 80"), [][]string{{"3", "1"}})
+
+	//没有主键的表按隐藏的行ID保存, 相同的行可以重复插入
+	execute(ctx, `
+		create table Log(message VARCHAR(20), level INT);
+		insert into Log VALUES ('start',1),('start',1),('stop',2);
+	`)
+	recordSet := execute(ctx, "select * from Log")
+	if len(recordSet.GetColumns()) != 2 {
+		t.Fatalf("unexpected columns: %v", recordSet.GetColumns())
+	}
+	assertRows(t, recordSet, [][]string{{"start", "1"}, {"start", "1"}, {"stop", "2"}})
+	execute(ctx, "update Log set level = 3 where message = 'stop'")
+	execute(ctx, "delete from Log where message = 'start' limit 1")
+	ctx.store.Close()
+
+	ctx = newTestContextByPath(path)
+	execute(ctx, "insert into Log (message) VALUES ('restart')")
+	assertRows(t, execute(ctx, "select * from Log"), [][]string{{"start", "1"}, {"stop", "3"}, {"restart", "NULL"}})
+	assertRows(t, execute(ctx, "select class, no from Score where class = 1 and name = 'a'"), [][]string{{"1", "1"}})
+	//重启之后行ID从下一次写入描述页的位置继续
+	table := ctx.store.GetTable("default", "log")
+	assertIndexKeys(t, readIndexKeys(table.ClusterIndex.Scan(nil, nil, false), 3), 3, "start-1-2", "restart--256")
+	//最大的行ID删除并清除之后不会重新使用
+	execute(ctx, "delete from Log where message = 'restart'")
+	ctx.store.Close()
+
+	ctx = newTestContextByPath(path)
+	defer ctx.store.Close()
+	table = ctx.store.GetTable("default", "log")
+	assertIndexKeys(t, readIndexKeys(table.ClusterIndex.Scan(nil, nil, false), 3), 2, "start-1-2", "stop-3-3")
+	execute(ctx, "insert into Log VALUES ('again', 4)")
+	assertIndexKeys(t, readIndexKeys(table.ClusterIndex.Scan(nil, nil, false), 3), 3, "start-1-2", "again-4-512")
+}
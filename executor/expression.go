@@ -0,0 +1,349 @@
+package executor
+
+import (
+	"Relatdb/meta"
+	"Relatdb/parser/ast"
+	"Relatdb/parser/token"
+	"fmt"
+	"strings"
+)
+
+// 表达式名称, 作为结果集的列名
+func expressionName(expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Name
+	case *ast.ColumnName:
+		return expressionName(expr.Name)
+	case *ast.StringLiteral:
+		return expr.Value
+	case *ast.NumberLiteral:
+		return expr.Literal
+	case *ast.BooleanLiteral:
+		if expr.Value {
+			return "true"
+		}
+		return "false"
+	case *ast.NullLiteral:
+		return "null"
+	case *ast.VariableName:
+		return "@" + expressionName(expr.Name)
+	case *ast.VariableRef:
+		return "@@" + expressionName(expr.Name)
+	case *ast.CallExpression:
+		arguments := make([]string, len(expr.Arguments))
+		for i, argument := range expr.Arguments {
+			arguments[i] = expressionName(argument)
+		}
+		return expressionName(expr.Callee) + "(" + strings.Join(arguments, ",") + ")"
+	case *ast.BinaryExpression:
+		switch expr.Operator {
+		case token.AND, token.OR:
+			return expressionName(expr.Left) + " " + expr.Operator.String() + " " + expressionName(expr.Right)
+		}
+		return expressionName(expr.Left) + expr.Operator.String() + expressionName(expr.Right)
+	case *ast.UnaryExpression:
+		if expr.Operator == token.NOT {
+			return "not " + expressionName(expr.Operand)
+		}
+		return expr.Operator.String() + expressionName(expr.Operand)
+	case *ast.IsNullExpression:
+		if expr.Not {
+			return expressionName(expr.Expr) + " is not null"
+		}
+		return expressionName(expr.Expr) + " is null"
+	case *ast.InExpression:
+		list := make([]string, len(expr.List))
+		for i, item := range expr.List {
+			list[i] = expressionName(item)
+		}
+		return expressionName(expr.Expr) + notName(expr.Not) + " in (" + strings.Join(list, ",") + ")"
+	case *ast.BetweenExpression:
+		return expressionName(expr.Expr) + notName(expr.Not) + " between " +
+			expressionName(expr.Low) + " and " + expressionName(expr.High)
+	case *ast.LikeExpression:
+		return expressionName(expr.Expr) + notName(expr.Not) + " like " + expressionName(expr.Pattern)
+	default:
+		panic(fmt.Errorf("unsupported expression type: %T", expr))
+	}
+}
+
+func notName(not bool) string {
+	if not {
+		return " not"
+	}
+	return ""
+}
+
+func calleeName(call *ast.CallExpression) string {
+	return expressionName(call.Callee)
+}
+
+func isAggregateCall(expr ast.Expression) bool {
+	call, ok := expr.(*ast.CallExpression)
+	return ok && isAggregateFunction(calleeName(call))
+}
+
+// 收集表达式中的聚合函数
+func collectAggregateCalls(expr ast.Expression, calls []*ast.CallExpression) []*ast.CallExpression {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		if isAggregateCall(expr) {
+			return append(calls, expr)
+		}
+		for _, argument := range expr.Arguments {
+			calls = collectAggregateCalls(argument, calls)
+		}
+	case *ast.BinaryExpression:
+		calls = collectAggregateCalls(expr.Left, calls)
+		calls = collectAggregateCalls(expr.Right, calls)
+	case *ast.UnaryExpression:
+		calls = collectAggregateCalls(expr.Operand, calls)
+	case *ast.IsNullExpression:
+		calls = collectAggregateCalls(expr.Expr, calls)
+	case *ast.InExpression:
+		calls = collectAggregateCalls(expr.Expr, calls)
+		for _, item := range expr.List {
+			calls = collectAggregateCalls(item, calls)
+		}
+	case *ast.BetweenExpression:
+		calls = collectAggregateCalls(expr.Expr, calls)
+		calls = collectAggregateCalls(expr.Low, calls)
+		calls = collectAggregateCalls(expr.High, calls)
+	case *ast.LikeExpression:
+		calls = collectAggregateCalls(expr.Expr, calls)
+		calls = collectAggregateCalls(expr.Pattern, calls)
+	}
+	return calls
+}
+
+// 将不是下层算子列的字段名替换为同名别名的查询字段表达式, 用于HAVING和ORDER BY
+func resolveAliases(columns []meta.Value, fields []*ast.SelectField, expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.ColumnName:
+		name := expressionName(expr)
+		if findColumn(columns, name) >= 0 {
+			return expr
+		}
+		for _, field := range fields {
+			if field.AsName != nil && expressionName(field.AsName) == name {
+				return field.Expr
+			}
+		}
+		return expr
+	case *ast.BinaryExpression:
+		binaryExpression := *expr
+		binaryExpression.Left = resolveAliases(columns, fields, expr.Left)
+		binaryExpression.Right = resolveAliases(columns, fields, expr.Right)
+		return &binaryExpression
+	case *ast.UnaryExpression:
+		unaryExpression := *expr
+		unaryExpression.Operand = resolveAliases(columns, fields, expr.Operand)
+		return &unaryExpression
+	case *ast.IsNullExpression:
+		isNullExpression := *expr
+		isNullExpression.Expr = resolveAliases(columns, fields, expr.Expr)
+		return &isNullExpression
+	case *ast.InExpression:
+		inExpression := *expr
+		inExpression.Expr = resolveAliases(columns, fields, expr.Expr)
+		inExpression.List = make([]ast.Expression, len(expr.List))
+		for i, item := range expr.List {
+			inExpression.List[i] = resolveAliases(columns, fields, item)
+		}
+		return &inExpression
+	case *ast.BetweenExpression:
+		betweenExpression := *expr
+		betweenExpression.Expr = resolveAliases(columns, fields, expr.Expr)
+		betweenExpression.Low = resolveAliases(columns, fields, expr.Low)
+		betweenExpression.High = resolveAliases(columns, fields, expr.High)
+		return &betweenExpression
+	case *ast.LikeExpression:
+		likeExpression := *expr
+		likeExpression.Expr = resolveAliases(columns, fields, expr.Expr)
+		likeExpression.Pattern = resolveAliases(columns, fields, expr.Pattern)
+		return &likeExpression
+	default:
+		return expr
+	}
+}
+
+func findColumn(columns []meta.Value, name string) int {
+	for i, column := range columns {
+		if column.ToString() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 将表达式编译为基于行的求值函数, columns为行的列名
+func (self *Executor) compileExpression(columns []meta.Value, expr ast.Expression) RowEvaluator {
+	switch expr := expr.(type) {
+	case *ast.ColumnName:
+		name := expressionName(expr)
+		index := findColumn(columns, name)
+		if index < 0 {
+			panic(fmt.Errorf("unknown column: %s", name))
+		}
+		return func(row []meta.Value) meta.Value {
+			return row[index]
+		}
+	case *ast.CallExpression:
+		if isAggregateCall(expr) {
+			name := expressionName(expr)
+			index := findColumn(columns, name)
+			if index < 0 {
+				panic(fmt.Errorf("invalid use of group function: %s", name))
+			}
+			return func(row []meta.Value) meta.Value {
+				return row[index]
+			}
+		}
+		name := calleeName(expr)
+		arguments := make([]RowEvaluator, len(expr.Arguments))
+		for i, argument := range expr.Arguments {
+			arguments[i] = self.compileExpression(columns, argument)
+		}
+		return func(row []meta.Value) meta.Value {
+			values := make([]meta.Value, len(arguments))
+			for i, argument := range arguments {
+				values[i] = argument(row)
+			}
+			return self.callFunction(name, values)
+		}
+	case *ast.BinaryExpression:
+		left := self.compileExpression(columns, expr.Left)
+		right := self.compileExpression(columns, expr.Right)
+		switch expr.Operator {
+		case token.AND:
+			return logicalAnd(left, right)
+		case token.OR:
+			return logicalOr(left, right)
+		case token.ASSIGN, token.EQUAL, token.NOT_EQUAL,
+			token.LESS, token.LESS_OR_EQUAL, token.GREATER, token.GREATER_OR_EQUAL:
+			return func(row []meta.Value) meta.Value {
+				return compareOperation(expr.Operator, left(row), right(row))
+			}
+		case token.ADDITION, token.SUBTRACT, token.MULTIPLY, token.DIVIDE, token.REMAINDER:
+			return func(row []meta.Value) meta.Value {
+				return arithmeticOperation(expr.Operator, left(row), right(row))
+			}
+		default:
+			panic(fmt.Errorf("unsupported binary operator: %s", expr.Operator))
+		}
+	case *ast.UnaryExpression:
+		operand := self.compileExpression(columns, expr.Operand)
+		switch expr.Operator {
+		case token.NOT, token.NOT_ARITHMETIC:
+			return func(row []meta.Value) meta.Value {
+				return logicalNot(operand(row))
+			}
+		case token.SUBTRACT:
+			return func(row []meta.Value) meta.Value {
+				return negateValue(operand(row))
+			}
+		case token.ADDITION:
+			return operand
+		default:
+			panic(fmt.Errorf("unsupported unary operator: %s", expr.Operator))
+		}
+	case *ast.IsNullExpression:
+		operand := self.compileExpression(columns, expr.Expr)
+		return func(row []meta.Value) meta.Value {
+			return booleanValue(isNullValue(operand(row)) != expr.Not)
+		}
+	case *ast.InExpression:
+		return self.compileInExpression(columns, expr)
+	case *ast.BetweenExpression:
+		operand := self.compileExpression(columns, expr.Expr)
+		low := self.compileExpression(columns, expr.Low)
+		high := self.compileExpression(columns, expr.High)
+		between := logicalAnd(
+			func(row []meta.Value) meta.Value {
+				return compareOperation(token.GREATER_OR_EQUAL, operand(row), low(row))
+			},
+			func(row []meta.Value) meta.Value {
+				return compareOperation(token.LESS_OR_EQUAL, operand(row), high(row))
+			},
+		)
+		if expr.Not {
+			return func(row []meta.Value) meta.Value {
+				return logicalNot(between(row))
+			}
+		}
+		return between
+	case *ast.LikeExpression:
+		operand := self.compileExpression(columns, expr.Expr)
+		pattern := self.compileExpression(columns, expr.Pattern)
+		return func(row []meta.Value) meta.Value {
+			value, patternValue := operand(row), pattern(row)
+			if isNullValue(value) || isNullValue(patternValue) {
+				return meta.CONST_NULL_VALUE
+			}
+			return booleanValue(likeMatch([]rune(value.ToString()), []rune(patternValue.ToString())) != expr.Not)
+		}
+	case *ast.NullLiteral:
+		return func(row []meta.Value) meta.Value {
+			return meta.CONST_NULL_VALUE
+		}
+	default:
+		value := self.evalExpression(expr)
+		return func(row []meta.Value) meta.Value {
+			return value
+		}
+	}
+}
+
+// IN: 找到相等的值时为真, 否则列表中存在NULL时为NULL
+func (self *Executor) compileInExpression(columns []meta.Value, expr *ast.InExpression) RowEvaluator {
+	operand := self.compileExpression(columns, expr.Expr)
+	list := make([]RowEvaluator, len(expr.List))
+	for i, item := range expr.List {
+		list[i] = self.compileExpression(columns, item)
+	}
+	return func(row []meta.Value) meta.Value {
+		value := operand(row)
+		if isNullValue(value) {
+			return meta.CONST_NULL_VALUE
+		}
+		hasNull := false
+		for _, item := range list {
+			itemValue := item(row)
+			if isNullValue(itemValue) {
+				hasNull = true
+				continue
+			}
+			if compareNotNullValues(value, itemValue) == 0 {
+				return booleanValue(!expr.Not)
+			}
+		}
+		if hasNull {
+			return meta.CONST_NULL_VALUE
+		}
+		return booleanValue(expr.Not)
+	}
+}
+
+// 将表达式编译为条件判断函数, 只有结果为真的行满足条件, 结果为假或NULL的行都被过滤
+func (self *Executor) compilePredicate(columns []meta.Value, expr ast.Expression) RowPredicate {
+	evaluator := self.compileExpression(columns, expr)
+	return func(row []meta.Value) bool {
+		return isTrueValue(evaluator(row))
+	}
+}
+
+// 比较两个值, NULL小于任何非NULL值
+func compareValues(a meta.Value, b meta.Value) int {
+	aIsNull, bIsNull := isNullValue(a), isNullValue(b)
+	if aIsNull || bIsNull {
+		if aIsNull && bIsNull {
+			return 0
+		}
+		if aIsNull {
+			return -1
+		}
+		return 1
+	}
+	return compareNotNullValues(a, b)
+}
@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"Relatdb/executor/context"
+	"Relatdb/meta"
+	"fmt"
+)
+
+type ScalarFunction func(ctx context.ExecuteContext, arguments []meta.Value) meta.Value
+
+var scalarFunctions = map[string]ScalarFunction{
+	"connection_id": func(ctx context.ExecuteContext, arguments []meta.Value) meta.Value {
+		return meta.ToValue(ctx.GetConnection().GetConnectionId())
+	},
+	"database": func(ctx context.ExecuteContext, arguments []meta.Value) meta.Value {
+		return meta.StringValue(ctx.GetConnection().GetDatabase())
+	},
+	"schema": func(ctx context.ExecuteContext, arguments []meta.Value) meta.Value {
+		return meta.StringValue(ctx.GetConnection().GetDatabase())
+	},
+	"user": func(ctx context.ExecuteContext, arguments []meta.Value) meta.Value {
+		return meta.StringValue(ctx.GetConnection().GetUserName())
+	},
+	"current_user": func(ctx context.ExecuteContext, arguments []meta.Value) meta.Value {
+		return meta.StringValue(ctx.GetConnection().GetUserName())
+	},
+}
+
+func (self *Executor) callFunction(name string, arguments []meta.Value) meta.Value {
+	function := scalarFunctions[name]
+	if function == nil {
+		panic(fmt.Errorf("unsupported function: %s", name))
+	}
+	return function(self.ctx, arguments)
+}
@@ -0,0 +1,404 @@
+package executor
+
+import (
+	"Relatdb/common"
+	"Relatdb/meta"
+	"Relatdb/parser/token"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+三值逻辑: 1为真, 0为假, NULL为未知
+非NULL值按数值判断真假, 字符串按其数值前缀转换
+*/
+var (
+	trueValue  = meta.IntValue(1)
+	falseValue = meta.IntValue(0)
+)
+
+func booleanValue(b bool) meta.Value {
+	if b {
+		return trueValue
+	}
+	return falseValue
+}
+
+func isTrueValue(value meta.Value) bool {
+	return !isNullValue(value) && toTruthNumber(value) != 0
+}
+
+func isFalseValue(value meta.Value) bool {
+	return !isNullValue(value) && toTruthNumber(value) == 0
+}
+
+func toTruthNumber(value meta.Value) float64 {
+	if value.GetType() != meta.StringValueType {
+		return value.ToFloat64()
+	}
+	return parseNumberPrefix(value.ToString())
+}
+
+// 按字符串开头的数字部分转换, 如'1abc'为1, 开头没有数字时为0
+func parseNumberPrefix(s string) float64 {
+	s = strings.TrimLeft(s, " \t\r\n")
+	isDigit := func(i int) bool {
+		return i < len(s) && s[i] >= '0' && s[i] <= '9'
+	}
+	end, digits := 0, 0
+	if end < len(s) && (s[end] == '+' || s[end] == '-') {
+		end++
+	}
+	for ; isDigit(end); end++ {
+		digits++
+	}
+	if end < len(s) && s[end] == '.' {
+		for end++; isDigit(end); end++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0
+	}
+	if end < len(s) && (s[end] == 'e' || s[end] == 'E') {
+		exponent := end + 1
+		if exponent < len(s) && (s[exponent] == '+' || s[exponent] == '-') {
+			exponent++
+		}
+		if isDigit(exponent) {
+			end = exponent
+			for isDigit(end) {
+				end++
+			}
+		}
+	}
+	number, _ := strconv.ParseFloat(s[:end], 64)
+	return number
+}
+
+func isIntegerValue(value meta.Value) bool {
+	return value.GetType() == meta.Int64ValueType || value.GetType() == meta.IntValueType
+}
+
+func isIntegerField(field *meta.Field) bool {
+	switch field.Type {
+	case common.FIELD_TYPE_TINY, common.FIELD_TYPE_SHORT, common.FIELD_TYPE_INT24, common.FIELD_TYPE_LONG, common.FIELD_TYPE_LONGLONG:
+		return true
+	}
+	return false
+}
+
+func isFloatField(field *meta.Field) bool {
+	switch field.Type {
+	case common.FIELD_TYPE_FLOAT, common.FIELD_TYPE_DOUBLE, common.FIELD_TYPE_DECIMAL, common.FIELD_TYPE_NEW_DECIMAL:
+		return true
+	}
+	return false
+}
+
+func isStringField(field *meta.Field) bool {
+	switch field.Type {
+	case common.FIELD_TYPE_STRING, common.FIELD_TYPE_VARCHAR, common.FIELD_TYPE_VAR_STRING:
+		return true
+	}
+	return false
+}
+
+/*
+INSERT和UPDATE写入的值转换为字段的类型, 索引中同一字段的值按相同的方式比较
+小数写入整数字段时四舍五入, 不是数字的字符串写入数值字段时返回错误, row为出错的行号
+超出字段取值范围的值返回错误, 不截断或回绕
+*/
+func convertFieldValue(field *meta.Field, value meta.Value, row int) meta.Value {
+	if isNullValue(value) {
+		return value
+	}
+	switch {
+	case isIntegerField(field):
+		if !isIntegerValue(value) {
+			number, ok := parseNumberValue(value)
+			if !ok {
+				panic(newWrongFieldValueError("integer", field, value, row))
+			}
+			number = math.Round(number)
+			if !(number >= math.MinInt64 && number < math.MaxInt64) {
+				panic(newOutOfRangeError(field, row))
+			}
+			value = meta.Int64Value(number)
+		}
+		low, up := getIntegerRange(field)
+		if number := value.ToInt64(); number < low || number > up {
+			panic(newOutOfRangeError(field, row))
+		}
+		return value
+	case isFloatField(field):
+		number, ok := parseNumberValue(value)
+		if !ok {
+			panic(newWrongFieldValueError("double", field, value, row))
+		}
+		if field.Type == common.FIELD_TYPE_FLOAT && math.Abs(number) > math.MaxFloat32 {
+			panic(newOutOfRangeError(field, row))
+		}
+		return meta.Float64Value(number)
+	case isStringField(field):
+		if value.GetType() != meta.StringValueType {
+			return meta.StringValue(value.ToString())
+		}
+	}
+	return value
+}
+
+// 字符串按完整的内容转换为数字, 不允许多余的字符
+func parseNumberValue(value meta.Value) (float64, bool) {
+	if value.GetType() != meta.StringValueType {
+		return value.ToFloat64(), true
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value.ToString()), 64)
+	return number, err == nil
+}
+
+// 整数字段的取值范围, 无符号的BIGINT只能保存到int64的最大值
+func getIntegerRange(field *meta.Field) (int64, int64) {
+	var bits uint
+	switch field.Type {
+	case common.FIELD_TYPE_TINY:
+		bits = 8
+	case common.FIELD_TYPE_SHORT:
+		bits = 16
+	case common.FIELD_TYPE_INT24:
+		bits = 24
+	case common.FIELD_TYPE_LONG:
+		bits = 32
+	default:
+		if field.Flag&common.UNSIGNED_FLAG != 0 {
+			return 0, math.MaxInt64
+		}
+		return math.MinInt64, math.MaxInt64
+	}
+	if field.Flag&common.UNSIGNED_FLAG != 0 {
+		return 0, 1<<bits - 1
+	}
+	return -1 << (bits - 1), 1<<(bits-1) - 1
+}
+
+func newOutOfRangeError(field *meta.Field, row int) error {
+	return common.NewSQLError(common.ER_WARN_DATA_OUT_OF_RANGE, "22003",
+		fmt.Sprintf("Out of range value for column '%s' at row %d", field.Name, row))
+}
+
+func newBigintOutOfRangeError(expression string) error {
+	return common.NewSQLError(common.ER_WARN_DATA_OUT_OF_RANGE, "22003", "BIGINT value is out of range in '"+expression+"'")
+}
+
+func newWrongFieldValueError(typeName string, field *meta.Field, value meta.Value, row int) error {
+	return common.NewSQLError(common.ER_TRUNCATED_WRONG_VALUE_FOR_FIELD, "HY000",
+		fmt.Sprintf("Incorrect %s value: '%s' for column '%s' at row %d", typeName, value.ToString(), field.Name, row))
+}
+
+func logicalAnd(left RowEvaluator, right RowEvaluator) RowEvaluator {
+	return func(row []meta.Value) meta.Value {
+		leftValue := left(row)
+		if isFalseValue(leftValue) {
+			return falseValue
+		}
+		rightValue := right(row)
+		if isFalseValue(rightValue) {
+			return falseValue
+		}
+		if isNullValue(leftValue) || isNullValue(rightValue) {
+			return meta.CONST_NULL_VALUE
+		}
+		return trueValue
+	}
+}
+
+func logicalOr(left RowEvaluator, right RowEvaluator) RowEvaluator {
+	return func(row []meta.Value) meta.Value {
+		leftValue := left(row)
+		if isTrueValue(leftValue) {
+			return trueValue
+		}
+		rightValue := right(row)
+		if isTrueValue(rightValue) {
+			return trueValue
+		}
+		if isNullValue(leftValue) || isNullValue(rightValue) {
+			return meta.CONST_NULL_VALUE
+		}
+		return falseValue
+	}
+}
+
+func logicalNot(value meta.Value) meta.Value {
+	if isNullValue(value) {
+		return meta.CONST_NULL_VALUE
+	}
+	return booleanValue(!isTrueValue(value))
+}
+
+/*
+比较两个非NULL值:
+都是字符串时按字符串比较, 都是整数时按整数比较, 其余情况转换为浮点数比较
+*/
+func compareNotNullValues(a meta.Value, b meta.Value) int {
+	if a.GetType() == meta.StringValueType && b.GetType() == meta.StringValueType {
+		return strings.Compare(a.ToString(), b.ToString())
+	}
+	if isIntegerValue(a) && isIntegerValue(b) {
+		x, y := a.ToInt64(), b.ToInt64()
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	}
+	x, y := a.ToFloat64(), b.ToFloat64()
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+// 比较运算, 任意一边为NULL时结果为NULL
+func compareOperation(operator token.Token, a meta.Value, b meta.Value) meta.Value {
+	if isNullValue(a) || isNullValue(b) {
+		return meta.CONST_NULL_VALUE
+	}
+	comp := compareNotNullValues(a, b)
+	switch operator {
+	case token.ASSIGN, token.EQUAL:
+		return booleanValue(comp == 0)
+	case token.NOT_EQUAL:
+		return booleanValue(comp != 0)
+	case token.LESS:
+		return booleanValue(comp < 0)
+	case token.LESS_OR_EQUAL:
+		return booleanValue(comp <= 0)
+	case token.GREATER:
+		return booleanValue(comp > 0)
+	case token.GREATER_OR_EQUAL:
+		return booleanValue(comp >= 0)
+	default:
+		panic(fmt.Errorf("unsupported comparison operator: %s", operator))
+	}
+}
+
+/*
+算术运算, 任意一边为NULL时结果为NULL
+两边都是整数时按整数计算, 超出BIGINT的范围时返回错误, 除法总是按浮点数计算, 除数为0时结果为NULL
+*/
+func arithmeticOperation(operator token.Token, a meta.Value, b meta.Value) meta.Value {
+	if isNullValue(a) || isNullValue(b) {
+		return meta.CONST_NULL_VALUE
+	}
+	if operator == token.DIVIDE {
+		divisor := b.ToFloat64()
+		if divisor == 0 {
+			return meta.CONST_NULL_VALUE
+		}
+		return meta.Float64Value(a.ToFloat64() / divisor)
+	}
+	if isIntegerValue(a) && isIntegerValue(b) {
+		x, y := a.ToInt64(), b.ToInt64()
+		switch operator {
+		case token.ADDITION:
+			result := x + y
+			if (x >= 0) == (y >= 0) && (result >= 0) != (x >= 0) {
+				panic(newBigintOutOfRangeError(fmt.Sprintf("%d %s %d", x, operator, y)))
+			}
+			return meta.Int64Value(result)
+		case token.SUBTRACT:
+			result := x - y
+			if (x >= 0) != (y >= 0) && (result >= 0) != (x >= 0) {
+				panic(newBigintOutOfRangeError(fmt.Sprintf("%d %s %d", x, operator, y)))
+			}
+			return meta.Int64Value(result)
+		case token.MULTIPLY:
+			result := x * y
+			if x != 0 && (result/x != y || (x == -1 && y == math.MinInt64)) {
+				panic(newBigintOutOfRangeError(fmt.Sprintf("%d %s %d", x, operator, y)))
+			}
+			return meta.Int64Value(result)
+		case token.REMAINDER:
+			if y == 0 {
+				return meta.CONST_NULL_VALUE
+			}
+			return meta.Int64Value(x % y)
+		}
+	} else {
+		x, y := a.ToFloat64(), b.ToFloat64()
+		switch operator {
+		case token.ADDITION:
+			return meta.Float64Value(x + y)
+		case token.SUBTRACT:
+			return meta.Float64Value(x - y)
+		case token.MULTIPLY:
+			return meta.Float64Value(x * y)
+		case token.REMAINDER:
+			if y == 0 {
+				return meta.CONST_NULL_VALUE
+			}
+			return meta.Float64Value(math.Mod(x, y))
+		}
+	}
+	panic(fmt.Errorf("unsupported arithmetic operator: %s", operator))
+}
+
+func negateValue(value meta.Value) meta.Value {
+	if isNullValue(value) {
+		return meta.CONST_NULL_VALUE
+	}
+	if isIntegerValue(value) {
+		if value.ToInt64() == math.MinInt64 {
+			panic(newBigintOutOfRangeError(fmt.Sprintf("-(%d)", value.ToInt64())))
+		}
+		return meta.Int64Value(-value.ToInt64())
+	}
+	return meta.Float64Value(-value.ToFloat64())
+}
+
+// LIKE匹配, %匹配任意个字符, _匹配单个字符, \转义
+func likeMatch(text []rune, pattern []rune) bool {
+	textIndex, patternIndex := 0, 0
+	starPatternIndex, starTextIndex := -1, 0
+	for textIndex < len(text) {
+		if patternIndex < len(pattern) {
+			char := pattern[patternIndex]
+			switch {
+			case char == '%':
+				starPatternIndex, starTextIndex = patternIndex, textIndex
+				patternIndex++
+				continue
+			case char == '_':
+				textIndex++
+				patternIndex++
+				continue
+			case char == '\\' && patternIndex+1 < len(pattern):
+				if pattern[patternIndex+1] == text[textIndex] {
+					textIndex++
+					patternIndex += 2
+					continue
+				}
+			case char == text[textIndex]:
+				textIndex++
+				patternIndex++
+				continue
+			}
+		}
+		//回溯到上一个%, 让其多匹配一个字符
+		if starPatternIndex < 0 {
+			return false
+		}
+		starTextIndex++
+		textIndex, patternIndex = starTextIndex, starPatternIndex+1
+	}
+	for patternIndex < len(pattern) && pattern[patternIndex] == '%' {
+		patternIndex++
+	}
+	return patternIndex == len(pattern)
+}
@@ -0,0 +1,290 @@
+package executor
+
+import (
+	"Relatdb/meta"
+	"slices"
+)
+
+/*
+火山模型算子: 上层算子通过Next逐行向下层算子拉取数据
+Open -> Next... -> Close, Next返回nil表示没有更多的行
+*/
+type Operator interface {
+	GetColumns() []meta.Value
+	Open()
+	Next() []meta.Value
+	Close()
+}
+
+type RowEvaluator func(row []meta.Value) meta.Value
+
+type RowPredicate func(row []meta.Value) bool
+
+type RowComparator func(a []meta.Value, b []meta.Value) int
+
+// 内存行
+type ValuesOperator struct {
+	columns  []meta.Value
+	rows     [][]meta.Value
+	position int
+}
+
+func NewValuesOperator(columns []meta.Value, rows [][]meta.Value) *ValuesOperator {
+	return &ValuesOperator{
+		columns: columns,
+		rows:    rows,
+	}
+}
+
+func (self *ValuesOperator) GetColumns() []meta.Value {
+	return self.columns
+}
+
+func (self *ValuesOperator) Open() {
+	self.position = 0
+}
+
+func (self *ValuesOperator) Next() []meta.Value {
+	if self.position >= len(self.rows) {
+		return nil
+	}
+	row := self.rows[self.position]
+	self.position++
+	return row
+}
+
+func (self *ValuesOperator) Close() {
+}
+
+/*
+扫描表的行, 打开时调用scan得到迭代器
+scan由执行器根据语句决定: 使用读视图的一致性读, 加锁的锁定读, 或者按主键或唯一索引的等值查找
+*/
+type TableScanOperator struct {
+	table    *meta.Table
+	scan     func(table *meta.Table) meta.IndexIterator
+	columns  []meta.Value
+	iterator meta.IndexIterator
+}
+
+func NewTableScanOperator(table *meta.Table, scan func(table *meta.Table) meta.IndexIterator) *TableScanOperator {
+	columns := make([]meta.Value, len(table.Fields))
+	for i, field := range table.Fields {
+		columns[i] = meta.StringValue(field.Name)
+	}
+	return &TableScanOperator{
+		table:   table,
+		scan:    scan,
+		columns: columns,
+	}
+}
+
+func (self *TableScanOperator) GetColumns() []meta.Value {
+	return self.columns
+}
+
+func (self *TableScanOperator) Open() {
+	self.iterator = self.scan(self.table)
+}
+
+func (self *TableScanOperator) Next() []meta.Value {
+	if !self.iterator.HasNext() {
+		return nil
+	}
+	return self.iterator.Next().GetValues()
+}
+
+func (self *TableScanOperator) Close() {
+	self.iterator = nil
+}
+
+// 关闭时释放语句的读视图
+type ReadViewOperator struct {
+	child   Operator
+	release func()
+}
+
+func NewReadViewOperator(child Operator, release func()) *ReadViewOperator {
+	return &ReadViewOperator{
+		child:   child,
+		release: release,
+	}
+}
+
+func (self *ReadViewOperator) GetColumns() []meta.Value {
+	return self.child.GetColumns()
+}
+
+func (self *ReadViewOperator) Open() {
+	self.child.Open()
+}
+
+func (self *ReadViewOperator) Next() []meta.Value {
+	return self.child.Next()
+}
+
+func (self *ReadViewOperator) Close() {
+	self.child.Close()
+	self.release()
+}
+
+// 过滤
+type FilterOperator struct {
+	child     Operator
+	predicate RowPredicate
+}
+
+func NewFilterOperator(child Operator, predicate RowPredicate) *FilterOperator {
+	return &FilterOperator{
+		child:     child,
+		predicate: predicate,
+	}
+}
+
+func (self *FilterOperator) GetColumns() []meta.Value {
+	return self.child.GetColumns()
+}
+
+func (self *FilterOperator) Open() {
+	self.child.Open()
+}
+
+func (self *FilterOperator) Next() []meta.Value {
+	for row := self.child.Next(); row != nil; row = self.child.Next() {
+		if self.predicate(row) {
+			return row
+		}
+	}
+	return nil
+}
+
+func (self *FilterOperator) Close() {
+	self.child.Close()
+}
+
+// 投影
+type ProjectOperator struct {
+	child      Operator
+	columns    []meta.Value
+	evaluators []RowEvaluator
+}
+
+func NewProjectOperator(child Operator, columns []meta.Value, evaluators []RowEvaluator) *ProjectOperator {
+	return &ProjectOperator{
+		child:      child,
+		columns:    columns,
+		evaluators: evaluators,
+	}
+}
+
+func (self *ProjectOperator) GetColumns() []meta.Value {
+	return self.columns
+}
+
+func (self *ProjectOperator) Open() {
+	self.child.Open()
+}
+
+func (self *ProjectOperator) Next() []meta.Value {
+	row := self.child.Next()
+	if row == nil {
+		return nil
+	}
+	projectRow := make([]meta.Value, len(self.evaluators))
+	for i, evaluator := range self.evaluators {
+		projectRow[i] = evaluator(row)
+	}
+	return projectRow
+}
+
+func (self *ProjectOperator) Close() {
+	self.child.Close()
+}
+
+// 排序, 需要先读取下层算子的全部行
+type SortOperator struct {
+	child      Operator
+	comparator RowComparator
+	rows       [][]meta.Value
+	position   int
+}
+
+func NewSortOperator(child Operator, comparator RowComparator) *SortOperator {
+	return &SortOperator{
+		child:      child,
+		comparator: comparator,
+	}
+}
+
+func (self *SortOperator) GetColumns() []meta.Value {
+	return self.child.GetColumns()
+}
+
+func (self *SortOperator) Open() {
+	self.child.Open()
+	self.rows = nil
+	self.position = 0
+	for row := self.child.Next(); row != nil; row = self.child.Next() {
+		self.rows = append(self.rows, row)
+	}
+	slices.SortStableFunc(self.rows, self.comparator)
+}
+
+func (self *SortOperator) Next() []meta.Value {
+	if self.position >= len(self.rows) {
+		return nil
+	}
+	row := self.rows[self.position]
+	self.position++
+	return row
+}
+
+func (self *SortOperator) Close() {
+	self.rows = nil
+	self.child.Close()
+}
+
+// 分页
+type LimitOperator struct {
+	child    Operator
+	offset   int
+	count    int
+	returned int
+}
+
+func NewLimitOperator(child Operator, offset int, count int) *LimitOperator {
+	return &LimitOperator{
+		child:  child,
+		offset: offset,
+		count:  count,
+	}
+}
+
+func (self *LimitOperator) GetColumns() []meta.Value {
+	return self.child.GetColumns()
+}
+
+func (self *LimitOperator) Open() {
+	self.child.Open()
+	self.returned = 0
+	for range self.offset {
+		if self.child.Next() == nil {
+			break
+		}
+	}
+}
+
+func (self *LimitOperator) Next() []meta.Value {
+	if self.returned >= self.count {
+		return nil
+	}
+	row := self.child.Next()
+	if row != nil {
+		self.returned++
+	}
+	return row
+}
+
+func (self *LimitOperator) Close() {
+	self.child.Close()
+}
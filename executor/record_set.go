@@ -2,26 +2,31 @@ package executor
 
 import "Relatdb/meta"
 
+/*
+结果集, operator为nil时表示没有返回行(如DDL, INSERT等), 只返回影响行数
+有operator时通过Next逐行拉取, 不需要将全部行读入内存
+*/
 type RecordSet interface {
 	GetAffectedRows() uint64
 	GetInsertId() uint64
+	HasRows() bool
 	GetColumns() []meta.Value
-	GetRows() [][]meta.Value
+	Next() []meta.Value
+	Close()
 }
 
 type RecordSetImpl struct {
 	affectedRows uint64
 	insertId     uint64
-	columns      []meta.Value
-	rows         [][]meta.Value
+	operator     Operator
+	opened       bool
 }
 
-func NewRecordSet(affectedRows uint64, insertId uint64, columns []meta.Value, rows [][]meta.Value) RecordSet {
+func NewRecordSet(affectedRows uint64, insertId uint64, operator Operator) RecordSet {
 	return &RecordSetImpl{
 		affectedRows: affectedRows,
 		insertId:     insertId,
-		columns:      columns,
-		rows:         rows,
+		operator:     operator,
 	}
 }
 
@@ -33,10 +38,32 @@ func (self *RecordSetImpl) GetInsertId() uint64 {
 	return self.insertId
 }
 
+func (self *RecordSetImpl) HasRows() bool {
+	return self.operator != nil
+}
+
 func (self *RecordSetImpl) GetColumns() []meta.Value {
-	return self.columns
+	if self.operator == nil {
+		return nil
+	}
+	return self.operator.GetColumns()
+}
+
+func (self *RecordSetImpl) Next() []meta.Value {
+	if self.operator == nil {
+		return nil
+	}
+	//打开失败时Close仍然关闭算子, 释放打开期间获取的读视图
+	if !self.opened {
+		self.opened = true
+		self.operator.Open()
+	}
+	return self.operator.Next()
 }
 
-func (self *RecordSetImpl) GetRows() [][]meta.Value {
-	return self.rows
+func (self *RecordSetImpl) Close() {
+	if self.opened {
+		self.operator.Close()
+		self.opened = false
+	}
 }
@@ -0,0 +1,307 @@
+package executor
+
+import (
+	"Relatdb/meta"
+	"Relatdb/parser/ast"
+	"Relatdb/parser/token"
+	"Relatdb/transaction"
+	"fmt"
+)
+
+/*
+查询使用一致性读, 不阻塞修改也读不到没有提交的修改
+不在事务中时整条语句使用同一个读视图, 结果集关闭时释放
+串行化的事务中的查询作为共享锁定读执行, 与MySQL的LOCK IN SHARE MODE相同
+*/
+func (self *Executor) executeSelectStatement(stmt *ast.SelectStatement) RecordSet {
+	if stmt.Lock != nil {
+		return self.executeLockingSelect(stmt)
+	}
+	if trx := self.getTrx(); trx != nil && trx.GetIsolationLevel() == transaction.SERIALIZABLE {
+		return self.executeLockingSelect(stmt)
+	}
+	return NewRecordSet(0, 0, NewReadViewOperator(self.buildSelectOperator(stmt), self.closeReadView))
+}
+
+// 锁定读在事务中读取全部的行, 自动提交时语句结束后释放锁
+func (self *Executor) executeLockingSelect(stmt *ast.SelectStatement) RecordSet {
+	var columns []meta.Value
+	var rows [][]meta.Value
+	self.executeInTrx(func(trx *transaction.Trx) {
+		self.lockTrx, self.lockMode = trx, transaction.LOCK_S
+		if stmt.Lock != nil && stmt.Lock.Exclusive {
+			self.lockMode = transaction.LOCK_X
+		}
+		operator := self.buildSelectOperator(stmt)
+		columns = operator.GetColumns()
+		rows = readAllRows(operator)
+	})
+	return NewRecordSet(0, 0, NewValuesOperator(columns, rows))
+}
+
+// 锁定读读取最新的版本并加锁, 否则按读视图一致性读
+func (self *Executor) scanTable(table *meta.Table) meta.IndexIterator {
+	store := self.ctx.GetStore()
+	if self.lockTrx != nil {
+		return store.LockingScan(self.lockTrx, self.lockMode, table.DatabaseName, table.Name)
+	}
+	return store.Scan(self.getReadView(table), table.DatabaseName, table.Name)
+}
+
+/*
+一致性读的WHERE中字段等于常量的条件匹配索引最前面的字段时按索引查找, 查到的行仍然由WHERE过滤
+主键匹配时使用聚簇索引, 否则使用匹配字段最多的二级索引
+锁定读匹配完整的主键时只读取并锁定这一行, 否则扫描全表
+*/
+func (self *Executor) getTableScan(table *meta.Table, where ast.Expression) func(table *meta.Table) meta.IndexIterator {
+	values := self.collectEqualValues(where, make(map[string]meta.Value))
+	if self.lockTrx != nil {
+		key := getIndexKey(table.ClusterIndex, values)
+		if len(key) < len(table.PrimaryFields) {
+			return self.scanTable
+		}
+		return func(table *meta.Table) meta.IndexIterator {
+			return self.ctx.GetStore().LockingGet(self.lockTrx, self.lockMode, table.DatabaseName, table.Name, key)
+		}
+	}
+	var indexName string
+	var key []meta.Value
+	for _, index := range self.ctx.GetStore().GetIndexes(table.DatabaseName, table.Name) {
+		indexKey := getIndexKey(index, values)
+		if index == table.ClusterIndex && len(indexKey) > 0 {
+			indexName, key = meta.PRIMARY_KEY_NAME, indexKey
+			break
+		}
+		if len(indexKey) > len(key) {
+			indexName, key = index.GetName(), indexKey
+		}
+	}
+	if key == nil {
+		return self.scanTable
+	}
+	return func(table *meta.Table) meta.IndexIterator {
+		return self.ctx.GetStore().IndexLookup(self.getReadView(table), table.DatabaseName, table.Name, indexName, key)
+	}
+}
+
+// 按索引字段的顺序取出等于常量的值, 遇到没有条件的字段时结束
+func getIndexKey(index meta.Index, values map[string]meta.Value) []meta.Value {
+	var key []meta.Value
+	for _, field := range index.GetFields() {
+		value, ok := values[field.Name]
+		if !ok || !isIndexValue(field, value) {
+			break
+		}
+		key = append(key, value)
+	}
+	return key
+}
+
+// AND连接的字段等于常量的条件, 按字段名记录常量
+func (self *Executor) collectEqualValues(expr ast.Expression, values map[string]meta.Value) map[string]meta.Value {
+	binaryExpression, ok := expr.(*ast.BinaryExpression)
+	if !ok {
+		return values
+	}
+	switch binaryExpression.Operator {
+	case token.AND:
+		self.collectEqualValues(binaryExpression.Left, values)
+		self.collectEqualValues(binaryExpression.Right, values)
+	case token.ASSIGN, token.EQUAL:
+		column, constant := binaryExpression.Left, binaryExpression.Right
+		if _, ok := constant.(*ast.ColumnName); ok {
+			column, constant = constant, column
+		}
+		if _, ok := column.(*ast.ColumnName); !ok {
+			return values
+		}
+		switch constant.(type) {
+		case *ast.StringLiteral, *ast.NumberLiteral:
+			values[expressionName(column)] = self.evalExpression(constant)
+		}
+	}
+	return values
+}
+
+// 索引按值自身的类型比较, 只有常量与字段是同一类的值时查找结果与WHERE比较一致
+func isIndexValue(field *meta.Field, value meta.Value) bool {
+	switch {
+	case isIntegerField(field):
+		return isIntegerValue(value)
+	case isStringField(field):
+		return value.GetType() == meta.StringValueType
+	default:
+		return false
+	}
+}
+
+// 一致性读的读视图: 在事务中按事务的隔离级别获取, 否则使用语句的读视图, 读未提交时为nil
+func (self *Executor) getReadView(table *meta.Table) *transaction.ReadView {
+	if trx := self.getTrx(); trx != nil {
+		return trx.GetReadView()
+	}
+	if self.isolationLevel == 0 {
+		self.isolationLevel = self.takeIsolationLevel()
+	}
+	if self.readView == nil && self.isolationLevel != transaction.READ_UNCOMMITTED {
+		self.readView = self.ctx.GetStore().CreateReadView()
+	}
+	return self.readView
+}
+
+// 语句结束时释放语句的读视图, 读已提交的事务同样释放
+func (self *Executor) closeReadView() {
+	if self.readView != nil {
+		self.ctx.GetStore().CloseReadView(self.readView)
+		self.readView = nil
+	}
+	if trx := self.ctx.GetSession().GetTrx(); trx != nil {
+		trx.EndStatement()
+	}
+}
+
+/*
+构建查询算子:
+FROM -> WHERE -> GROUP BY/聚合 -> ORDER BY -> LIMIT -> 投影
+*/
+func (self *Executor) buildSelectOperator(stmt *ast.SelectStatement) Operator {
+	operator := self.buildWhereOperator(self.buildFromOperator(stmt.From, stmt.Where), stmt.Where)
+	var aggregateCalls []*ast.CallExpression
+	for _, field := range stmt.Fields {
+		aggregateCalls = collectAggregateCalls(field.Expr, aggregateCalls)
+	}
+	var having ast.Expression
+	if stmt.Having != nil {
+		having = resolveAliases(operator.GetColumns(), stmt.Fields, stmt.Having.Expr)
+		aggregateCalls = collectAggregateCalls(having, aggregateCalls)
+	}
+	if stmt.GroupBy != nil || len(aggregateCalls) > 0 {
+		operator = self.buildAggregateOperator(operator, stmt.GroupBy, aggregateCalls)
+	}
+	if having != nil {
+		operator = NewFilterOperator(operator, self.compilePredicate(operator.GetColumns(), having))
+	}
+	if stmt.Order != nil {
+		operator = NewSortOperator(operator, self.compileOrderBy(operator.GetColumns(), stmt.Fields, stmt.Order))
+	}
+	if stmt.Limit != nil {
+		operator = self.buildLimitOperator(operator, stmt.Limit)
+	}
+	return self.buildProjectOperator(operator, stmt.Fields)
+}
+
+func (self *Executor) buildFromOperator(from ast.ResultSet, where ast.Expression) Operator {
+	switch from := from.(type) {
+	case nil:
+		//没有FROM子句时, 对一行空数据求值
+		return NewValuesOperator(nil, [][]meta.Value{{}})
+	case *ast.TableSource:
+		table := self.getTable(from.TableName)
+		return NewTableScanOperator(table, self.getTableScan(table, where))
+	case *ast.SubqueryExpression:
+		return self.buildSelectOperator(from.Select)
+	default:
+		panic(fmt.Errorf("unsupported result set type: %T", from))
+	}
+}
+
+// WHERE条件过滤, SELECT/UPDATE/DELETE共用
+func (self *Executor) buildWhereOperator(child Operator, where ast.Expression) Operator {
+	if where == nil {
+		return child
+	}
+	return NewFilterOperator(child, self.compilePredicate(child.GetColumns(), where))
+}
+
+func (self *Executor) buildAggregateOperator(
+	child Operator, groupByClause *ast.GroupByClause, aggregateCalls []*ast.CallExpression,
+) Operator {
+	childColumns := child.GetColumns()
+	var columns []meta.Value
+	var groupBy []RowEvaluator
+	if groupByClause != nil {
+		for _, item := range groupByClause.Items {
+			columns = append(columns, meta.StringValue(expressionName(item)))
+			groupBy = append(groupBy, self.compileExpression(childColumns, item))
+		}
+	}
+	var functions []*AggregateFunction
+	for _, call := range aggregateCalls {
+		name := expressionName(call)
+		//相同的聚合函数只计算一次
+		if findColumn(columns, name) >= 0 {
+			continue
+		}
+		if len(call.Arguments) != 1 {
+			panic(fmt.Errorf("incorrect parameter count in the call to: %s", name))
+		}
+		function := &AggregateFunction{
+			Name: calleeName(call),
+		}
+		if argument, ok := call.Arguments[0].(*ast.Identifier); !ok || argument.Name != "*" {
+			function.Argument = self.compileExpression(childColumns, call.Arguments[0])
+		}
+		columns = append(columns, meta.StringValue(name))
+		functions = append(functions, function)
+	}
+	return NewAggregateOperator(child, columns, groupBy, functions)
+}
+
+// 排序字段可以是下层算子的列, 也可以是查询字段的别名
+func (self *Executor) compileOrderBy(columns []meta.Value, fields []*ast.SelectField, order *ast.OrderByClause) RowComparator {
+	evaluators := make([]RowEvaluator, len(order.Items))
+	for i, item := range order.Items {
+		evaluators[i] = self.compileExpression(columns, resolveAliases(columns, fields, item.ColumnName))
+	}
+	return func(a []meta.Value, b []meta.Value) int {
+		for i, item := range order.Items {
+			comp := compareValues(evaluators[i](a), evaluators[i](b))
+			if comp == 0 {
+				continue
+			}
+			if item.Desc {
+				return -comp
+			}
+			return comp
+		}
+		return 0
+	}
+}
+
+func (self *Executor) buildLimitOperator(child Operator, limit *ast.Limit) Operator {
+	offset := 0
+	if limit.Offset != nil {
+		offset = self.evalExpression(limit.Offset).ToInt()
+	}
+	count := self.evalExpression(limit.Count).ToInt()
+	return NewLimitOperator(child, offset, count)
+}
+
+func (self *Executor) buildProjectOperator(child Operator, fields []*ast.SelectField) Operator {
+	childColumns := child.GetColumns()
+	var columns []meta.Value
+	var evaluators []RowEvaluator
+	for _, field := range fields {
+		if identifier, ok := field.Expr.(*ast.Identifier); ok && identifier.Name == "*" {
+			for i, column := range childColumns {
+				//隐藏的行ID不在*中返回
+				if column.ToString() == meta.ROW_ID_FIELD_NAME {
+					continue
+				}
+				index := i
+				columns = append(columns, column)
+				evaluators = append(evaluators, func(row []meta.Value) meta.Value {
+					return row[index]
+				})
+			}
+			continue
+		}
+		name := expressionName(field.Expr)
+		if field.AsName != nil {
+			name = expressionName(field.AsName)
+		}
+		columns = append(columns, meta.StringValue(name))
+		evaluators = append(evaluators, self.compileExpression(childColumns, field.Expr))
+	}
+	return NewProjectOperator(child, columns, evaluators)
+}
@@ -0,0 +1,150 @@
+package executor
+
+import (
+	"Relatdb/common"
+	"Relatdb/meta"
+	"Relatdb/parser/ast"
+	"Relatdb/transaction"
+	"fmt"
+)
+
+/*
+XA事务:
+XA START开始事务并绑定到会话, XA END之后不能再执行语句, XA PREPARE写入准备记录后事务与会话分离
+已经准备的事务在重启后仍然保留, 任意会话都可以按xid提交或回滚
+*/
+func (self *Executor) executeXaStatement(stmt *ast.XaStatement) RecordSet {
+	switch stmt.Type {
+	case ast.XaStart:
+		self.executeXaStart(stmt)
+	case ast.XaEnd:
+		self.findSessionXaTrx(stmt, transaction.XA_ACTIVE).EndXa()
+	case ast.XaPrepare:
+		self.executeXaPrepare(stmt)
+	case ast.XaCommit:
+		self.executeXaCommit(stmt)
+	case ast.XaRollback:
+		self.executeXaRollback(stmt)
+	case ast.XaRecover:
+		return self.executeXaRecover()
+	}
+	return NewRecordSet(0, 0, nil)
+}
+
+// gtrid和bqual区分大小写, 使用字符串原来的内容
+func (self *Executor) getXid(stmt *ast.XaStatement) transaction.Xid {
+	xid := transaction.Xid{FormatId: 1, Gtrid: stmt.Gtrid.Text}
+	if stmt.Bqual != nil {
+		xid.Bqual = stmt.Bqual.Text
+	}
+	if stmt.FormatId != nil {
+		xid.FormatId = self.evalExpression(stmt.FormatId).ToInt64()
+	}
+	return xid
+}
+
+func (self *Executor) executeXaStart(stmt *ast.XaStatement) {
+	session := self.ctx.GetSession()
+	if trx := session.GetTrx(); trx != nil {
+		if trx.GetXid() != nil {
+			panic(newXaRmFailError(trx.GetXaState()))
+		}
+		panic(common.NewSQLError(common.ER_XAER_OUTSIDE, "XAE09", "XAER_OUTSIDE: Some work is done outside global transaction"))
+	}
+	trx := self.beginTrx()
+	if !trx.StartXa(self.getXid(stmt)) {
+		trx.Rollback(self.ctx.GetStore())
+		panic(common.NewSQLError(common.ER_XAER_DUPID, "XAE08", "XAER_DUPID: The XID already exists"))
+	}
+	session.SetTrx(trx)
+}
+
+// 会话中xid相同的XA事务, 事务不在要求的状态时不能执行
+func (self *Executor) findSessionXaTrx(stmt *ast.XaStatement, state transaction.XaState) *transaction.Trx {
+	trx := self.ctx.GetSession().GetTrx()
+	if trx == nil || trx.GetXid() == nil || *trx.GetXid() != self.getXid(stmt) {
+		panic(newXaNotExistsError())
+	}
+	if trx.GetXaState() != state {
+		panic(newXaRmFailError(trx.GetXaState()))
+	}
+	return trx
+}
+
+func (self *Executor) executeXaPrepare(stmt *ast.XaStatement) {
+	trx := self.findSessionXaTrx(stmt, transaction.XA_IDLE)
+	self.ctx.GetSession().SetTrx(nil)
+	trx.Prepare()
+}
+
+// 会话中的事务只能一阶段提交, 否则提交已经准备的事务
+func (self *Executor) executeXaCommit(stmt *ast.XaStatement) {
+	session := self.ctx.GetSession()
+	if trx := session.GetTrx(); trx != nil && trx.GetXid() != nil {
+		if !stmt.OnePhase {
+			panic(newXaRmFailError(trx.GetXaState()))
+		}
+		trx = self.findSessionXaTrx(stmt, transaction.XA_IDLE)
+		session.SetTrx(nil)
+		trx.Commit()
+		return
+	}
+	self.takePreparedTrx(stmt).Commit()
+}
+
+func (self *Executor) executeXaRollback(stmt *ast.XaStatement) {
+	session := self.ctx.GetSession()
+	if trx := session.GetTrx(); trx != nil && trx.GetXid() != nil {
+		trx = self.findSessionXaTrx(stmt, transaction.XA_IDLE)
+		session.SetTrx(nil)
+		trx.Rollback(self.ctx.GetStore())
+		return
+	}
+	self.takePreparedTrx(stmt).Rollback(self.ctx.GetStore())
+}
+
+// 会话中有普通事务时不能结束其他的XA事务
+func (self *Executor) takePreparedTrx(stmt *ast.XaStatement) *transaction.Trx {
+	if self.ctx.GetSession().GetTrx() != nil {
+		panic(common.NewSQLError(common.ER_XAER_OUTSIDE, "XAE09", "XAER_OUTSIDE: Some work is done outside global transaction"))
+	}
+	trx := self.ctx.GetStore().TakePreparedTrx(self.getXid(stmt))
+	if trx == nil {
+		panic(newXaNotExistsError())
+	}
+	return trx
+}
+
+// 列出已经准备的事务, data为gtrid和bqual拼接的结果
+func (self *Executor) executeXaRecover() RecordSet {
+	columns := []meta.Value{
+		meta.StringValue("formatID"), meta.StringValue("gtrid_length"),
+		meta.StringValue("bqual_length"), meta.StringValue("data"),
+	}
+	var rows [][]meta.Value
+	for _, xid := range self.ctx.GetStore().GetPreparedXids() {
+		rows = append(rows, []meta.Value{
+			meta.Int64Value(xid.FormatId), meta.Int64Value(len(xid.Gtrid)),
+			meta.Int64Value(len(xid.Bqual)), meta.StringValue(xid.Gtrid + xid.Bqual),
+		})
+	}
+	return NewRecordSet(0, 0, NewValuesOperator(columns, rows))
+}
+
+// 会话中的XA事务只能由XA语句结束
+func checkNotXaTrx(trx *transaction.Trx) {
+	if trx != nil && trx.GetXid() != nil {
+		panic(newXaRmFailError(trx.GetXaState()))
+	}
+}
+
+func newXaNotExistsError() error {
+	return common.NewSQLError(common.ER_XAER_NOTA, "XAE04", "XAER_NOTA: Unknown XID")
+}
+
+func newXaRmFailError(state transaction.XaState) error {
+	return common.NewSQLError(
+		common.ER_XAER_RMFAIL, "XAE07",
+		fmt.Sprintf("XAER_RMFAIL: The command cannot be executed when global transaction is in the %s state", state),
+	)
+}
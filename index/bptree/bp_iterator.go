@@ -0,0 +1,66 @@
+package bptree
+
+import "Relatdb/meta"
+
+// 沿叶子节点链表遍历, 正向沿Next, 反向沿Prev, 超出结束边界时停止
+type BPIterator struct {
+	node     *BPNode
+	position int
+	end      *meta.IndexBound //正向时为上界, 反向时为下界, 为nil时遍历到链表末尾
+	reverse  bool
+}
+
+func NewBPIterator(head *BPNode) *BPIterator {
+	return newBPIterator(head, 0, nil, false)
+}
+
+func newBPIterator(node *BPNode, position int, end *meta.IndexBound, reverse bool) *BPIterator {
+	iterator := &BPIterator{
+		node:     node,
+		position: position,
+		end:      end,
+		reverse:  reverse,
+	}
+	iterator.skipEmptyNode()
+	return iterator
+}
+
+// 跳过没有Entries的叶子节点, 当前的Entry超出结束边界时结束
+func (self *BPIterator) skipEmptyNode() {
+	for self.node != nil && (self.position < 0 || self.position >= len(self.node.Entries)) {
+		if self.reverse {
+			self.node = self.node.OwnerTree.scanNode(self.node.Prev)
+			if self.node != nil {
+				self.position = len(self.node.Entries) - 1
+			}
+		} else {
+			self.node = self.node.OwnerTree.scanNode(self.node.Next)
+			self.position = 0
+		}
+	}
+	if self.node == nil {
+		return
+	}
+	entry := self.node.Entries[self.position]
+	if (self.reverse && self.end.IsBelow(entry)) || (!self.reverse && self.end.IsAbove(entry)) {
+		self.node = nil
+	}
+}
+
+func (self *BPIterator) HasNext() bool {
+	return self.node != nil
+}
+
+func (self *BPIterator) Next() meta.IndexEntry {
+	if !self.HasNext() {
+		return nil
+	}
+	entry := self.node.Entries[self.position]
+	if self.reverse {
+		self.position--
+	} else {
+		self.position++
+	}
+	self.skipEmptyNode()
+	return entry
+}
@@ -7,16 +7,21 @@ import (
 	"slices"
 )
 
+/*
+节点之间通过页号引用, 0表示没有(第0页为树的头页)
+引用的节点通过OwnerTree.getNode按需从存储文件加载
+*/
 type BPNode struct {
 	OwnerTree *BPTree           //所属树
 	IsRoot    bool              //是否是根节点
 	isLeaf    bool              //是否是叶子节点
-	Parent    *BPNode           //父节点
-	Prev      *BPNode           //上一个叶子节点
-	Next      *BPNode           //下一个叶子节点
+	Parent    uint              //父节点页号
+	Prev      uint              //上一个叶子节点页号
+	Next      uint              //下一个叶子节点页号
 	Entries   []meta.IndexEntry //关键字
-	Children  []*BPNode         //子节点
+	Children  []uint            //子节点页号
 	Page      *BPPage           //页
+	dirty     bool              //是否需要写回存储文件
 }
 
 func NewBPNode(ownerTree *BPTree, isRoot bool, isLeaf bool) *BPNode {
@@ -27,18 +32,78 @@ func NewBPNode(ownerTree *BPTree, isRoot bool, isLeaf bool) *BPNode {
 		Entries:   []meta.IndexEntry{},
 	}
 	if !isLeaf {
-		bpNode.Children = []*BPNode{}
+		bpNode.Children = []uint{}
 	}
-	bpNode.Page = NewBPPage(bpNode)
+	bpNode.Page = NewBPPage(bpNode, ownerTree.allocatePageNo())
+	ownerTree.putNode(bpNode)
+	bpNode.markDirty()
 	return bpNode
 }
 
+func (self *BPNode) getPageNo() uint {
+	return self.Page.PageNo
+}
+
+// 标记为脏节点, 操作结束时写回存储文件
+func (self *BPNode) markDirty() {
+	if self.dirty {
+		return
+	}
+	self.dirty = true
+	self.OwnerTree.dirtyNodes = append(self.OwnerTree.dirtyNodes, self)
+}
+
+func getNodePageNo(node *BPNode) uint {
+	if node == nil {
+		return 0
+	}
+	return node.getPageNo()
+}
+
+func (self *BPNode) getParent() *BPNode {
+	return self.OwnerTree.getNode(self.Parent)
+}
+
+func (self *BPNode) getPrev() *BPNode {
+	return self.OwnerTree.getNode(self.Prev)
+}
+
+func (self *BPNode) getNext() *BPNode {
+	return self.OwnerTree.getNode(self.Next)
+}
+
+func (self *BPNode) getChild(index int) *BPNode {
+	return self.OwnerTree.getNode(self.Children[index])
+}
+
+func (self *BPNode) setRoot(isRoot bool) {
+	self.IsRoot = isRoot
+	self.markDirty()
+}
+
+func (self *BPNode) setParent(parent *BPNode) {
+	self.Parent = getNodePageNo(parent)
+	self.markDirty()
+}
+
+func (self *BPNode) setPrev(prev *BPNode) {
+	self.Prev = getNodePageNo(prev)
+	self.markDirty()
+}
+
+func (self *BPNode) setNext(next *BPNode) {
+	self.Next = getNodePageNo(next)
+	self.markDirty()
+}
+
 func (self *BPNode) addEntries(key ...meta.IndexEntry) {
 	self.Entries = append(self.Entries, key...)
+	self.markDirty()
 }
 
 func (self *BPNode) addEntriesByIndex(index int, key ...meta.IndexEntry) {
 	self.Entries = slices.Insert(self.Entries, index, key...)
+	self.markDirty()
 }
 
 func (self *BPNode) findDeleteEntriesIndex(key meta.IndexEntry) int {
@@ -52,28 +117,37 @@ func (self *BPNode) findDeleteEntriesIndex(key meta.IndexEntry) int {
 
 func (self *BPNode) removeEntriesByIndex(index int) meta.IndexEntry {
 	key := self.Entries[index]
-	self.Entries = slices.Delete(self.Entries, index, index)
+	self.Entries = slices.Delete(self.Entries, index, index+1)
+	self.markDirty()
 	return key
 }
 
 func (self *BPNode) setEntriesByIndex(index int, key meta.IndexEntry) {
 	self.Entries[index] = key
+	self.markDirty()
 }
 
+// 添加子节点, 同时更新子节点的父节点
 func (self *BPNode) addChildren(node ...*BPNode) {
-	self.Children = append(self.Children, node...)
+	self.addChildrenByIndex(len(self.Children), node...)
 }
 
 func (self *BPNode) addChildrenByIndex(index int, node ...*BPNode) {
-	self.Children = slices.Insert(self.Children, index, node...)
+	pageNos := make([]uint, len(node))
+	for i, child := range node {
+		child.setParent(self)
+		pageNos[i] = child.getPageNo()
+	}
+	self.Children = slices.Insert(self.Children, index, pageNos...)
+	self.markDirty()
 }
 
 func (self *BPNode) findChildrenIndex(node *BPNode) int {
-	return slices.Index(self.Children, node)
+	return slices.Index(self.Children, node.getPageNo())
 }
 
 func (self *BPNode) removeChildren(node *BPNode) int {
-	index := self.Parent.findChildrenIndex(node)
+	index := self.findChildrenIndex(node)
 	if index < 0 {
 		return -1
 	}
@@ -82,8 +156,9 @@ func (self *BPNode) removeChildren(node *BPNode) int {
 }
 
 func (self *BPNode) removeChildrenByIndex(index int) *BPNode {
-	child := self.Children[index]
-	self.Children = slices.Delete(self.Children, int(index), int(index))
+	child := self.getChild(index)
+	self.Children = slices.Delete(self.Children, index, index+1)
+	self.markDirty()
 	return child
 }
 
@@ -111,16 +186,12 @@ func (self *BPNode) isLeafSplit(key meta.IndexEntry) bool {
 
 // 内部节点是否需要分裂
 func (self *BPNode) isInternalSplit() bool {
-	return self.Page.remainFreeSpace() < 0
+	return self.Page.getContentSize() > self.Page.getInitFreeSpace()
 }
 
 // 内部节点插入
 func (self *BPNode) internalInsert(key meta.IndexEntry) {
 	insertIndex := len(self.Entries)
-	if insertIndex == 0 {
-		self.Entries = append(self.Entries, key)
-		return
-	}
 	//插入在大于等于的Entries前面
 	for i, entry := range self.Entries {
 		if key.CompareEntry(entry) == 0 || key.CompareEntry(entry) < 0 {
@@ -133,46 +204,37 @@ func (self *BPNode) internalInsert(key meta.IndexEntry) {
 
 // 回收
 func (self *BPNode) recycle() {
+	self.OwnerTree.removeNode(self)
 	self.OwnerTree.RecyclePageNo(self.Page.PageNo)
 	self.OwnerTree = nil
-	self.Parent = nil
-	self.Prev = nil
-	self.Next = nil
 	self.Entries = nil
 	self.Children = nil
 	self.Page = nil
 }
 
-func (self *BPNode) handlingParent(bpTree *BPTree, left *BPNode, right *BPNode) {
+func (self *BPNode) handlingParent(bpTree *BPTree, left *BPNode, right *BPNode, middleKey meta.IndexEntry) {
 	//根节点
 	if self.IsRoot {
-		self.IsRoot = false
 		//创建新的根节点
 		root := NewBPNode(self.OwnerTree, true, false)
 		//更新节点指向
-		bpTree.Root = root
-		left.Parent = root
-		right.Parent = root
-		//将left和right叶子节点添加到root
-		root.addChildren(left)
-		root.addChildren(right)
-		//将当前节点中间的key添加到root
-		root.internalInsert(right.Entries[0].GetCompareEntry())
+		bpTree.setRoot(root)
+		//将left和right节点添加到root
+		root.addChildren(left, right)
+		//将中间的key添加到root
+		root.addEntries(middleKey)
 		//root节点进行分裂
 		root.internalSplit(bpTree)
 	} else {
-		//删除当前叶子节点并返回在父节点的下标位置
-		index := self.Parent.removeChildren(self)
-		//更新父节点指向
-		left.Parent = self.Parent
-		right.Parent = self.Parent
-		//将left和right叶子节点添加到父节点
-		self.Parent.addChildrenByIndex(index, left)
-		self.Parent.addChildrenByIndex(index+1, right)
-		//将当前节点中间的key添加到父节点
-		self.Parent.internalInsert(right.Entries[0].GetCompareEntry())
+		parent := self.getParent()
+		//删除当前节点并返回在父节点的下标位置
+		index := parent.removeChildren(self)
+		//将left和right节点添加到父节点
+		parent.addChildrenByIndex(index, left, right)
+		//将中间的key添加到父节点
+		parent.addEntriesByIndex(index, middleKey)
 		//父节点进行分裂
-		self.Parent.internalSplit(bpTree)
+		parent.internalSplit(bpTree)
 	}
 	//回收
 	self.recycle()
@@ -186,27 +248,21 @@ func (self *BPNode) internalSplit(bpTree *BPTree) {
 	left := NewBPNode(self.OwnerTree, false, false)
 	right := NewBPNode(self.OwnerTree, false, false)
 
-	leftSize := len(self.Entries) / 2
-	rightSize := len(self.Entries) - leftSize
+	//中间的key上提到父节点, 不保留在left和right中
+	middleIndex := len(self.Entries) / 2
+	middleKey := self.Entries[middleIndex]
 	//将当前节点的key复制到新的left和right节点
-	for i := range leftSize {
-		left.Entries = append(left.Entries, self.Entries[i])
-	}
-	for i := range rightSize {
-		right.Entries = append(right.Entries, self.Entries[leftSize+i])
-	}
+	left.addEntries(self.Entries[:middleIndex]...)
+	right.addEntries(self.Entries[middleIndex+1:]...)
 	//将当前节点的children复制到新的left和right节点
-	for i := range leftSize {
-		children := self.Children[i]
-		children.Parent = left
-		left.addChildren(children)
-	}
-	for i := range rightSize {
-		children := self.Children[leftSize+i]
-		children.Parent = right
-		right.addChildren(children)
+	for i := range self.Children {
+		if i <= middleIndex {
+			left.addChildren(self.getChild(i))
+		} else {
+			right.addChildren(self.getChild(i))
+		}
 	}
-	self.handlingParent(bpTree, left, right)
+	self.handlingParent(bpTree, left, right, middleKey)
 }
 
 func (self *BPNode) internalRemove(key meta.IndexEntry) bool {
@@ -218,384 +274,301 @@ func (self *BPNode) internalRemove(key meta.IndexEntry) bool {
 	return true
 }
 
-// 是否是平衡的叶子节点
-func (self *BPNode) isBalancedLeaf(key meta.IndexEntry) bool {
-	return self.Page.getContentSize()-store.GetItemLength(key) > self.Page.getInitFreeSpace()/2
+// 内容是否少于一半, 需要借用或合并
+func (self *BPNode) isUnderflow() bool {
+	return len(self.Entries) == 0 || self.Page.getContentSize() < self.Page.getInitFreeSpace()/2
 }
 
-// 上一个叶子节点是否可借用
-func (self *BPNode) prevLeafCanBorrow() bool {
-	if self.Prev == nil || len(self.Prev.Entries) < 2 || self.Prev.Parent != self.Parent {
-		return false
-	}
-	return self.isBalancedLeaf(self.Prev.Entries[len(self.Prev.Entries)-1]) ||
-		len(self.Entries) == 1 && len(self.Prev.Entries) >= 2
+// 借出key之后内容是否仍然不少于一半
+func (self *BPNode) canLend(key meta.IndexEntry) bool {
+	return len(self.Entries) >= 2 &&
+		self.Page.getContentSize()-self.getBorrowKeyLength(key) >= self.Page.getInitFreeSpace()/2
 }
 
-// 下一个叶子节点是否可借用
-func (self *BPNode) nextLeafCanBorrow() bool {
-	if self.Next == nil || len(self.Next.Entries) < 2 || self.Next.Parent != self.Parent {
-		return false
+// 是否可以容纳合并的节点, 内部节点合并时还需要容纳父节点下放的key
+func (self *BPNode) canMerge(node *BPNode, downKey meta.IndexEntry) bool {
+	size := node.Page.getContentSize()
+	if downKey != nil {
+		size += store.GetItemLength(downKey)
 	}
-	return self.isBalancedLeaf(self.Next.Entries[len(self.Next.Entries)-1]) ||
-		len(self.Entries) == 1 && len(self.Next.Entries) >= 2
+	return self.Page.getContentSize()+size <= self.Page.getInitFreeSpace()
 }
 
-// 叶子节点是否可合并
-func (self *BPNode) leafCanMerge(leaf *BPNode) bool {
-	return leaf != nil && leaf.Parent == self.Parent &&
-		leaf.Page.getContentSize() < leaf.Page.getInitFreeSpace()/2 &&
-		leaf.Page.getContentSize() <= self.Page.remainFreeSpace()
+// 获取同一父节点下的兄弟节点
+func (self *BPNode) getSibling(parent *BPNode, selfIndex int) (prev *BPNode, next *BPNode) {
+	if selfIndex > 0 {
+		prev = parent.getChild(selfIndex - 1)
+	}
+	if selfIndex+1 < len(parent.Children) {
+		next = parent.getChild(selfIndex + 1)
+	}
+	return prev, next
 }
 
-// 合并Prev节点
-func (self *BPNode) mergePrevNode(prev *BPNode) {
-	if !prev.isLeaf {
-		index := self.Parent.findChildrenIndex(self)
-		self.addEntriesByIndex(0, self.Parent.Entries[index])
-		for _, child := range prev.Children {
-			child.Parent = self
-		}
-		self.addChildrenByIndex(0, prev.Children...)
+// 从叶子链表中移除
+func (self *BPNode) unlinkLeaf(bpTree *BPTree) {
+	prev, next := self.getPrev(), self.getNext()
+	if prev != nil {
+		prev.setNext(next)
+	} else {
+		bpTree.setHead(next)
+	}
+	if next != nil {
+		next.setPrev(prev)
 	}
-	self.addEntriesByIndex(0, prev.Entries...)
 }
 
-// 合并Next节点
-func (self *BPNode) mergeNextNode(next *BPNode) {
+// 合并Next节点, 内部节点需要下放父节点中两者之间的key
+func (self *BPNode) mergeNextNode(next *BPNode, downKey meta.IndexEntry) {
 	if !next.isLeaf {
-		index := self.Parent.findChildrenIndex(next)
-		self.addEntries(next.Parent.Entries[index])
-	}
-	self.addEntries(next.Entries...)
-	if len(next.Children) != 0 {
-		for _, child := range next.Children {
-			child.Parent = self
+		self.addEntries(downKey)
+		for i := range next.Children {
+			self.addChildren(next.getChild(i))
 		}
-		self.addChildren(next.Children...)
 	}
+	self.addEntries(next.Entries...)
 }
 
-// 上一个内部节点是否可借用
-func (self *BPNode) prevInternalCanBorrow(prev *BPNode) bool {
-	return prev != nil && len(prev.Entries) >= 2 &&
-		self.internalCanBorrow(prev, prev.Entries[len(prev.Entries)-1])
-}
-
-// 下一个内部节点是否可借用
-func (self *BPNode) nextInternalCanBorrow(next *BPNode) bool {
-	return next != nil && len(next.Entries) >= 2 &&
-		self.internalCanBorrow(next, next.Entries[0])
+/*
+叶子节点删除后的平衡: 优先从兄弟节点借用, 否则与兄弟节点合并
+子节点i(i>0)在父节点中对应的key为Entries[i-1]
+*/
+func (self *BPNode) leafRebalance(bpTree *BPTree) {
+	if !self.isUnderflow() {
+		return
+	}
+	parent := self.getParent()
+	selfIndex := parent.findChildrenIndex(self)
+	prev, next := self.getSibling(parent, selfIndex)
+	//上一个叶子节点是否可借用
+	if prev != nil && prev.canLend(prev.Entries[len(prev.Entries)-1]) {
+		//借用Prev最后一个key添加到当前Entries最前面
+		key := prev.removeEntriesByIndex(len(prev.Entries) - 1)
+		self.addEntriesByIndex(0, key)
+		parent.setEntriesByIndex(selfIndex-1, key.GetCompareEntry())
+		return
+	}
+	//下一个叶子节点是否可借用
+	if next != nil && next.canLend(next.Entries[0]) {
+		//借用Next第一个key添加到当前Entries最后面
+		key := next.removeEntriesByIndex(0)
+		self.addEntries(key)
+		parent.setEntriesByIndex(selfIndex, next.Entries[0].GetCompareEntry())
+		return
+	}
+	//合并到Prev节点
+	if prev != nil && prev.canMerge(self, nil) {
+		prev.mergeNextNode(self, nil)
+		parent.removeEntriesByIndex(selfIndex - 1)
+		parent.removeChildrenByIndex(selfIndex)
+		self.unlinkLeaf(bpTree)
+		self.recycle()
+		parent.internalRebalance(bpTree)
+		return
+	}
+	//合并Next节点
+	if next != nil && self.canMerge(next, nil) {
+		self.mergeNextNode(next, nil)
+		parent.removeEntriesByIndex(selfIndex)
+		parent.removeChildrenByIndex(selfIndex + 1)
+		next.unlinkLeaf(bpTree)
+		next.recycle()
+		parent.internalRebalance(bpTree)
+	}
 }
 
-// 内部节点是否可借用
-func (self *BPNode) internalCanBorrow(node *BPNode, key meta.IndexEntry) bool {
-	if node == nil {
-		return false
+// 内部节点删除key后的平衡
+func (self *BPNode) internalRebalance(bpTree *BPTree) {
+	if self.IsRoot {
+		//根节点只剩一个子节点时, 子节点成为根节点
+		if len(self.Children) == 1 {
+			child := self.getChild(0)
+			child.setRoot(true)
+			child.setParent(nil)
+			bpTree.setRoot(child)
+			self.recycle()
+		}
+		return
+	}
+	if !self.isUnderflow() {
+		return
+	}
+	parent := self.getParent()
+	selfIndex := parent.findChildrenIndex(self)
+	prev, next := self.getSibling(parent, selfIndex)
+	//上一个内部节点是否可借用
+	if prev != nil && prev.canLend(prev.Entries[len(prev.Entries)-1]) {
+		//下放父节点key, Prev最后一个key上提
+		self.addEntriesByIndex(0, parent.Entries[selfIndex-1])
+		parent.setEntriesByIndex(selfIndex-1, prev.removeEntriesByIndex(len(prev.Entries)-1))
+		//子节点也借用
+		self.addChildrenByIndex(0, prev.removeChildrenByIndex(len(prev.Children)-1))
+		return
 	}
-	if len(self.Entries) == 0 && len(node.Entries) >= 2 {
-		return true
+	//下一个内部节点是否可借用
+	if next != nil && next.canLend(next.Entries[0]) {
+		//下放父节点key, Next第一个key上提
+		self.addEntries(parent.Entries[selfIndex])
+		parent.setEntriesByIndex(selfIndex, next.removeEntriesByIndex(0))
+		//子节点也借用
+		self.addChildren(next.removeChildrenByIndex(0))
+		return
+	}
+	//合并到Prev节点
+	if prev != nil && prev.canMerge(self, parent.Entries[selfIndex-1]) {
+		prev.mergeNextNode(self, parent.Entries[selfIndex-1])
+		parent.removeEntriesByIndex(selfIndex - 1)
+		parent.removeChildrenByIndex(selfIndex)
+		self.recycle()
+		parent.internalRebalance(bpTree)
+		return
+	}
+	//合并Next节点
+	if next != nil && self.canMerge(next, parent.Entries[selfIndex]) {
+		self.mergeNextNode(next, parent.Entries[selfIndex])
+		parent.removeEntriesByIndex(selfIndex)
+		parent.removeChildrenByIndex(selfIndex + 1)
+		next.recycle()
+		parent.internalRebalance(bpTree)
 	}
-	borrowKeyLength := self.getBorrowKeyLength(key)
-	return node.Parent == self.Parent && len(node.Entries) >= 2 &&
-		node.Page.getContentSize()-borrowKeyLength > node.Page.getInitFreeSpace()/2 &&
-		borrowKeyLength <= self.Page.remainFreeSpace()
 }
 
-func (self *BPNode) prevCanMerge(prev *BPNode) bool {
-	if prev == nil {
-		return false
-	}
-	if prev.Parent == self.Parent {
-		adjustSize := uint(0)
-		if !prev.isLeaf {
-			selfIndex := self.Parent.findChildrenIndex(self)
-			downKey := self.Parent.Entries[selfIndex]
-			adjustSize = store.GetItemLength(downKey)
+// 查找key所在的子节点下标, 等于Entries[i]的key在子节点i+1中
+func (self *BPNode) findChildIndex(key meta.IndexEntry) int {
+	for i, entry := range self.Entries {
+		if key.CompareEntry(entry) < 0 {
+			return i
 		}
-		return prev.Page.getContentSize()+adjustSize <= self.Page.remainFreeSpace()
 	}
-	return false
+	return len(self.Children) - 1
 }
 
-func (self *BPNode) nextCanMerge(next *BPNode) bool {
-	if next == nil {
-		return false
+/*
+定位: COMPARE_EQUAL为第一个等于key的Entry, COMPARE_LOW为第一个大于等于key的Entry, COMPARE_UP为最后一个小于等于key的Entry
+key的字段少于索引的字段时按前缀比较, 不存在时返回nil
+*/
+func (self *BPNode) Get(key meta.IndexEntry, compareType meta.CompareType) *BPPosition {
+	bound := meta.NewIndexBound(key, true)
+	var iterator *BPIterator
+	if compareType == meta.COMPARE_UP {
+		node, position := self.seekUp(bound)
+		iterator = newBPIterator(node, position, nil, true)
+	} else {
+		node, position := self.seekLow(bound)
+		iterator = newBPIterator(node, position, nil, false)
 	}
-	if next.Parent == self.Parent {
-		adjustSize := uint(0)
-		if !next.isLeaf {
-			nextIndex := self.Parent.findChildrenIndex(next)
-			downKey := self.Parent.Entries[nextIndex]
-			adjustSize = store.GetItemLength(downKey)
-		}
-		return next.Page.getContentSize()+adjustSize <= self.Page.remainFreeSpace()
+	if !iterator.HasNext() {
+		return nil
 	}
-	return false
+	if compareType == meta.COMPARE_EQUAL && meta.ComparePrefix(iterator.node.Entries[iterator.position], key) != 0 {
+		return nil
+	}
+	return NewBPPosition(nil, uint(iterator.position), iterator.node)
 }
 
-// 内部节点合并
-func (self *BPNode) internalMerge(bpTree *BPTree) {
-	if len(self.Children) < 2 || self.Page.getContentSize() < self.Page.getInitFreeSpace()/2 {
-		if self.IsRoot && len(self.Children) < 2 {
-			//与子节点合并，子节点成为根节点
-			child := self.Children[0]
-			bpTree.Root = child
-			self.recycle()
-		} else {
-			selfIndex := self.Parent.findChildrenIndex(self)
-			prevIndex := selfIndex - 1
-			nextIndex := selfIndex + 1
-			var prev, next *BPNode
-			if prevIndex >= 0 {
-				prev = self.Children[prevIndex]
-			}
-			if nextIndex < len(self.Children) {
-				next = self.Children[nextIndex]
-			}
-			defer self.Parent.internalMerge(bpTree)
-			// 上一个内部节点是否可借用
-			if self.prevInternalCanBorrow(prev) {
-				// 下放key
-				downKey := self.Parent.Entries[selfIndex]
-				self.addEntriesByIndex(0, downKey)
-				// Prev key上提
-				prevLastKeyIndex := len(prev.Entries) - 1
-				self.Parent.setEntriesByIndex(selfIndex, prev.Entries[prevLastKeyIndex])
-				prev.removeEntriesByIndex(prevLastKeyIndex)
-				// 子节点也借用
-				borrowChild := prev.removeChildrenByIndex(len(prev.Children) - 1)
-				borrowChild.Parent = self
-				self.addChildrenByIndex(0, borrowChild)
-				return
-			}
-			// 下一个内部节点是否可借用
-			if self.nextInternalCanBorrow(next) {
-				// 下放key
-				downKey := self.Parent.Entries[nextIndex]
-				self.addEntries(downKey)
-				// Next key上提
-				self.Parent.setEntriesByIndex(nextIndex, next.Entries[0])
-				next.removeEntriesByIndex(0)
-				// 子节点也借用
-				borrowChild := next.removeChildrenByIndex(0)
-				borrowChild.Parent = self
-				self.addChildren(borrowChild)
-				return
-			}
-			if self.prevCanMerge(prev) {
-				self.mergePrevNode(prev)
-				self.Parent.removeEntriesByIndex(selfIndex)
-				self.Parent.removeChildren(prev)
-				prev.recycle()
-				return
-			}
-			if self.nextCanMerge(next) {
-				self.mergeNextNode(next)
-				self.Parent.removeEntriesByIndex(nextIndex)
-				self.Parent.removeChildren(next)
-				next.recycle()
-				return
-			}
-		}
-		return
-	}
-	if self.Page.getContentSize() > self.Page.getInitFreeSpace() {
-		/*
-			因为在更新的时候,由于key值大小不定,可能导致虽然删除了关键字,但是由于
-			更新了新的长的key,导致比删除之前的size还要大,所以就有可能导致分裂
-			即changeKeySize - deleteKeySize > 0的某些情况下会导致分裂
-		*/
-		self.internalSplit(bpTree)
-		return
+/*
+查找不小于下界的第一个Entry所在的叶子节点和位置, 位置可能在节点末尾, 由遍历时移动到下一个节点
+内部节点中小于下界的key, 其右边子树中的Entry也可能小于下界, 左边子树中的Entry都小于下界
+*/
+func (self *BPNode) seekLow(low *meta.IndexBound) (*BPNode, int) {
+	node := self
+	for !node.isLeaf {
+		node = node.OwnerTree.scanNode(node.Children[countEntries(node.Entries, low.IsBelow)])
 	}
+	return node, countEntries(node.Entries, low.IsBelow)
 }
 
-// 获取
-func (self *BPNode) Get(key meta.IndexEntry, compareType meta.CompareType) *BPPosition {
-	//叶子节点
-	if self.isLeaf {
-		if compareType == meta.COMPARE_EQUAL {
-			//查找相等的Entries
-			for i, entry := range self.Entries {
-				if key.CompareEntry(entry) != 0 {
-					continue
-				}
-				return NewBPPosition(nil, uint(i), self)
-			}
-		} else if compareType == meta.COMPARE_LOW {
-			return NewBPPosition(nil, 0, self)
-		} else {
-			return NewBPPosition(nil, uint(len(self.Entries)-1), self)
-		}
+// 查找不大于上界的最后一个Entry所在的叶子节点和位置, 位置可能为-1, 由遍历时移动到上一个节点
+func (self *BPNode) seekUp(up *meta.IndexBound) (*BPNode, int) {
+	notAbove := func(entry meta.IndexEntry) bool {
+		return !up.IsAbove(entry)
 	}
-	//非叶子节点
-	if firstEntry := self.Entries[0]; key.CompareEntry(firstEntry) < 0 { //小于第一个Entries
-		return self.Children[0].Get(key, compareType)
-	} else if lastEntry := self.Entries[len(self.Entries)-1]; key.CompareEntry(lastEntry) >= 0 { //大于等于最后一个Entries
-		return self.Children[len(self.Children)-1].Get(key, compareType)
+	node := self
+	for !node.isLeaf {
+		node = node.OwnerTree.scanNode(node.Children[countEntries(node.Entries, notAbove)])
 	}
-	//查找大于等于的Entries
-	for i, entry := range self.Entries {
-		if key.CompareEntry(entry) != -1 {
-			continue
-		}
-		return self.Children[i].Get(key, compareType)
+	return node, countEntries(node.Entries, notAbove) - 1
+}
+
+// 从头开始连续满足条件的Entry数量
+func countEntries(entries []meta.IndexEntry, predicate func(entry meta.IndexEntry) bool) int {
+	count := 0
+	for count < len(entries) && predicate(entries[count]) {
+		count++
 	}
-	return nil
+	return count
 }
 
 // 插入
 func (self *BPNode) Insert(key meta.IndexEntry, bpTree *BPTree, isUnique bool) error {
 	if self.getBorrowKeyLength(key) > self.Page.getInitFreeSpace()/3 {
 		return errors.New("entry size must <= Max/3")
-	} else if isUnique && self.internalCheckExist(key) {
-		return errors.New("duplicated Key error")
-	}
-	//叶子节点
-	if self.isLeaf {
-		//叶子节点不用分裂直接插入key
-		if !self.isLeafSplit(key) {
-			self.internalInsert(key)
-			return nil
-		}
-		//叶子节点需要分裂，并将当前叶子节点分裂成两个新的叶子节点
-		left := NewBPNode(self.OwnerTree, false, true)  //左叶子节点
-		right := NewBPNode(self.OwnerTree, false, true) //右叶子节点
-		//将Prev和Next叶子节点指向新的left和right
-		if self.Prev != nil {
-			self.Prev.Next = left
-			left.Prev = self.Prev
-		} else {
-			bpTree.Head = left
-		}
-		if self.Next != nil {
-			self.Next.Prev = right
-			right.Next = self.Next
-		}
-		left.Next = right
-		right.Prev = left
-
-		//先插入key
+	}
+	//非叶子节点
+	if !self.isLeaf {
+		return self.getChild(self.findChildIndex(key)).Insert(key, bpTree, isUnique)
+	}
+	//内部节点的key可能是已删除的key, 只在叶子节点检查唯一性
+	if isUnique && self.internalCheckExist(key) {
+		return meta.ErrDuplicateKey
+	}
+	//叶子节点不用分裂直接插入key
+	if !self.isLeafSplit(key) {
 		self.internalInsert(key)
-		//将当前叶子节点的key复制到新的left和right节点
-		leftSize := len(self.Entries) / 2
-		rightSize := len(self.Entries) - leftSize
-		for i := range leftSize {
-			left.Entries = append(left.Entries, self.Entries[i])
-		}
-		for i := range rightSize {
-			right.Entries = append(right.Entries, self.Entries[leftSize+i])
-		}
-		self.handlingParent(bpTree, left, right)
 		return nil
 	}
-	//非叶子节点
-	if key.CompareEntry(self.Entries[0]) < 0 { //小于第一个Entries
-		return self.Children[0].Insert(key, bpTree, isUnique)
-	} else if key.CompareEntry(self.Entries[len(self.Entries)-1]) >= 0 { //大于等于最后一个Entries
-		return self.Children[len(self.Children)-1].Insert(key, bpTree, isUnique)
+	//叶子节点需要分裂，并将当前叶子节点分裂成两个新的叶子节点
+	left := NewBPNode(self.OwnerTree, false, true)  //左叶子节点
+	right := NewBPNode(self.OwnerTree, false, true) //右叶子节点
+	//将Prev和Next叶子节点指向新的left和right
+	if prev := self.getPrev(); prev != nil {
+		prev.setNext(left)
+		left.setPrev(prev)
+	} else {
+		bpTree.setHead(left)
 	}
-	//查找大于等于的Entries
-	for i, entry := range self.Entries {
-		if key.CompareEntry(entry) != -1 {
-			continue
-		}
-		return self.Children[i].Insert(key, bpTree, isUnique)
+	if next := self.getNext(); next != nil {
+		next.setPrev(right)
+		right.setNext(next)
 	}
+	left.setNext(right)
+	right.setPrev(left)
+
+	//先插入key
+	self.internalInsert(key)
+	//将当前叶子节点的key复制到新的left和right节点
+	leftSize := len(self.Entries) / 2
+	left.addEntries(self.Entries[:leftSize]...)
+	right.addEntries(self.Entries[leftSize:]...)
+	self.handlingParent(bpTree, left, right, right.Entries[0].GetCompareEntry())
 	return nil
 }
 
+// 原地替换key相同的Entry, 不存在或者叶子节点不能容纳时返回false
+func (self *BPNode) replace(oldEntry meta.IndexEntry, newEntry meta.IndexEntry) bool {
+	if !self.isLeaf {
+		return self.getChild(self.findChildIndex(oldEntry)).replace(oldEntry, newEntry)
+	}
+	index := self.findDeleteEntriesIndex(oldEntry)
+	if index < 0 || self.Page.remainFreeSpace()+store.GetItemLength(self.Entries[index]) < store.GetItemLength(newEntry) {
+		return false
+	}
+	self.setEntriesByIndex(index, newEntry)
+	return true
+}
+
 // 删除
 func (self *BPNode) Remove(key meta.IndexEntry, bpTree *BPTree) bool {
-	//叶子节点
-	if self.isLeaf {
-		//不包含key直接返回
-		if self.findDeleteEntriesIndex(key) == -1 {
-			return false
-		}
-		removeOk := self.internalRemove(key)
-		//叶子节点并且根节点，表明只有一个节点
-		if self.IsRoot {
-			return removeOk
-		}
-		defer self.internalMerge(bpTree)
-		//不平衡的叶子节点，不能直接删除
-		if !self.isBalancedLeaf(key) {
-			//上一个叶子节点是否可借用
-			if self.prevLeafCanBorrow() {
-				//借用Prev最后一个key添加到当前Entries最前面
-				key := self.Prev.removeEntriesByIndex(len(self.Prev.Entries) - 1)
-				self.addEntriesByIndex(0, key)
-				//更新key到父节点Entries
-				index := self.Parent.findChildrenIndex(self)
-				self.Parent.setEntriesByIndex(index, key)
-				return removeOk
-			}
-			//下一个叶子节点是否可借用
-			if self.nextLeafCanBorrow() {
-				//借用Next第一个key添加到当前Entries最后面
-				key := self.Next.removeEntriesByIndex(0)
-				self.addEntries(key)
-				//将Next的第一个key上提到父节点Entries
-				index := self.Parent.findChildrenIndex(self.Next)
-				self.Parent.setEntriesByIndex(index, self.Next.Entries[0])
-				return removeOk
-			}
-			//Prev是否可合并
-			if self.leafCanMerge(self.Prev) {
-				//合并Prev节点
-				self.mergePrevNode(self.Prev)
-				//父节点删除Prev节点
-				prevIndex := self.Parent.removeChildren(self.Prev)
-				//父节点删除当前节点的key
-				self.Parent.removeEntriesByIndex(prevIndex + 1)
-				//更新节点指向
-				if self.Prev.Prev != nil {
-					self.Prev = self.Prev.Prev
-					self.Prev.Next = self
-				} else {
-					self.Prev = nil
-					bpTree.Head = self
-				}
-				//回收Prev节点
-				self.Prev.recycle()
-				return removeOk
-			}
-			//Next是否可合并
-			if self.leafCanMerge(self.Next) {
-				//合并Next节点
-				self.mergeNextNode(self.Next)
-				//父节点删除Next节点
-				nextIndex := self.Parent.removeChildren(self.Next)
-				//父节点删除Next节点的key
-				self.Parent.removeEntriesByIndex(nextIndex)
-				//更新节点指向
-				if self.Next.Next != nil {
-					self.Next = self.Next.Next
-					self.Next.Prev = self
-				} else {
-					self.Next = nil
-				}
-				//回收Next节点
-				self.Next.recycle()
-				return removeOk
-			}
-		}
-		return removeOk
-	}
 	//非叶子节点
-	if key.CompareEntry(self.Entries[0]) < 0 { //小于第一个Entries
-		return self.Children[0].Remove(key, bpTree)
-	} else if key.CompareEntry(self.Entries[len(self.Entries)-1]) >= 0 { //大于等于最后一个Entries
-		return self.Children[len(self.Children)-1].Remove(key, bpTree)
+	if !self.isLeaf {
+		return self.getChild(self.findChildIndex(key)).Remove(key, bpTree)
 	}
-	//查找大于等于的Entries
-	for i, entry := range self.Entries {
-		if key.CompareEntry(entry) != -1 {
-			continue
-		}
-		return self.Children[i].Remove(key, bpTree)
+	if !self.internalRemove(key) {
+		return false
 	}
-	return false
+	//叶子节点并且根节点，表明只有一个节点
+	if !self.IsRoot {
+		self.leafRebalance(bpTree)
+	}
+	return true
 }
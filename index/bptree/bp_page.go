@@ -1,9 +1,14 @@
 package bptree
 
 import (
+	"Relatdb/meta"
 	"Relatdb/store"
 )
 
+/*
+节点页结构:
+IsLeaf | IsRoot | Parent | Prev | Next | EntryCount | ChildCount(内部节点) | Entry... | Child...
+*/
 type BPPage struct {
 	*store.Page
 	PageNo            uint
@@ -12,10 +17,10 @@ type BPPage struct {
 	LeafInitFreeSpace uint
 }
 
-func NewBPPage(node *BPNode) *BPPage {
+func NewBPPage(node *BPNode, pageNo uint) *BPPage {
 	bpPage := &BPPage{
 		Page:   store.NewPage(),
-		PageNo: 1,
+		PageNo: pageNo,
 		Node:   node,
 	}
 	nodeInitFreeSpace := bpPage.Length - store.DEFAULT_SPECIAL_POINT_LENGTH - store.PAGE_HEADER_SIZE - store.ITEM_INT_LENGTH*7
@@ -46,3 +51,71 @@ func (self *BPPage) getContentSize() uint {
 	}
 	return size
 }
+
+func intToItem(i uint) *store.Item {
+	return store.IndexEntryToItem(meta.NewIndexEntry([]meta.Value{meta.IntValue(i)}, nil))
+}
+
+func itemToInt(item *store.Item) uint {
+	return uint(store.ItemToIndexEntry(item).GetValues()[0].ToInt())
+}
+
+func boolToInt(b bool) uint {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// 将节点写入新的页
+func (self *BPPage) writeNode() {
+	node := self.Node
+	self.Page = store.NewPage()
+	self.WriteItem(intToItem(boolToInt(node.isLeaf)), intToItem(boolToInt(node.IsRoot)))
+	self.WriteItem(intToItem(node.Parent), intToItem(node.Prev), intToItem(node.Next))
+	self.WriteItem(intToItem(uint(len(node.Entries))))
+	if !node.isLeaf {
+		self.WriteItem(intToItem(uint(len(node.Children))))
+	}
+	for _, entry := range node.Entries {
+		self.WriteItem(store.IndexEntryToItem(entry))
+	}
+	for _, child := range node.Children {
+		self.WriteItem(intToItem(child))
+	}
+}
+
+// 从页中读取节点
+func readBPNode(ownerTree *BPTree, pageNo uint, page *store.Page) *BPNode {
+	items := page.ReadItems()
+	node := &BPNode{
+		OwnerTree: ownerTree,
+		isLeaf:    itemToInt(items[0]) == 1,
+		IsRoot:    itemToInt(items[1]) == 1,
+		Parent:    itemToInt(items[2]),
+		Prev:      itemToInt(items[3]),
+		Next:      itemToInt(items[4]),
+	}
+	entryCount := int(itemToInt(items[5]))
+	items = items[6:]
+	if !node.isLeaf {
+		childCount := int(itemToInt(items[0]))
+		items = items[1:]
+		node.Children = make([]uint, childCount)
+		for i := range childCount {
+			node.Children[i] = itemToInt(items[entryCount+i])
+		}
+	}
+	node.Entries = make([]meta.IndexEntry, entryCount)
+	for i := range entryCount {
+		values := store.ItemToIndexEntry(items[i]).GetValues()
+		if node.isLeaf {
+			node.Entries[i] = ownerTree.newLeafEntry(values)
+		} else {
+			node.Entries[i] = meta.NewNotLeafIndexEntry(values, nil)
+		}
+	}
+	node.Page = NewBPPage(node, pageNo)
+	node.Page.Page = page
+	return node
+}
@@ -2,12 +2,29 @@ package bptree
 
 import (
 	"Relatdb/meta"
+	"Relatdb/store"
 )
 
+/*
+每个索引对应一个存储文件, 第0页为头页:
+Root | Head | PageCount | FreeHead
+节点修改后标记为脏节点, 每次插入, 删除和修改结束时写回存储文件
+合并后回收的页加入空闲页链表, 空闲页只记录下一个空闲页的页号, 分配页时优先使用
+使用缓冲池时页的读写经过缓冲池, 操作结束后释放已加载的节点
+*/
 type BPTree struct {
 	meta.BaseIndex
-	Root *BPNode
-	Head *BPNode
+	Root       uint              //根节点页号
+	Head       uint              //第一个叶子节点页号
+	PageCount  uint              //已分配的页数量
+	FreeHead   uint              //第一个空闲页的页号, 0表示没有
+	LeafDesc   *meta.IndexDesc   //叶子节点Entry的描述
+	pageStore  *store.PageStore  //存储文件, 为nil时只保存在内存中
+	bufferPool *store.BufferPool //缓冲池, 为nil时直接读写存储文件
+	nodeMap    map[uint]*BPNode  //已加载的节点
+	dirtyNodes []*BPNode         //需要写回的节点
+	freePages  map[uint]uint     //还没有写回的空闲页及其下一个空闲页
+	dirty      bool              //头页是否需要写回
 }
 
 func NewBPTree(name string, fields []*meta.Field, flag uint) *BPTree {
@@ -15,11 +32,248 @@ func NewBPTree(name string, fields []*meta.Field, flag uint) *BPTree {
 	bpTree.Name = name
 	bpTree.Fields = fields
 	bpTree.FLag = flag
-	bpTree.Root = NewBPNode(bpTree, true, true)
-	bpTree.Head = bpTree.Root
+	bpTree.PageCount = 1
+	bpTree.nodeMap = make(map[uint]*BPNode)
+	bpTree.freePages = make(map[uint]uint)
+	root := NewBPNode(bpTree, true, true)
+	bpTree.Root = root.getPageNo()
+	bpTree.Head = root.getPageNo()
 	return bpTree
 }
 
-func (self *BPTree) Insert(entry meta.IndexEntry) {
-	self.Root.Insert(entry, self, self.IsUnique())
+// 打开存储文件, 新文件写入当前的节点, 已有的文件从头页读取根节点
+func (self *BPTree) Open(path string, leafDesc *meta.IndexDesc, bufferPool *store.BufferPool) {
+	self.LeafDesc = leafDesc
+	self.pageStore = store.NewPageStore(path)
+	self.bufferPool = bufferPool
+	if self.pageStore.GetPageCount() == 0 {
+		for _, node := range self.nodeMap {
+			node.markDirty()
+		}
+		self.dirty = true
+		self.flush()
+		return
+	}
+	items := self.readPage(0).ReadItems()
+	self.Root = itemToInt(items[0])
+	self.Head = itemToInt(items[1])
+	self.PageCount = itemToInt(items[2])
+	//没有空闲页链表的旧文件
+	self.FreeHead = 0
+	if len(items) > 3 {
+		self.FreeHead = itemToInt(items[3])
+	}
+	self.nodeMap = make(map[uint]*BPNode)
+	self.dirtyNodes = nil
+	self.freePages = make(map[uint]uint)
+}
+
+func (self *BPTree) Close() {
+	if self.pageStore != nil {
+		self.pageStore.Close()
+	}
+}
+
+// 分配页号, 空闲页链表不为空时取出第一个空闲页
+func (self *BPTree) allocatePageNo() uint {
+	self.dirty = true
+	if self.FreeHead == 0 {
+		pageNo := self.PageCount
+		self.PageCount++
+		return pageNo
+	}
+	pageNo := self.FreeHead
+	if next, ok := self.freePages[pageNo]; ok {
+		self.FreeHead = next
+		delete(self.freePages, pageNo)
+	} else {
+		self.FreeHead = itemToInt(self.readPage(pageNo).ReadItems()[0])
+	}
+	return pageNo
+}
+
+// 回收节点的页, 加入空闲页链表的头部, 操作结束时写回
+func (self *BPTree) RecyclePageNo(pageNo uint) {
+	self.freePages[pageNo] = self.FreeHead
+	self.FreeHead = pageNo
+	self.dirty = true
+}
+
+func (self *BPTree) putNode(node *BPNode) {
+	self.nodeMap[node.getPageNo()] = node
+}
+
+func (self *BPTree) removeNode(node *BPNode) {
+	delete(self.nodeMap, node.getPageNo())
+}
+
+// 读取页, 使用缓冲池时读取后立即解除固定
+func (self *BPTree) readPage(pageNo uint) *store.Page {
+	if self.bufferPool == nil {
+		return self.pageStore.ReadPage(int(pageNo))
+	}
+	page := self.bufferPool.FetchPage(self.pageStore, int(pageNo))
+	defer self.bufferPool.UnpinPage(self.pageStore, int(pageNo))
+	return page
+}
+
+// 写回一次修改的全部页, 使用缓冲池时整体放入缓冲池
+func (self *BPTree) writePages(pages map[int]*store.Page) {
+	if self.bufferPool == nil {
+		for pageNo, page := range pages {
+			self.pageStore.WritePage(page, pageNo)
+		}
+		return
+	}
+	self.bufferPool.PutPages(self.pageStore, pages)
+}
+
+// 使用缓冲池时释放已加载的节点, 需要时重新从缓冲池读取
+func (self *BPTree) release() {
+	if self.bufferPool != nil && len(self.dirtyNodes) == 0 {
+		self.nodeMap = make(map[uint]*BPNode)
+	}
+}
+
+// 按页号获取节点, 没有加载时从存储文件读取
+func (self *BPTree) getNode(pageNo uint) *BPNode {
+	if pageNo == 0 {
+		return nil
+	}
+	if node, ok := self.nodeMap[pageNo]; ok {
+		return node
+	}
+	node := readBPNode(self, pageNo, self.readPage(pageNo))
+	self.putNode(node)
+	return node
+}
+
+// 按页号读取节点用于遍历, 使用缓冲池时不保留在已加载的节点中
+func (self *BPTree) scanNode(pageNo uint) *BPNode {
+	if _, ok := self.nodeMap[pageNo]; ok || pageNo == 0 || self.bufferPool == nil {
+		return self.getNode(pageNo)
+	}
+	return readBPNode(self, pageNo, self.readPage(pageNo))
+}
+
+func (self *BPTree) getRoot() *BPNode {
+	return self.getNode(self.Root)
+}
+
+func (self *BPTree) setRoot(node *BPNode) {
+	self.Root = node.getPageNo()
+	self.dirty = true
+}
+
+func (self *BPTree) setHead(node *BPNode) {
+	self.Head = getNodePageNo(node)
+	self.dirty = true
+}
+
+// 从页中读取的叶子节点Entry, 聚簇索引为完整的行, 二级索引为索引字段的值和主键
+func (self *BPTree) newLeafEntry(values []meta.Value) meta.IndexEntry {
+	if self.IsPrimary() {
+		return meta.NewClusterIndexEntry(values, self.LeafDesc)
+	}
+	return meta.NewSecondaryIndexEntry(values, len(self.Fields), self.IsUnique(), self.LeafDesc)
+}
+
+// 将脏节点和头页写回存储文件
+func (self *BPTree) flush() {
+	pages := make(map[int]*store.Page)
+	for _, node := range self.dirtyNodes {
+		node.dirty = false
+		//已回收的节点不需要写回
+		if self.pageStore == nil || node.Page == nil {
+			continue
+		}
+		node.Page.writeNode()
+		pages[int(node.getPageNo())] = node.Page.Page
+	}
+	self.dirtyNodes = nil
+	if self.pageStore != nil {
+		for pageNo, next := range self.freePages {
+			page := store.NewPage()
+			page.WriteItem(intToItem(next))
+			pages[int(pageNo)] = page
+		}
+		self.freePages = make(map[uint]uint)
+	}
+	if self.pageStore != nil && self.dirty {
+		page := store.NewPage()
+		page.WriteItem(intToItem(self.Root), intToItem(self.Head), intToItem(self.PageCount), intToItem(self.FreeHead))
+		pages[0] = page
+		self.dirty = false
+	}
+	if len(pages) > 0 {
+		self.writePages(pages)
+	}
+	self.release()
+}
+
+func (self *BPTree) Insert(entry meta.IndexEntry) error {
+	defer self.flush()
+	return self.getRoot().Insert(entry, self, self.IsUnique())
+}
+
+func (self *BPTree) Delete(entry meta.IndexEntry) bool {
+	defer self.flush()
+	return self.getRoot().Remove(entry, self)
+}
+
+/*
+修改Entry: 索引的key不变并且叶子节点可以容纳新的Entry时原地替换
+否则删除后重新插入, 插入失败时恢复原来的Entry
+*/
+func (self *BPTree) Update(oldEntry meta.IndexEntry, newEntry meta.IndexEntry) error {
+	defer self.flush()
+	if oldEntry.CompareDeleteEntry(newEntry) == 0 && self.getRoot().replace(oldEntry, newEntry) {
+		return nil
+	}
+	if !self.getRoot().Remove(oldEntry, self) {
+		return meta.ErrEntryNotExists
+	}
+	if err := self.getRoot().Insert(newEntry, self, self.IsUnique()); err != nil {
+		self.getRoot().Insert(oldEntry, self, false)
+		return err
+	}
+	return nil
+}
+
+// 查找与key相等的Entry, 不存在时返回nil
+func (self *BPTree) Get(key meta.IndexEntry) meta.IndexEntry {
+	return self.Seek(key, meta.COMPARE_EQUAL)
+}
+
+// 按比较方式定位Entry, 见BPNode.Get
+func (self *BPTree) Seek(key meta.IndexEntry, compareType meta.CompareType) meta.IndexEntry {
+	defer self.release()
+	position := self.getRoot().Get(key, compareType)
+	if position == nil {
+		return nil
+	}
+	return position.Node.Entries[position.Position]
+}
+
+func (self *BPTree) Iterator() meta.IndexIterator {
+	return NewBPIterator(self.scanNode(self.Head))
+}
+
+// 从大于key的第一个Entry开始遍历, key为nil时从头开始
+func (self *BPTree) IteratorAfter(key meta.IndexEntry) meta.IndexIterator {
+	if key == nil {
+		return self.Iterator()
+	}
+	return self.Scan(meta.NewIndexBound(key, false), nil, false)
+}
+
+// 遍历边界之内的Entry, 正向从下界开始沿Next遍历, 反向从上界开始沿Prev遍历
+func (self *BPTree) Scan(low *meta.IndexBound, up *meta.IndexBound, reverse bool) meta.IndexIterator {
+	root := self.scanNode(self.Root)
+	if reverse {
+		node, position := root.seekUp(up)
+		return newBPIterator(node, position, low, true)
+	}
+	node, position := root.seekLow(low)
+	return newBPIterator(node, position, up, false)
 }
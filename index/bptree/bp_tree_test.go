@@ -0,0 +1,168 @@
+package bptree
+
+import (
+	"Relatdb/meta"
+	"Relatdb/store"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestKey(values ...int) meta.IndexEntry {
+	key := make([]meta.Value, len(values))
+	for i, value := range values {
+		key[i] = meta.IntValue(value)
+	}
+	return meta.NewNotLeafIndexEntry(key, nil)
+}
+
+func newTestEntry(values ...int) meta.IndexEntry {
+	return meta.NewIndexEntry(newTestKey(values...).GetValues(), nil)
+}
+
+// 按顺序读取迭代器中Entry的前几个字段
+func readKeys(iterator meta.IndexIterator, fieldCount int) []string {
+	var keys []string
+	for iterator.HasNext() {
+		values := iterator.Next().GetValues()[:fieldCount]
+		key := make([]string, len(values))
+		for i, value := range values {
+			key[i] = value.ToString()
+		}
+		keys = append(keys, strings.Join(key, "-"))
+	}
+	return keys
+}
+
+func assertKeys(t *testing.T, keys []string, count int, first string, last string) {
+	t.Helper()
+	if len(keys) != count || (count > 0 && (keys[0] != first || keys[count-1] != last)) {
+		t.Fatalf("expected %d keys from %s to %s, got %v", count, first, last, keys)
+	}
+}
+
+// 使用较小的缓冲池, 遍历时节点从缓冲池重新读取
+func TestScan(t *testing.T) {
+	tree := NewBPTree("primary", nil, 0)
+	tree.Open(filepath.Join(t.TempDir(), "primary.data"), nil, store.NewBufferPool(16, ""))
+	defer tree.Close()
+	for id := 2; id <= 4000; id += 2 {
+		if err := tree.Insert(newTestEntry(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//定位
+	seeks := []struct {
+		key         int
+		compareType meta.CompareType
+		expected    string
+	}{
+		{100, meta.COMPARE_EQUAL, "100"}, {101, meta.COMPARE_EQUAL, ""},
+		{101, meta.COMPARE_LOW, "102"}, {101, meta.COMPARE_UP, "100"},
+		{1, meta.COMPARE_UP, ""}, {4001, meta.COMPARE_LOW, ""}, {4001, meta.COMPARE_UP, "4000"},
+	}
+	for _, seek := range seeks {
+		actual := ""
+		if entry := tree.Seek(newTestKey(seek.key), seek.compareType); entry != nil {
+			actual = entry.GetValues()[0].ToString()
+		}
+		if actual != seek.expected {
+			t.Fatalf("seek %d with %d: expected %q, got %q", seek.key, seek.compareType, seek.expected, actual)
+		}
+	}
+
+	//正向和反向遍历
+	assertKeys(t, readKeys(tree.Scan(nil, nil, false), 1), 2000, "2", "4000")
+	assertKeys(t, readKeys(tree.Scan(nil, nil, true), 1), 2000, "4000", "2")
+	low, up := meta.NewIndexBound(newTestKey(100), true), meta.NewIndexBound(newTestKey(200), false)
+	assertKeys(t, readKeys(tree.Scan(low, up, false), 1), 50, "100", "198")
+	assertKeys(t, readKeys(tree.Scan(low, up, true), 1), 50, "198", "100")
+	low, up = meta.NewIndexBound(newTestKey(100), false), meta.NewIndexBound(newTestKey(200), true)
+	assertKeys(t, readKeys(tree.Scan(low, up, true), 1), 50, "200", "102")
+	assertKeys(t, readKeys(tree.Scan(up, low, false), 1), 0, "", "")
+	assertKeys(t, readKeys(tree.IteratorAfter(newTestKey(3997)), 1), 2, "3998", "4000")
+}
+
+// 组合键按前缀比较
+func TestScanPrefix(t *testing.T) {
+	tree := NewBPTree("composite", nil, 0)
+	for a := 1; a <= 50; a++ {
+		for b := 20; b >= 1; b-- {
+			if err := tree.Insert(newTestEntry(a, b)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	prefix := meta.NewIndexBound(newTestKey(7), true)
+	assertKeys(t, readKeys(tree.Scan(prefix, prefix, false), 2), 20, "7-1", "7-20")
+	assertKeys(t, readKeys(tree.Scan(prefix, prefix, true), 2), 20, "7-20", "7-1")
+	low, up := meta.NewIndexBound(newTestKey(7, 5), false), meta.NewIndexBound(newTestKey(8), false)
+	assertKeys(t, readKeys(tree.Scan(low, up, false), 2), 15, "7-6", "7-20")
+	low, up = meta.NewIndexBound(newTestKey(7), false), meta.NewIndexBound(newTestKey(9, 3), true)
+	assertKeys(t, readKeys(tree.Scan(low, up, true), 2), 23, "9-3", "8-1")
+	if entry := tree.Seek(newTestKey(7), meta.COMPARE_UP); meta.ComparePrefix(entry, newTestKey(7, 20)) != 0 {
+		t.Fatalf("expected 7-20, got %v", entry.GetValues())
+	}
+	if entry := tree.Seek(newTestKey(7), meta.COMPARE_EQUAL); meta.ComparePrefix(entry, newTestKey(7, 1)) != 0 {
+		t.Fatalf("expected 7-1, got %v", entry.GetValues())
+	}
+}
+
+func TestDeleteAndUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "composite.data")
+	tree := NewBPTree("composite", nil, 0)
+	tree.Open(path, nil, nil)
+	insertAll := func(a int) {
+		for b := 1; b <= 20; b++ {
+			if err := tree.Insert(newTestEntry(a, b)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	deleteAll := func(a int) {
+		for b := 1; b <= 20; b++ {
+			if !tree.Delete(newTestEntry(a, b)) {
+				t.Fatalf("entry %d-%d not exists", a, b)
+			}
+		}
+	}
+	for a := 1; a <= 100; a++ {
+		insertAll(a)
+	}
+	pageCount := tree.PageCount
+
+	//合并回收的页在之后插入时重新使用
+	for a := 1; a <= 100; a += 2 {
+		deleteAll(a)
+	}
+	if tree.FreeHead == 0 {
+		t.Fatal("expected recycled pages")
+	}
+	if tree.Delete(newTestEntry(1, 1)) {
+		t.Fatal("expected a deleted entry not to be deleted again")
+	}
+	assertKeys(t, readKeys(tree.Scan(nil, nil, false), 2), 1000, "2-1", "100-20")
+	assertKeys(t, readKeys(tree.Scan(nil, nil, true), 2), 1000, "100-20", "2-1")
+	tree.Close()
+	//空闲页链表保存在头页中, 重新打开后继续使用
+	tree = NewBPTree("composite", nil, 0)
+	tree.Open(path, nil, nil)
+	defer tree.Close()
+	for a := 1; a <= 100; a += 2 {
+		insertAll(a)
+	}
+	if tree.PageCount > pageCount {
+		t.Fatalf("expected at most %d pages, got %d", pageCount, tree.PageCount)
+	}
+	assertKeys(t, readKeys(tree.Scan(nil, nil, false), 2), 2000, "1-1", "100-20")
+
+	//修改后key改变的Entry移动到新的位置
+	if err := tree.Update(newTestEntry(1, 1), newTestEntry(200, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Update(newTestEntry(1, 1), newTestEntry(300, 1)); err != meta.ErrEntryNotExists {
+		t.Fatalf("expected entry not exists, got %v", err)
+	}
+	assertKeys(t, readKeys(tree.Scan(nil, nil, false), 2), 2000, "1-2", "200-1")
+}
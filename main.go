@@ -3,15 +3,47 @@ package main
 import (
 	"Relatdb/server"
 	"Relatdb/store/icna"
+	"Relatdb/transaction"
 	"Relatdb/utils"
+	"flag"
+	"fmt"
 	"os"
+	"time"
 )
 
+/*
+启动参数:
+-data: 数据目录, 默认为当前目录下的data
+-log-archive: 检查点之后不再需要的日志段移动到的目录, 为空时删除, 时间点恢复需要归档的日志
+-recovery-lsn, -recovery-time: 时间点恢复的目标, 设置时-data为基础备份(BACKUP DATABASE的目录)
+时间点恢复之前停止服务, 并将原数据目录中wal下的日志段复制到归档目录, 最后的日志段还没有被归档
+恢复时使用基础备份和归档目录的副本, 恢复之后去掉恢复目标重新启动, 之后的日志归档到副本中
+*/
 func main() {
 	wd, _ := os.Getwd()
-	store := icna.NewIcnaStore(&icna.Options{
-		Path: utils.ConcatFilePaths(wd, "data"),
+	dataPath := flag.String("data", utils.ConcatFilePaths(wd, "data"), "data directory")
+	archivePath := flag.String("log-archive", "", "directory to move log segments to after checkpoints, segments are removed when empty")
+	recoveryLsn := flag.Uint64("recovery-lsn", 0, "recover the base backup in -data up to this log sequence number")
+	var recoveryTime time.Time
+	flag.Func("recovery-time", "recover the base backup in -data up to this local time, e.g. '2006-01-02 15:04:05'", func(value string) error {
+		var err error
+		recoveryTime, err = time.ParseInLocation(time.DateTime, value, time.Local)
+		return err
 	})
+	flag.Parse()
+
+	options := &icna.Options{
+		Path:           *dataPath,
+		LogArchivePath: *archivePath,
+	}
+	if *recoveryLsn > 0 || !recoveryTime.IsZero() {
+		if *archivePath == "" {
+			fmt.Fprintln(os.Stderr, "-log-archive is required for point-in-time recovery")
+			os.Exit(2)
+		}
+		options.RecoveryTarget = &transaction.RecoveryTarget{Lsn: *recoveryLsn, Time: recoveryTime}
+	}
+	store := icna.NewIcnaStore(options)
 	server := server.NewServer(&server.Options{
 		BindIp:   "localhost",
 		BindPort: 3306,
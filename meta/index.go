@@ -1,6 +1,11 @@
 package meta
 
-import "Relatdb/common"
+import (
+	"Relatdb/common"
+	"errors"
+	"fmt"
+	"strings"
+)
 
 type CompareType = uint
 
@@ -11,13 +16,66 @@ const (
 	COMPARE_UP
 )
 
+// 聚簇索引在查找和错误信息中使用的名称
+const PRIMARY_KEY_NAME = "PRIMARY"
+
+var ErrDuplicateKey = errors.New("duplicated Key error")
+var ErrEntryNotExists = errors.New("entry not exists")
+
 type Index interface {
 	GetName() string
 	GetFields() []*Field
 	GetFlag() uint
 	IsPrimary() bool
 	IsUnique() bool
-	Insert(entry IndexEntry)
+	Insert(entry IndexEntry) error
+	Delete(entry IndexEntry) bool
+	Update(oldEntry IndexEntry, newEntry IndexEntry) error
+	Get(key IndexEntry) IndexEntry
+	Seek(key IndexEntry, compareType CompareType) IndexEntry
+	Iterator() IndexIterator
+	IteratorAfter(key IndexEntry) IndexIterator
+	Scan(low *IndexBound, up *IndexBound, reverse bool) IndexIterator
+}
+
+type IndexIterator interface {
+	HasNext() bool
+	Next() IndexEntry
+}
+
+/*
+范围查找的边界, 按Key的字段数比较Entry的前缀
+组合索引的Key可以只包含前面的字段, 包含边界时匹配全部以Key开头的Entry
+边界为nil时不限制
+*/
+type IndexBound struct {
+	Key       IndexEntry
+	Inclusive bool
+}
+
+func NewIndexBound(key IndexEntry, inclusive bool) *IndexBound {
+	return &IndexBound{
+		Key:       key,
+		Inclusive: inclusive,
+	}
+}
+
+// entry是否小于下界
+func (self *IndexBound) IsBelow(entry IndexEntry) bool {
+	if self == nil {
+		return false
+	}
+	comp := ComparePrefix(entry, self.Key)
+	return comp < 0 || (comp == 0 && !self.Inclusive)
+}
+
+// entry是否大于上界
+func (self *IndexBound) IsAbove(entry IndexEntry) bool {
+	if self == nil {
+		return false
+	}
+	comp := ComparePrefix(entry, self.Key)
+	return comp > 0 || (comp == 0 && !self.Inclusive)
 }
 
 type BaseIndex struct {
@@ -42,10 +100,22 @@ func (self *BaseIndex) IsPrimary() bool {
 	return self.FLag&common.PRIMARY_KEY_FLAG != 0
 }
 
+// 主键索引同样是唯一索引
 func (self *BaseIndex) IsUnique() bool {
-	return self.FLag&common.UNIQUE_KEY_FLAG != 0
+	return self.FLag&(common.PRIMARY_KEY_FLAG|common.UNIQUE_KEY_FLAG) != 0
 }
 
-func (self *BaseIndex) RecyclePageNo(pageNo uint) {
-
+// 唯一索引重复的错误, entry为完整的行
+func NewDuplicateEntryError(index Index, entry IndexEntry) error {
+	values := entry.GetValues()
+	keys := make([]string, len(index.GetFields()))
+	for i, field := range index.GetFields() {
+		keys[i] = values[field.Index].ToString()
+	}
+	keyName := index.GetName()
+	if index.IsPrimary() {
+		keyName = PRIMARY_KEY_NAME
+	}
+	message := fmt.Sprintf("Duplicate entry '%s' for key '%s'", strings.Join(keys, "-"), keyName)
+	return common.NewSQLError(common.ER_DUP_ENTRY, "23000", message)
 }
@@ -3,28 +3,28 @@ package meta
 import "Relatdb/common"
 
 type IndexDesc struct {
-	Fields       []*Field
-	PrimaryFiled *Field
-	FieldMap     map[string]*Field
+	Fields        []*Field
+	PrimaryFields []*Field //主键的字段, 按主键中的顺序排列
+	FieldMap      map[string]*Field
 }
 
 func NewIndexDesc(fields []*Field) *IndexDesc {
-	var primaryFiled *Field
+	var primaryFields []*Field
 	fieldMap := make(map[string]*Field, len(fields))
 	for _, field := range fields {
 		fieldMap[field.Name] = field
 		if field.Flag&common.PRIMARY_KEY_FLAG != 0 {
-			primaryFiled = field
+			primaryFields = append(primaryFields, field)
 		}
 	}
-	return NewIndexDescByAllArgs(fields, primaryFiled, fieldMap)
+	return NewIndexDescByAllArgs(fields, primaryFields, fieldMap)
 }
 
-func NewIndexDescByAllArgs(fields []*Field, primaryFiled *Field, fieldMap map[string]*Field) *IndexDesc {
+func NewIndexDescByAllArgs(fields []*Field, primaryFields []*Field, fieldMap map[string]*Field) *IndexDesc {
 	desc := &IndexDesc{
-		Fields:       fields,
-		PrimaryFiled: primaryFiled,
-		FieldMap:     fieldMap,
+		Fields:        fields,
+		PrimaryFields: primaryFields,
+		FieldMap:      fieldMap,
 	}
 	return desc
 }
@@ -24,6 +24,10 @@ func NewIndexEntry(values []Value, desc *IndexDesc) *BaseIndexEntry {
 	return entry
 }
 
+/*
+逐个字段比较, 第一个不相等的字段决定结果, 前面的字段都相等时字段少的较小
+NULL小于任何非NULL的值, 两个NULL相等
+*/
 func (self *BaseIndexEntry) innerCompare(entry IndexEntry) int {
 	selfValues := self.Values
 	selfValuesLength := len(selfValues)
@@ -31,18 +35,18 @@ func (self *BaseIndexEntry) innerCompare(entry IndexEntry) int {
 	entryValuesLength := len(entryValues)
 	minLength := min(selfValuesLength, entryValuesLength)
 	for i := 0; i < minLength; i++ {
-		selfValue := selfValues[i]
-		entryValue := entryValues[i]
-		if selfValue == nil && entryValue == nil {
+		selfIsNull := isNullEntryValue(selfValues[i])
+		entryIsNull := isNullEntryValue(entryValues[i])
+		if selfIsNull && entryIsNull {
 			continue
 		}
-		if selfValue == nil {
+		if selfIsNull {
 			return -1
 		}
-		if entryValue == nil {
+		if entryIsNull {
 			return 1
 		}
-		if comp := selfValue.Compare(entryValue); comp != 0 {
+		if comp := selfValues[i].Compare(entryValues[i]); comp != 0 {
 			return comp
 		}
 	}
@@ -55,6 +59,10 @@ func (self *BaseIndexEntry) innerCompare(entry IndexEntry) int {
 	return 0
 }
 
+func isNullEntryValue(value Value) bool {
+	return value == nil || value.GetType() == NullValueType
+}
+
 func (self *BaseIndexEntry) GetValues() []Value {
 	return self.Values
 }
@@ -90,6 +98,16 @@ func (self *BaseIndexEntry) CompareDeleteEntry(compareEntry IndexEntry) int {
 	return self.innerCompare(compareEntry.GetDeleteCompareEntry())
 }
 
+// 按key的字段数比较entry的前缀, 两者都使用索引比较的字段
+func ComparePrefix(entry IndexEntry, key IndexEntry) int {
+	keyValues := key.GetCompareEntry().GetValues()
+	values := entry.GetCompareEntry().GetValues()
+	if len(values) > len(keyValues) {
+		values = values[:len(keyValues)]
+	}
+	return NewNotLeafIndexEntry(values, nil).innerCompare(NewNotLeafIndexEntry(keyValues, nil))
+}
+
 type NotLeafIndexEntry struct {
 	BaseIndexEntry
 }
@@ -116,12 +134,15 @@ func NewClusterIndexEntry(values []Value, desc *IndexDesc) *ClusterIndexEntry {
 	return entry
 }
 
+// 按主键中的顺序取出主键字段的值, 组合主键逐个字段比较
 func (self *ClusterIndexEntry) GetCompareEntry() IndexEntry {
 	if self.IndexEntry == nil {
-		primaryAttr := self.Desc.PrimaryFiled
-		rowId := self.Values[primaryAttr.Index]
-		desc := NewIndexDesc([]*Field{primaryAttr})
-		self.IndexEntry = NewNotLeafIndexEntry([]Value{rowId}, desc)
+		primaryFields := self.Desc.PrimaryFields
+		keyValues := make([]Value, len(primaryFields))
+		for i, field := range primaryFields {
+			keyValues[i] = self.Values[field.Index]
+		}
+		self.IndexEntry = NewNotLeafIndexEntry(keyValues, NewIndexDesc(primaryFields))
 	}
 	return self.IndexEntry
 }
@@ -129,3 +150,65 @@ func (self *ClusterIndexEntry) GetCompareEntry() IndexEntry {
 func (self *ClusterIndexEntry) GetDeleteCompareEntry() IndexEntry {
 	return self.GetCompareEntry()
 }
+
+// 聚簇索引按主键比较
+func (self *ClusterIndexEntry) CompareEntry(compareEntry IndexEntry) int {
+	return self.GetCompareEntry().CompareEntry(compareEntry)
+}
+
+func (self *ClusterIndexEntry) CompareDeleteEntry(compareEntry IndexEntry) int {
+	return self.GetDeleteCompareEntry().CompareDeleteEntry(compareEntry)
+}
+
+/*
+二级索引的Entry: 索引字段的值, 主键和删除标记
+唯一索引按索引字段比较, 索引字段有NULL或者带删除标记时按全部的值比较, 不与其他的行冲突; 非唯一索引按全部的值比较
+*/
+type SecondaryIndexEntry struct {
+	BaseIndexEntry
+	keyCount int  //索引字段的数量
+	unique   bool //是否是唯一索引
+}
+
+func NewSecondaryIndexEntry(values []Value, keyCount int, unique bool, desc *IndexDesc) *SecondaryIndexEntry {
+	entry := &SecondaryIndexEntry{
+		keyCount: keyCount,
+		unique:   unique,
+	}
+	entry.Values = values
+	entry.Desc = desc
+	return entry
+}
+
+func (self *SecondaryIndexEntry) GetCompareEntry() IndexEntry {
+	if self.IndexEntry == nil {
+		values := self.Values
+		if self.unique && !self.IsDeleted() && !self.hasNullKey() {
+			values = values[:self.keyCount]
+		}
+		self.IndexEntry = NewNotLeafIndexEntry(values, self.Desc)
+	}
+	return self.IndexEntry
+}
+
+// 指向聚簇索引中的行的主键
+func (self *SecondaryIndexEntry) GetBookmark() []Value {
+	return self.Values[self.keyCount : len(self.Values)-1]
+}
+
+func (self *SecondaryIndexEntry) IsDeleted() bool {
+	return self.Values[len(self.Values)-1].ToInt() != 0
+}
+
+func (self *SecondaryIndexEntry) hasNullKey() bool {
+	for _, value := range self.Values[:self.keyCount] {
+		if value.GetType() == NullValueType {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *SecondaryIndexEntry) CompareEntry(compareEntry IndexEntry) int {
+	return self.GetCompareEntry().CompareEntry(compareEntry)
+}
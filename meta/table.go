@@ -1,26 +1,43 @@
 package meta
 
+import "errors"
+
+// 聚簇索引的行在表的字段之后保存的隐藏列
+const (
+	ROW_TRX_ID      = iota //最后修改行的事务ID
+	ROW_ROLL_PTR           //回滚指针, 指向保存上一个版本的撤销记录, 0表示没有
+	ROW_DELETE_MARK        //删除标记, 删除的行保留到没有读视图需要时清除
+	HIDDEN_COLUMN_COUNT
+)
+
+/*
+没有主键的表使用隐藏的行ID作为聚簇索引的Key, 作为表的最后一个字段保存, 插入时生成
+标识符在解析时转换为小写, 大写的名称不会与用户定义的字段重名
+*/
+const ROW_ID_FIELD_NAME = "DB_ROW_ID"
+
 type Table struct {
 	MetaPath         string
 	DataPath         string
 	DatabaseName     string
 	Name             string
 	Fields           []*Field
-	PrimaryFiled     *Field
+	PrimaryFields    []*Field //主键的字段, 按主键中的顺序排列
 	FieldMap         map[string]*Field
 	ClusterIndex     Index
 	SecondaryIndexes []Index
+	RowId            int64 //最后分配的隐藏行ID, 只增不减, 保存在表的描述页中
 }
 
 func NewTable(
-	databaseName string, name string, fields []*Field, primaryFiled *Field,
+	databaseName string, name string, fields []*Field, primaryFields []*Field,
 	fieldMap map[string]*Field, clusterIndex Index, secondaryIndexes []Index,
 ) *Table {
 	return &Table{
 		DatabaseName:     databaseName,
 		Name:             name,
 		Fields:           fields,
-		PrimaryFiled:     primaryFiled,
+		PrimaryFields:    primaryFields,
 		FieldMap:         fieldMap,
 		ClusterIndex:     clusterIndex,
 		SecondaryIndexes: secondaryIndexes,
@@ -32,9 +49,128 @@ func (self *Table) GetField(fieldName string) *Field {
 	return field
 }
 
-func (self *Table) Insert(entry IndexEntry) {
-	self.ClusterIndex.Insert(entry)
+// 隐藏的行ID字段, 表有主键时返回nil
+func (self *Table) GetRowIdField() *Field {
+	if len(self.PrimaryFields) == 1 && self.PrimaryFields[0].Name == ROW_ID_FIELD_NAME {
+		return self.PrimaryFields[0]
+	}
+	return nil
+}
+
+// 行的主键的值
+func (self *Table) GetPrimaryKey(values []Value) []Value {
+	key := make([]Value, len(self.PrimaryFields))
+	for i, field := range self.PrimaryFields {
+		key[i] = values[field.Index]
+	}
+	return key
+}
+
+func (self *Table) GetIndexDesc() *IndexDesc {
+	return NewIndexDescByAllArgs(self.Fields, self.PrimaryFields, self.FieldMap)
+}
+
+// 按名称查找二级索引, 不存在时返回nil
+func (self *Table) GetSecondaryIndex(indexName string) Index {
+	for _, index := range self.SecondaryIndexes {
+		if index.GetName() == indexName {
+			return index
+		}
+	}
+	return nil
+}
+
+// 按名称查找索引, 聚簇索引的名称为PRIMARY
+func (self *Table) GetIndex(indexName string) Index {
+	if indexName == PRIMARY_KEY_NAME {
+		return self.ClusterIndex
+	}
+	return self.GetSecondaryIndex(indexName)
+}
+
+// 行是否带有删除标记, 没有隐藏列的行视为没有删除
+func (self *Table) IsDeletedRow(values []Value) bool {
+	fieldCount := len(self.Fields)
+	return len(values) >= fieldCount+HIDDEN_COLUMN_COUNT && values[fieldCount+ROW_DELETE_MARK].ToInt() != 0
+}
+
+/*
+行在索引中的Entry: 聚簇索引为完整的行, 二级索引为索引字段的值, 主键和行的删除标记
+带删除标记的行在唯一索引中加上主键比较, 删除之后可以插入相同的值
+*/
+func (self *Table) GetIndexEntry(index Index, row IndexEntry) IndexEntry {
+	if index == self.ClusterIndex {
+		return row
+	}
+	values := row.GetValues()
+	fields := index.GetFields()
+	keyValues := make([]Value, 0, len(fields)+len(self.PrimaryFields)+1)
+	for _, field := range fields {
+		keyValues = append(keyValues, values[field.Index])
+	}
+	deleteMark := 0
+	if self.IsDeletedRow(values) {
+		deleteMark = 1
+	}
+	keyValues = append(keyValues, self.GetPrimaryKey(values)...)
+	keyValues = append(keyValues, IntValue(deleteMark))
+	return NewSecondaryIndexEntry(keyValues, len(fields), index.IsUnique(), nil)
+}
+
+// 按二级索引Entry中的主键构造聚簇索引的查找Key
+func (self *Table) GetBookmarkKey(entry IndexEntry) IndexEntry {
+	values := make([]Value, len(self.Fields))
+	bookmark := entry.(*SecondaryIndexEntry).GetBookmark()
+	for i, field := range self.PrimaryFields {
+		values[field.Index] = bookmark[i]
+	}
+	return NewClusterIndexEntry(values, self.GetIndexDesc())
+}
+
+// 插入行, 任意索引插入失败时撤销已经插入的索引
+func (self *Table) Insert(entry IndexEntry) error {
+	if err := self.ClusterIndex.Insert(entry); err != nil {
+		return self.indexError(self.ClusterIndex, entry, err)
+	}
+	for i, secondaryIndex := range self.SecondaryIndexes {
+		if err := secondaryIndex.Insert(self.GetIndexEntry(secondaryIndex, entry)); err != nil {
+			for _, insertedIndex := range self.SecondaryIndexes[:i] {
+				insertedIndex.Delete(self.GetIndexEntry(insertedIndex, entry))
+			}
+			self.ClusterIndex.Delete(entry)
+			return self.indexError(secondaryIndex, entry, err)
+		}
+	}
+	return nil
+}
+
+func (self *Table) indexError(index Index, entry IndexEntry, err error) error {
+	if errors.Is(err, ErrDuplicateKey) {
+		return NewDuplicateEntryError(index, entry)
+	}
+	return err
+}
+
+func (self *Table) Delete(entry IndexEntry) bool {
+	if !self.ClusterIndex.Delete(entry) {
+		return false
+	}
 	for _, secondaryIndex := range self.SecondaryIndexes {
-		secondaryIndex.Insert(entry)
+		secondaryIndex.Delete(self.GetIndexEntry(secondaryIndex, entry))
+	}
+	return true
+}
+
+// 修改行, 主键改变时行移动到新的位置, 任意索引修改失败时恢复已经修改的索引
+func (self *Table) Update(oldEntry IndexEntry, newEntry IndexEntry) error {
+	indexes := append([]Index{self.ClusterIndex}, self.SecondaryIndexes...)
+	for i, index := range indexes {
+		if err := index.Update(self.GetIndexEntry(index, oldEntry), self.GetIndexEntry(index, newEntry)); err != nil {
+			for _, updatedIndex := range indexes[:i] {
+				updatedIndex.Update(self.GetIndexEntry(updatedIndex, newEntry), self.GetIndexEntry(updatedIndex, oldEntry))
+			}
+			return self.indexError(index, newEntry, err)
+		}
 	}
+	return nil
 }
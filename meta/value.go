@@ -3,6 +3,7 @@ package meta
 import (
 	"Relatdb/common"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -15,6 +16,7 @@ const (
 	Int64ValueType
 	IntValueType
 	NullValueType
+	Float64ValueType
 )
 
 var (
@@ -26,6 +28,7 @@ type Value interface {
 	ToString() string
 	ToInt() int
 	ToInt64() int64
+	ToFloat64() float64
 	ToBytes() []byte
 	ToValueBytes() []byte
 	GetLength() uint
@@ -54,6 +57,11 @@ func (self StringValue) ToInt64() int64 {
 	return total
 }
 
+func (self StringValue) ToFloat64() float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(string(self)), 64)
+	return f
+}
+
 func (self StringValue) ToBytes() []byte {
 	buffer := common.NewBufferBySize(self.GetLength())
 	buffer.WriteByte(byte(self.GetType()))
@@ -92,6 +100,10 @@ func (self Int64Value) ToInt64() int64 {
 	return int64(self)
 }
 
+func (self Int64Value) ToFloat64() float64 {
+	return float64(self)
+}
+
 func (self Int64Value) ToBytes() []byte {
 	buffer := common.NewBufferBySize(self.GetLength())
 	buffer.WriteByte(byte(self.GetType()))
@@ -137,6 +149,10 @@ func (self IntValue) ToInt64() int64 {
 	return int64(self)
 }
 
+func (self IntValue) ToFloat64() float64 {
+	return float64(self)
+}
+
 func (self IntValue) ToBytes() []byte {
 	buffer := common.NewBufferBySize(self.GetLength())
 	buffer.WriteByte(byte(self.GetType()))
@@ -164,6 +180,55 @@ func (self IntValue) Compare(value Value) int {
 	return 0
 }
 
+type Float64Value float64
+
+func (v Float64Value) GetType() ValueType {
+	return Float64ValueType
+}
+
+func (self Float64Value) ToString() string {
+	return strconv.FormatFloat(float64(self), 'f', -1, 64)
+}
+
+func (self Float64Value) ToInt() int {
+	return int(self)
+}
+
+func (self Float64Value) ToInt64() int64 {
+	return int64(self)
+}
+
+func (self Float64Value) ToFloat64() float64 {
+	return float64(self)
+}
+
+func (self Float64Value) ToBytes() []byte {
+	buffer := common.NewBufferBySize(self.GetLength())
+	buffer.WriteByte(byte(self.GetType()))
+	buffer.WriteInt64(int64(math.Float64bits(float64(self))))
+	return buffer.Data
+}
+
+func (self Float64Value) ToValueBytes() []byte {
+	buffer := common.NewBufferBySize(self.GetLength() - 1)
+	buffer.WriteInt64(int64(math.Float64bits(float64(self))))
+	return buffer.Data
+}
+
+func (self Float64Value) GetLength() uint {
+	return 8 + 1
+}
+
+func (self Float64Value) Compare(value Value) int {
+	if self.ToFloat64() < value.ToFloat64() {
+		return -1
+	}
+	if self.ToFloat64() > value.ToFloat64() {
+		return 1
+	}
+	return 0
+}
+
 type NullValue struct{}
 
 func (self NullValue) GetType() ValueType {
@@ -182,6 +247,10 @@ func (self NullValue) ToInt64() int64 {
 	return 0
 }
 
+func (self NullValue) ToFloat64() float64 {
+	return 0
+}
+
 func (self NullValue) ToBytes() []byte {
 	buffer := common.NewBufferBySize(self.GetLength())
 	buffer.WriteByte(byte(self.GetType()))
@@ -218,6 +287,8 @@ func ToValue(val any) Value {
 		return Int64Value(v)
 	case uint64:
 		return Int64Value(v)
+	case float64:
+		return Float64Value(v)
 	case Value:
 		return v
 	default:
@@ -225,6 +296,39 @@ func ToValue(val any) Value {
 	}
 }
 
+// 将值按ToBytes的格式连续编码
+func ValuesToBytes(values []Value) []byte {
+	var data []byte
+	for _, value := range values {
+		data = append(data, value.ToBytes()...)
+	}
+	return data
+}
+
+func BytesToValues(data []byte) []Value {
+	buffer := common.NewBuffer(data)
+	var values []Value
+	for buffer.Remaining() > 0 {
+		var value Value
+		fieldType := ValueType(buffer.ReadByte())
+		switch fieldType {
+		case StringValueType:
+			length := buffer.ReadInt()
+			value = StringValue(buffer.ReadBytes(uint(length)))
+		case Int64ValueType:
+			value = Int64Value(buffer.ReadInt64())
+		case IntValueType:
+			value = IntValue(buffer.ReadInt())
+		case Float64ValueType:
+			value = Float64Value(math.Float64frombits(uint64(buffer.ReadInt64())))
+		case NullValueType:
+			value = CONST_NULL_VALUE
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
 func FieldToValues(field *Field) []Value {
 	return []Value{
 		IntValue(field.Index),
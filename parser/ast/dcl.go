@@ -19,6 +19,7 @@ type SetVariableStatement struct {
 	_Statement_
 
 	SetIndex uint64
+	Scope    *Identifier //GLOBAL或SESSION, 为nil时为SESSION
 	Name     *Identifier
 	Value    Expression
 }
@@ -30,3 +31,34 @@ func (self *SetVariableStatement) StartIndex() uint64 {
 func (self *SetVariableStatement) EndIndex() uint64 {
 	return self.Value.EndIndex()
 }
+
+type FlushStatement struct {
+	_Statement_
+
+	FlushIndex uint64
+	Option     *Identifier //目前只支持LOGS
+}
+
+func (self *FlushStatement) StartIndex() uint64 {
+	return self.FlushIndex
+}
+
+func (self *FlushStatement) EndIndex() uint64 {
+	return self.Option.EndIndex()
+}
+
+type BackupStatement struct {
+	_Statement_
+
+	BackupIndex uint64
+	Database    Expression //为nil时备份全部数据库
+	Dir         *StringLiteral
+}
+
+func (self *BackupStatement) StartIndex() uint64 {
+	return self.BackupIndex
+}
+
+func (self *BackupStatement) EndIndex() uint64 {
+	return self.Dir.EndIndex()
+}
@@ -38,6 +38,33 @@ func (self *ColumnDefinition) EndIndex() uint64 {
 	return self.Name.EndIndex()
 }
 
+type ConstraintType int
+
+const (
+	ConstraintPrimaryKey ConstraintType = iota
+	ConstraintUniqueKey
+	ConstraintKey
+)
+
+// 表级的键约束: PRIMARY KEY (...), UNIQUE [KEY|INDEX] [name] (...), KEY|INDEX [name] (...)
+type ConstraintDefinition struct {
+	_Statement_
+
+	Index            uint64
+	Type             ConstraintType
+	Name             Expression //索引名称, 没有指定时为nil
+	ColumnNames      []*ColumnName
+	RightParenthesis uint64
+}
+
+func (self *ConstraintDefinition) StartIndex() uint64 {
+	return self.Index
+}
+
+func (self *ConstraintDefinition) EndIndex() uint64 {
+	return self.RightParenthesis
+}
+
 type CreateDatabaseStatement struct {
 	_DDLStatement_
 
@@ -77,6 +104,7 @@ type CreateTableStatement struct {
 	IfNotExists       bool
 	Name              *TableName
 	ColumnDefinitions []*ColumnDefinition
+	Constraints       []*ConstraintDefinition
 	RightParenthesis  uint64
 }
 
@@ -80,6 +80,23 @@ func (self *Limit) EndIndex() uint64 {
 	return self.Count.EndIndex()
 }
 
+// 锁定读: FOR UPDATE加排他锁, FOR SHARE和LOCK IN SHARE MODE加共享锁
+type LockClause struct {
+	_Statement_
+
+	LockIndex uint64
+	Exclusive bool
+	EndWord   *Identifier
+}
+
+func (self *LockClause) StartIndex() uint64 {
+	return self.LockIndex
+}
+
+func (self *LockClause) EndIndex() uint64 {
+	return self.EndWord.EndIndex()
+}
+
 type SelectField struct {
 	_Expression_
 
@@ -123,6 +140,7 @@ type SelectStatement struct {
 	Having      *HavingClause
 	Order       *OrderByClause
 	Limit       *Limit
+	Lock        *LockClause
 }
 
 func (self *SelectStatement) StartIndex() uint64 {
@@ -130,6 +148,9 @@ func (self *SelectStatement) StartIndex() uint64 {
 }
 
 func (self *SelectStatement) EndIndex() uint64 {
+	if self.Lock != nil {
+		return self.Lock.EndIndex()
+	}
 	if self.Limit != nil {
 		return self.Limit.EndIndex()
 	}
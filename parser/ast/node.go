@@ -76,11 +76,13 @@ func (self *NumberLiteral) EndIndex() uint64 {
 	return self.Index + uint64(len(self.Literal))
 }
 
+// Value转换为小写, 比较和LIKE不区分大小写, Text保留原来的内容, 用于区分大小写的目录和xid
 type StringLiteral struct {
 	_Expression_
 	Index   uint64
 	Literal string
 	Value   string
+	Text    string
 }
 
 func (self *StringLiteral) StartIndex() uint64 {
@@ -202,3 +204,65 @@ func (self *CallExpression) StartIndex() uint64 {
 func (self *CallExpression) EndIndex() uint64 {
 	return self.RightParenthesis + 1
 }
+
+type IsNullExpression struct {
+	_Expression_
+	Expr      Expression
+	Not       bool
+	NullIndex uint64
+}
+
+func (self *IsNullExpression) StartIndex() uint64 {
+	return self.Expr.StartIndex()
+}
+
+func (self *IsNullExpression) EndIndex() uint64 {
+	return self.NullIndex + 4
+}
+
+type InExpression struct {
+	_Expression_
+	Expr             Expression
+	Not              bool
+	List             []Expression
+	RightParenthesis uint64
+}
+
+func (self *InExpression) StartIndex() uint64 {
+	return self.Expr.StartIndex()
+}
+
+func (self *InExpression) EndIndex() uint64 {
+	return self.RightParenthesis + 1
+}
+
+type BetweenExpression struct {
+	_Expression_
+	Expr Expression
+	Not  bool
+	Low  Expression
+	High Expression
+}
+
+func (self *BetweenExpression) StartIndex() uint64 {
+	return self.Expr.StartIndex()
+}
+
+func (self *BetweenExpression) EndIndex() uint64 {
+	return self.High.EndIndex()
+}
+
+type LikeExpression struct {
+	_Expression_
+	Expr    Expression
+	Not     bool
+	Pattern Expression
+}
+
+func (self *LikeExpression) StartIndex() uint64 {
+	return self.Expr.StartIndex()
+}
+
+func (self *LikeExpression) EndIndex() uint64 {
+	return self.Pattern.EndIndex()
+}
@@ -0,0 +1,139 @@
+package ast
+
+type BeginStatement struct {
+	_Statement_
+
+	BeginIndex uint64
+	KeyWord    *Identifier
+}
+
+func (self *BeginStatement) StartIndex() uint64 {
+	return self.BeginIndex
+}
+
+func (self *BeginStatement) EndIndex() uint64 {
+	return self.KeyWord.EndIndex()
+}
+
+type CommitStatement struct {
+	_Statement_
+
+	CommitIndex uint64
+	KeyWord     *Identifier
+}
+
+func (self *CommitStatement) StartIndex() uint64 {
+	return self.CommitIndex
+}
+
+func (self *CommitStatement) EndIndex() uint64 {
+	return self.KeyWord.EndIndex()
+}
+
+type RollbackStatement struct {
+	_Statement_
+
+	RollbackIndex uint64
+	KeyWord       *Identifier
+	Savepoint     *Identifier //ROLLBACK TO SAVEPOINT的保存点, 为nil时回滚整个事务
+}
+
+func (self *RollbackStatement) StartIndex() uint64 {
+	return self.RollbackIndex
+}
+
+func (self *RollbackStatement) EndIndex() uint64 {
+	if self.Savepoint != nil {
+		return self.Savepoint.EndIndex()
+	}
+	return self.KeyWord.EndIndex()
+}
+
+type SavepointStatement struct {
+	_Statement_
+
+	SavepointIndex uint64
+	Name           *Identifier
+}
+
+func (self *SavepointStatement) StartIndex() uint64 {
+	return self.SavepointIndex
+}
+
+func (self *SavepointStatement) EndIndex() uint64 {
+	return self.Name.EndIndex()
+}
+
+type ReleaseSavepointStatement struct {
+	_Statement_
+
+	ReleaseIndex uint64
+	Name         *Identifier
+}
+
+func (self *ReleaseSavepointStatement) StartIndex() uint64 {
+	return self.ReleaseIndex
+}
+
+func (self *ReleaseSavepointStatement) EndIndex() uint64 {
+	return self.Name.EndIndex()
+}
+
+type SetTransactionStatement struct {
+	_Statement_
+
+	SetIndex       uint64
+	Scope          *Identifier   //GLOBAL或SESSION, 为nil时只对下一个事务生效
+	IsolationLevel []*Identifier //隔离级别的单词
+}
+
+func (self *SetTransactionStatement) StartIndex() uint64 {
+	return self.SetIndex
+}
+
+func (self *SetTransactionStatement) EndIndex() uint64 {
+	return self.IsolationLevel[len(self.IsolationLevel)-1].EndIndex()
+}
+
+type XaStatementType int
+
+const (
+	_ XaStatementType = iota
+	XaStart
+	XaEnd
+	XaPrepare
+	XaCommit
+	XaRollback
+	XaRecover
+)
+
+// XA事务的语句, xid由gtrid, bqual和formatID组成, XA RECOVER没有xid
+type XaStatement struct {
+	_Statement_
+
+	XaIndex  uint64
+	Type     XaStatementType
+	KeyWord  *Identifier //最后一个关键字
+	Gtrid    *StringLiteral
+	Bqual    *StringLiteral
+	FormatId *NumberLiteral
+	OnePhase bool
+}
+
+func (self *XaStatement) StartIndex() uint64 {
+	return self.XaIndex
+}
+
+func (self *XaStatement) EndIndex() uint64 {
+	endIndex := self.KeyWord.EndIndex()
+	if self.Gtrid != nil {
+		endIndex = max(endIndex, self.Gtrid.EndIndex())
+	}
+	if self.Bqual != nil {
+		endIndex = max(endIndex, self.Bqual.EndIndex())
+	}
+	if self.FormatId != nil {
+		endIndex = max(endIndex, self.FormatId.EndIndex())
+	}
+	return endIndex
+}
@@ -5,6 +5,7 @@ import (
 	"Relatdb/parser/token"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 func (self *Parser) parseExpression() ast.Expression {
@@ -40,9 +41,10 @@ func (self *Parser) parseLogicalOrExpression() ast.Expression {
 
 	for {
 		switch self.token {
-		case token.OR:
+		case token.OR, token.LOGICAL_OR:
+			self.expectToken(self.token)
 			left = &ast.BinaryExpression{
-				Operator: self.expectToken(self.token),
+				Operator: token.OR,
 				Left:     left,
 				Right:    self.parseLogicalAndExpression(),
 			}
@@ -53,15 +55,16 @@ func (self *Parser) parseLogicalOrExpression() ast.Expression {
 }
 
 func (self *Parser) parseLogicalAndExpression() ast.Expression {
-	left := self.parseEqualityExpression()
+	left := self.parseLogicalNotExpression()
 
 	for {
 		switch self.token {
-		case token.AND:
+		case token.AND, token.LOGICAL_AND:
+			self.expectToken(self.token)
 			left = &ast.BinaryExpression{
-				Operator: self.expectToken(self.token),
+				Operator: token.AND,
 				Left:     left,
-				Right:    self.parseEqualityExpression(),
+				Right:    self.parseLogicalNotExpression(),
 			}
 		default:
 			return left
@@ -69,11 +72,23 @@ func (self *Parser) parseLogicalAndExpression() ast.Expression {
 	}
 }
 
+// NOT的优先级低于比较运算符: NOT a = 1 等价于 NOT (a = 1)
+func (self *Parser) parseLogicalNotExpression() ast.Expression {
+	if self.token == token.NOT {
+		return &ast.UnaryExpression{
+			Index:    self.expect(token.NOT),
+			Operator: token.NOT,
+			Operand:  self.parseLogicalNotExpression(),
+		}
+	}
+	return self.parseEqualityExpression()
+}
+
 func (self *Parser) parseEqualityExpression() ast.Expression {
 	left := self.parseRelationalExpression()
 
 	for {
-		if self.token == token.EQUAL || self.token == token.NOT_EQUAL || (self.scope.inWhere && self.token == token.ASSIGN) {
+		if self.token == token.EQUAL || self.token == token.NOT_EQUAL || ((self.scope.inWhere || self.scope.inSelectField) && self.token == token.ASSIGN) {
 			left = &ast.BinaryExpression{
 				Operator: self.expectToken(self.token),
 				Left:     left,
@@ -96,12 +111,73 @@ func (self *Parser) parseRelationalExpression() ast.Expression {
 				Left:     left,
 				Right:    self.parseAdditiveExpression(),
 			}
+		case token.IS:
+			left = self.parseIsNullExpression(left)
+		case token.IN, token.BETWEEN, token.LIKE:
+			left = self.parsePredicateExpression(left, false)
+		case token.NOT:
+			//NOT IN, NOT BETWEEN, NOT LIKE
+			parseState := self.markParseState()
+			self.expectToken(token.NOT)
+			if self.token != token.IN && self.token != token.BETWEEN && self.token != token.LIKE {
+				self.restoreParseState(parseState)
+				return left
+			}
+			left = self.parsePredicateExpression(left, true)
 		default:
 			return left
 		}
 	}
 }
 
+func (self *Parser) parseIsNullExpression(left ast.Expression) ast.Expression {
+	self.expectToken(token.IS)
+	isNullExpression := &ast.IsNullExpression{
+		Expr: left,
+		Not:  self.expectEqualsToken(token.NOT),
+	}
+	isNullExpression.NullIndex = self.expect(token.NULL)
+	return isNullExpression
+}
+
+func (self *Parser) parsePredicateExpression(left ast.Expression, not bool) ast.Expression {
+	switch self.token {
+	case token.IN:
+		self.expectToken(token.IN)
+		inExpression := &ast.InExpression{
+			Expr: left,
+			Not:  not,
+		}
+		self.expectToken(token.LEFT_PARENTHESIS)
+		for {
+			inExpression.List = append(inExpression.List, self.parseAdditiveExpression())
+			if self.token != token.COMMA {
+				break
+			}
+			self.expectToken(token.COMMA)
+		}
+		inExpression.RightParenthesis = self.expect(token.RIGHT_PARENTHESIS)
+		return inExpression
+	case token.BETWEEN:
+		self.expectToken(token.BETWEEN)
+		betweenExpression := &ast.BetweenExpression{
+			Expr: left,
+			Not:  not,
+			Low:  self.parseAdditiveExpression(),
+		}
+		self.expectToken(token.AND)
+		betweenExpression.High = self.parseAdditiveExpression()
+		return betweenExpression
+	default:
+		self.expectToken(token.LIKE)
+		return &ast.LikeExpression{
+			Expr:    left,
+			Not:     not,
+			Pattern: self.parseAdditiveExpression(),
+		}
+	}
+}
+
 func (parser *Parser) parseAdditiveExpression() ast.Expression {
 	left := parser.parseMultiplicativeExpression()
 
@@ -140,7 +216,7 @@ func (parser *Parser) parseUnaryExpression() ast.Expression {
 
 	tkn := parser.token
 	switch tkn {
-	case token.NOT, token.ADDITION, token.SUBTRACT:
+	case token.NOT_ARITHMETIC, token.ADDITION, token.SUBTRACT:
 		unaryExpression := &ast.UnaryExpression{
 			Index:    parser.expect(tkn),
 			Operator: tkn,
@@ -173,11 +249,6 @@ func (parser *Parser) parseLeftHandSideExpressionAllowCall(stopTokens []token.To
 				left = columnName.Name
 			}
 			left = parser.parseCallExpression(left)
-			if parser.scope.inSelectField {
-				identifier := left.(*ast.CallExpression).Callee.(*ast.Identifier)
-				identifier.Name += "()"
-				left = identifier
-			}
 			continue
 		}
 		break
@@ -205,7 +276,15 @@ func (self *Parser) parsePrimaryExpression() ast.Expression {
 			expr = self.parseIdentifier()
 		}
 	case token.LEFT_PARENTHESIS:
-		expr = self.parseSubqueryExpression()
+		parseState := self.markParseState()
+		self.expectToken(token.LEFT_PARENTHESIS)
+		isSubquery := self.token == token.SELECT
+		self.restoreParseState(parseState)
+		if isSubquery {
+			expr = self.parseSubqueryExpression()
+		} else {
+			expr = self.parseParenthesizedExpression()
+		}
 	case token.AT_IDENTIFIER:
 		atIndex := self.expect(token.AT_IDENTIFIER)
 		if self.token == token.AT_IDENTIFIER {
@@ -259,7 +338,8 @@ func (self *Parser) parseStringLiteral() *ast.StringLiteral {
 	return &ast.StringLiteral{
 		Index:   self.index,
 		Literal: self.literal,
-		Value:   self.value,
+		Value:   strings.ToLower(self.value),
+		Text:    self.value,
 	}
 }
 
@@ -331,7 +411,11 @@ func (self *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 func (self *Parser) parseArguments() (leftParenthesis uint64, arguments []ast.Expression, rightParenthesis uint64) {
 	leftParenthesis = self.expect(token.LEFT_PARENTHESIS)
 	for self.token != token.RIGHT_PARENTHESIS {
-		arguments = append(arguments, self.parseExpression())
+		if self.token == token.MULTIPLY {
+			arguments = append(arguments, self.parseKeyWordIdentifier(token.MULTIPLY))
+		} else {
+			arguments = append(arguments, self.parseExpression())
+		}
 		if self.token != token.COMMA {
 			break
 		}
@@ -461,6 +545,14 @@ func (self *Parser) parseOnCondition() *ast.OnCondition {
 	}
 }
 
+// 括号只改变运算顺序, 直接返回括号内的表达式
+func (self *Parser) parseParenthesizedExpression() ast.Expression {
+	self.expectToken(token.LEFT_PARENTHESIS)
+	expr := self.parseExpression()
+	self.expectToken(token.RIGHT_PARENTHESIS)
+	return expr
+}
+
 func (self *Parser) parseSubqueryExpression() ast.ResultSet {
 	subqueryExpression := &ast.SubqueryExpression{
 		LeftParenthesis:  self.expect(token.LEFT_PARENTHESIS),
@@ -474,7 +566,7 @@ func (self *Parser) parseTableSource() ast.ResultSet {
 	tableSource := &ast.TableSource{
 		TableName: self.parseTableName(),
 	}
-	if self.expectEqualsToken(token.AS) || self.token == token.IDENTIFIER {
+	if self.expectEqualsToken(token.AS) || self.token == token.IDENTIFIER && !self.isLockClause() {
 		tableSource.AsName = self.parseIdentifier()
 	}
 	return tableSource
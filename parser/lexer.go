@@ -122,7 +122,7 @@ func (self *Parser) scan() (tkn token.Token, literal string, value string, index
 				tkn, literal, value = token.SEMICOLON, string(chr), string(chr)
 				break
 			case '!':
-				tkn = self.switchToken("=", token.NOT_EQUAL, token.NOT)
+				tkn = self.switchToken("=", token.NOT_EQUAL, token.NOT_ARITHMETIC)
 				literal = tkn.String()
 				value = tkn.String()
 				break
@@ -132,7 +132,7 @@ func (self *Parser) scan() (tkn token.Token, literal string, value string, index
 				value = tkn.String()
 				break
 			case '<':
-				tkn = self.switchToken("=", token.LESS_OR_EQUAL, token.LESS)
+				tkn = self.switchToken("=,>", token.LESS_OR_EQUAL, token.NOT_EQUAL, token.LESS)
 				literal = tkn.String()
 				value = tkn.String()
 				break
@@ -187,8 +187,9 @@ func (self *Parser) scanByFilter(filter func(rune) bool) string {
 	return self.content[chrOffset:self.chrOffset]
 }
 
+// 关键字和标识符不区分大小写, 统一转换为小写
 func (self *Parser) scanIdentifier() string {
-	return self.scanByFilter(isIdentifierPart)
+	return strings.ToLower(self.scanByFilter(isIdentifierPart))
 }
 
 func (self *Parser) scanNumericLiteral() string {
@@ -4,7 +4,6 @@ import (
 	"Relatdb/parser/ast"
 	token "Relatdb/parser/token"
 	"fmt"
-	"strings"
 )
 
 type Scope struct {
@@ -38,7 +37,7 @@ func CreateParser(baseOffset uint64, content string, skipComment bool, skipWhite
 		baseOffset:     baseOffset,
 		skipComment:    skipComment,
 		skipWhiteSpace: skipWhiteSpace,
-		content:        strings.ToLower(content),
+		content:        content,
 		length:         uint64(len(content)),
 		chr:            ' ',
 	}
@@ -1,6 +1,9 @@
 package parser
 
-import "testing"
+import (
+	"Relatdb/parser/ast"
+	"testing"
+)
 
 func TestParser(t *testing.T) {
 	parser := CreateParser(0, `
@@ -15,6 +18,16 @@ func TestParser(t *testing.T) {
     		age INT UNSIGNED DEFAULT 1 COMMENT '年龄',
     		noId INT(6) ZEROFILL
 		);
+		CREATE TABLE Account(
+		    id INT,
+		    name VARCHAR(20) UNIQUE KEY,
+		    email VARCHAR(50),
+		    age INT,
+		    PRIMARY KEY (id),
+		    UNIQUE KEY uk_email (email),
+		    KEY idx_age (age, name),
+		    INDEX (age)
+		);
 		CREATE INDEX idx_name on myBase.User(name);
 		CREATE UNIQUE INDEX idx_name on myBase.User(name);
 		CREATE SPATIAL INDEX idx_name on myBase.User(name);
@@ -30,7 +43,47 @@ func TestParser(t *testing.T) {
 		UPDATE myBase.User SET name = '更新名称',age = 1 WHERE name = '名称' ORDER BY age DESC LIMIT 0,10;
 		SELECT CONNECTION_ID();
 		select *,SUM(1) from t1 join t2 left join t3 on t2.id = t3.id WHERE t1.name = '名称' ORDER BY t1.age DESC LIMIT 0,10;
+		SELECT age,COUNT(*) c FROM myBase.User WHERE (age > 1 || age IS NOT NULL) && name NOT LIKE 'a%' AND id NOT IN (1,2) AND age BETWEEN 1 AND 10 GROUP BY age HAVING c <> 1;
+		BEGIN;
+		START TRANSACTION;
+		COMMIT WORK;
+		ROLLBACK;
+		SAVEPOINT sp1;
+		ROLLBACK TO SAVEPOINT sp1;
+		ROLLBACK WORK TO sp1;
+		RELEASE SAVEPOINT sp1;
+		XA START 'trx-1';
+		XA END 'trx-1' SUSPEND FOR MIGRATE;
+		XA PREPARE 'trx-1', 'branch', 2;
+		XA COMMIT 'trx-1' ONE PHASE;
+		xa rollback 'trx-1', '';
+		XA RECOVER CONVERT XID;
+		FLUSH LOGS;
+		BACKUP DATABASE TO '/backup/full';
+		backup database myBase to '/backup/myBase';
+		SET autocommit = 0;
+		SET GLOBAL autocommit = 1;
+		SET session = 1;
+		SET TRANSACTION ISOLATION LEVEL READ COMMITTED;
+		SET SESSION TRANSACTION ISOLATION LEVEL SERIALIZABLE;
+		set global transaction isolation level repeatable read;
+		SELECT * FROM myBase.User WHERE id = 1 FOR UPDATE;
+		SELECT * FROM myBase.User u LIMIT 1 LOCK IN SHARE MODE;
+		select * from User for share;
 `, true, true)
 	statements := parser.Parse()
 	println(statements)
 }
+
+// 字符串的值转换为小写, 原来的内容保留在Text中
+func TestStringLiteral(t *testing.T) {
+	statements := CreateParser(0, "BACKUP DATABASE TO '/Backup/Full'; SELECT 'AbC';", true, true).Parse()
+	dir := statements[0].(*ast.BackupStatement).Dir
+	if dir.Value != "/backup/full" || dir.Text != "/Backup/Full" || dir.Literal != "'/Backup/Full'" {
+		t.Fatalf("unexpected backup directory: %+v", dir)
+	}
+	value := statements[1].(*ast.SelectStatement).Fields[0].Expr.(*ast.StringLiteral)
+	if value.Value != "abc" || value.Text != "AbC" {
+		t.Fatalf("unexpected string literal: %+v", value)
+	}
+}
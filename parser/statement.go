@@ -6,6 +6,7 @@ import (
 	"Relatdb/parser/token"
 	"Relatdb/utils"
 	"fmt"
+	"strings"
 )
 
 func (self *Parser) parseStatement() ast.Statement {
@@ -31,6 +32,22 @@ func (self *Parser) parseStatement() ast.Statement {
 		return self.parseUpdateStatement()
 	case token.SELECT:
 		return self.parseSelectStatement()
+	case token.BEGIN, token.START:
+		return self.parseBeginStatement()
+	case token.COMMIT:
+		return self.parseCommitStatement()
+	case token.ROLLBACK:
+		return self.parseRollbackStatement()
+	case token.SAVEPOINT:
+		return self.parseSavepointStatement()
+	case token.RELEASE:
+		return self.parseReleaseSavepointStatement()
+	case token.XA:
+		return self.parseXaStatement()
+	case token.FLUSH:
+		return self.parseFlushStatement()
+	case token.BACKUP:
+		return self.parseBackupStatement()
 	default:
 		return self.parseExpressionStatement()
 	}
@@ -73,8 +90,9 @@ func (self *Parser) parseShowStatement() ast.Statement {
 			Type:      ast.ShowTables,
 			KeyWord:   self.parseKeyWordIdentifier(self.token),
 		}
-		self.expectToken(token.FROM)
-		showStatement.TableName = self.parseTableName()
+		if self.expectEqualsToken(token.FROM) {
+			showStatement.TableName = self.parseTableName()
+		}
 		return showStatement
 	default:
 		self.errorUnexpectedToken(self.token)
@@ -82,6 +100,26 @@ func (self *Parser) parseShowStatement() ast.Statement {
 	}
 }
 
+// FLUSH LOGS: 切换到新的日志段并写入检查点
+func (self *Parser) parseFlushStatement() ast.Statement {
+	return &ast.FlushStatement{
+		FlushIndex: self.expect(token.FLUSH),
+		Option:     self.expectIdentifierName("LOGS"),
+	}
+}
+
+// BACKUP DATABASE [name] TO 'dir': 在线备份到目录
+func (self *Parser) parseBackupStatement() ast.Statement {
+	backupStatement := &ast.BackupStatement{BackupIndex: self.expect(token.BACKUP)}
+	self.expectToken(token.DATABASE)
+	if !self.isIdentifierName("TO") {
+		backupStatement.Database = self.parseStringLiteralOrIdentifier()
+	}
+	self.expectIdentifierName("TO")
+	backupStatement.Dir = self.parseStringLiteral()
+	return backupStatement
+}
+
 func (self *Parser) parseUseStatement() ast.Statement {
 	useIndex := self.expect(token.USE)
 	return &ast.UseStatement{
@@ -90,17 +128,67 @@ func (self *Parser) parseUseStatement() ast.Statement {
 	}
 }
 
+/*
+SET [GLOBAL | SESSION] name = value
+SET [GLOBAL | SESSION] TRANSACTION ISOLATION LEVEL level
+GLOBAL和SESSION不是保留字, 后面是赋值时作为变量名
+*/
 func (self *Parser) parseSetVariableStatement() ast.Statement {
 	setIndex := self.expect(token.SET)
+	var scope *ast.Identifier
+	if self.isIdentifierName("GLOBAL") || self.isIdentifierName("SESSION") {
+		scope = self.parseIdentifier()
+		if self.token == token.ASSIGN {
+			return self.parseSetVariableValue(setIndex, nil, scope)
+		}
+	}
+	if self.token == token.TRANSACTION {
+		return self.parseSetTransactionStatement(setIndex, scope)
+	}
+	return self.parseSetVariableValue(setIndex, scope, self.parseIdentifier())
+}
+
+func (self *Parser) parseSetVariableValue(setIndex uint64, scope *ast.Identifier, name *ast.Identifier) ast.Statement {
 	setVariableStatement := &ast.SetVariableStatement{
 		SetIndex: setIndex,
-		Name:     self.parseIdentifier(),
+		Scope:    scope,
+		Name:     name,
 	}
 	self.expectEqualsToken(token.ASSIGN)
 	setVariableStatement.Value = self.parseExpression()
 	return setVariableStatement
 }
 
+// TRANSACTION ISOLATION LEVEL {READ UNCOMMITTED | READ COMMITTED | REPEATABLE READ | SERIALIZABLE}
+func (self *Parser) parseSetTransactionStatement(setIndex uint64, scope *ast.Identifier) ast.Statement {
+	self.expect(token.TRANSACTION)
+	self.expectIdentifierName("ISOLATION")
+	self.expectIdentifierName("LEVEL")
+	setTransactionStatement := &ast.SetTransactionStatement{
+		SetIndex: setIndex,
+		Scope:    scope,
+	}
+	for self.token == token.IDENTIFIER {
+		setTransactionStatement.IsolationLevel = append(setTransactionStatement.IsolationLevel, self.parseIdentifier())
+	}
+	if len(setTransactionStatement.IsolationLevel) == 0 {
+		self.errorUnexpectedToken(self.token)
+	}
+	return setTransactionStatement
+}
+
+// 当前是名称为name的标识符, 用于不是保留字的关键字
+func (self *Parser) isIdentifierName(name string) bool {
+	return self.token == token.IDENTIFIER && strings.EqualFold(self.value, name)
+}
+
+func (self *Parser) expectIdentifierName(name string) *ast.Identifier {
+	if !self.isIdentifierName(name) {
+		self.errorUnexpectedMsg(fmt.Sprintf("Unexpected token %v, expected %s", self.token, name))
+	}
+	return self.parseIdentifier()
+}
+
 func (self *Parser) parseCreateStatement() ast.Statement {
 	createIndex := self.expect(token.CREATE)
 	switch self.token {
@@ -127,24 +215,59 @@ func (self *Parser) parseCreateDatabaseStatement(createIndex uint64) ast.Stateme
 
 func (self *Parser) parseCreateTableStatement(createIndex uint64) ast.Statement {
 	self.expectToken(token.TABLE)
-	return &ast.CreateTableStatement{
-		CreateIndex:       createIndex,
-		IfNotExists:       self.expectEqualsToken(token.IF) && self.expectEqualsToken(token.NOT) && self.expectEqualsToken(token.EXISTS),
-		Name:              self.parseTableName(),
-		ColumnDefinitions: self.parseColumnDefinitions(),
-		RightParenthesis:  self.expect(token.RIGHT_PARENTHESIS),
+	createTableStatement := &ast.CreateTableStatement{
+		CreateIndex: createIndex,
+		IfNotExists: self.expectEqualsToken(token.IF) && self.expectEqualsToken(token.NOT) && self.expectEqualsToken(token.EXISTS),
+		Name:        self.parseTableName(),
 	}
+	createTableStatement.ColumnDefinitions, createTableStatement.Constraints = self.parseTableElements()
+	createTableStatement.RightParenthesis = self.expect(token.RIGHT_PARENTHESIS)
+	return createTableStatement
 }
 
-func (self *Parser) parseColumnDefinitions() (columnDefinitions []*ast.ColumnDefinition) {
+// 字段定义和表级的键约束, 可以交替出现
+func (self *Parser) parseTableElements() (columnDefinitions []*ast.ColumnDefinition, constraints []*ast.ConstraintDefinition) {
 	self.expectToken(token.LEFT_PARENTHESIS)
 	for self.token != token.RIGHT_PARENTHESIS && self.token != token.EOF {
-		columnDefinitions = append(columnDefinitions, self.parseColumnDefinition())
+		switch self.token {
+		case token.PRIMARY, token.UNIQUE, token.KEY, token.INDEX:
+			constraints = append(constraints, self.parseConstraintDefinition())
+		default:
+			columnDefinitions = append(columnDefinitions, self.parseColumnDefinition())
+		}
 		self.expectEqualsToken(token.COMMA)
 	}
 	return
 }
 
+func (self *Parser) parseConstraintDefinition() *ast.ConstraintDefinition {
+	constraintDefinition := &ast.ConstraintDefinition{
+		Index: self.index,
+	}
+	switch self.token {
+	case token.PRIMARY:
+		self.expectToken(token.PRIMARY)
+		self.expectToken(token.KEY)
+		constraintDefinition.Type = ast.ConstraintPrimaryKey
+	case token.UNIQUE:
+		self.expectToken(token.UNIQUE)
+		if !self.expectEqualsToken(token.KEY) {
+			self.expectEqualsToken(token.INDEX)
+		}
+		constraintDefinition.Type = ast.ConstraintUniqueKey
+	default:
+		self.expectToken(self.token)
+		constraintDefinition.Type = ast.ConstraintKey
+	}
+	if constraintDefinition.Type != ast.ConstraintPrimaryKey && self.token != token.LEFT_PARENTHESIS {
+		constraintDefinition.Name = self.parseIdentifier()
+	}
+	self.expectToken(token.LEFT_PARENTHESIS)
+	constraintDefinition.ColumnNames = self.parseColumnNames()
+	constraintDefinition.RightParenthesis = self.expect(token.RIGHT_PARENTHESIS)
+	return constraintDefinition
+}
+
 func (self *Parser) parseColumnDefinition() *ast.ColumnDefinition {
 	columnDefinition := &ast.ColumnDefinition{
 		Name: self.parseIdentifier(),
@@ -174,6 +297,7 @@ func (self *Parser) parseColumnDefinition() *ast.ColumnDefinition {
 		columnDefinition.Flag |= common.PRIMARY_KEY_FLAG
 	}
 	if self.expectEqualsToken(token.UNIQUE) {
+		self.expectEqualsToken(token.KEY)
 		columnDefinition.Flag |= common.UNIQUE_KEY_FLAG
 	}
 	if self.expectEqualsToken(token.UNSIGNED) {
@@ -328,7 +452,7 @@ func (self *Parser) parseUpdateStatement() ast.Statement {
 	}
 	self.expectToken(token.SET)
 	for {
-		updateStatement.AssignExpressions = append(updateStatement.AssignExpressions, self.parseAssignExpression())
+		updateStatement.AssignExpressions = append(updateStatement.AssignExpressions, self.parseAssignment())
 		if self.token != token.COMMA {
 			break
 		}
@@ -346,6 +470,16 @@ func (self *Parser) parseUpdateStatement() ast.Statement {
 	return updateStatement
 }
 
+// SET column = expr, 右边的表达式与WHERE相同: 标识符为字段名, =为比较
+func (self *Parser) parseAssignment() ast.Expression {
+	left := self.parseColumnName()
+	return &ast.AssignExpression{
+		Left:     left,
+		Operator: self.expectToken(token.ASSIGN),
+		Right:    self.parseWhereExpression(),
+	}
+}
+
 func (self *Parser) parseSelectStatement() *ast.SelectStatement {
 	defer func() { self.scope.inSelect = false }()
 	self.scope.inSelect = true
@@ -359,15 +493,48 @@ func (self *Parser) parseSelectStatement() *ast.SelectStatement {
 	if self.expectEqualsToken(token.WHERE) {
 		selectStatement.Where = self.parseWhereExpression()
 	}
+	if self.token == token.GROUP {
+		selectStatement.GroupBy = self.parseGroupByClause()
+	}
+	if self.token == token.HAVING {
+		selectStatement.Having = self.parseHavingClause()
+	}
 	if self.token == token.ORDER {
 		selectStatement.Order = self.parseOrderByClause()
 	}
 	if self.token == token.LIMIT {
 		selectStatement.Limit = self.parseLimit()
 	}
+	if self.isLockClause() {
+		selectStatement.Lock = self.parseLockClause()
+	}
 	return selectStatement
 }
 
+func (self *Parser) isLockClause() bool {
+	return self.isIdentifierName("FOR") || self.isIdentifierName("LOCK")
+}
+
+// FOR UPDATE | FOR SHARE | LOCK IN SHARE MODE
+func (self *Parser) parseLockClause() *ast.LockClause {
+	lockClause := &ast.LockClause{LockIndex: self.index}
+	if self.isIdentifierName("FOR") {
+		self.parseIdentifier()
+		if self.token == token.UPDATE {
+			lockClause.Exclusive = true
+			lockClause.EndWord = self.parseKeyWordIdentifier(token.UPDATE)
+		} else {
+			lockClause.EndWord = self.expectIdentifierName("SHARE")
+		}
+		return lockClause
+	}
+	self.expectIdentifierName("LOCK")
+	self.expect(token.IN)
+	self.expectIdentifierName("SHARE")
+	lockClause.EndWord = self.expectIdentifierName("MODE")
+	return lockClause
+}
+
 func (self *Parser) parseSelectField() *ast.SelectField {
 	defer func() { self.scope.inSelectField = false }()
 	self.scope.inSelectField = true
@@ -395,6 +562,22 @@ func (self *Parser) parseSelectFields() (selectFields []*ast.SelectField) {
 	return
 }
 
+func (self *Parser) parseGroupByClause() *ast.GroupByClause {
+	groupByClause := &ast.GroupByClause{
+		GroupByIndex: self.expect(token.GROUP),
+	}
+	self.expectToken(token.BY)
+	groupByClause.Items = self.parseColumnNames()
+	return groupByClause
+}
+
+func (self *Parser) parseHavingClause() *ast.HavingClause {
+	return &ast.HavingClause{
+		HavingIndex: self.expect(token.HAVING),
+		Expr:        self.parseWhereExpression(),
+	}
+}
+
 func (self *Parser) parseOrderByClause() *ast.OrderByClause {
 	orderByClause := &ast.OrderByClause{
 		OrderByIndex: self.expect(token.ORDER),
@@ -439,6 +622,140 @@ func (self *Parser) parseLimit() *ast.Limit {
 	return limit
 }
 
+// BEGIN [WORK] | START TRANSACTION
+func (self *Parser) parseBeginStatement() ast.Statement {
+	beginStatement := &ast.BeginStatement{BeginIndex: self.index}
+	if self.expectEqualsToken(token.START) {
+		beginStatement.KeyWord = self.parseKeyWordIdentifier(token.TRANSACTION)
+		return beginStatement
+	}
+	beginStatement.KeyWord = self.parseKeyWordIdentifier(token.BEGIN)
+	if self.token == token.WORK {
+		beginStatement.KeyWord = self.parseKeyWordIdentifier(token.WORK)
+	}
+	return beginStatement
+}
+
+// COMMIT [WORK]
+func (self *Parser) parseCommitStatement() ast.Statement {
+	commitStatement := &ast.CommitStatement{
+		CommitIndex: self.index,
+		KeyWord:     self.parseKeyWordIdentifier(token.COMMIT),
+	}
+	if self.token == token.WORK {
+		commitStatement.KeyWord = self.parseKeyWordIdentifier(token.WORK)
+	}
+	return commitStatement
+}
+
+// ROLLBACK [WORK] [TO [SAVEPOINT] name]
+func (self *Parser) parseRollbackStatement() ast.Statement {
+	rollbackStatement := &ast.RollbackStatement{
+		RollbackIndex: self.index,
+		KeyWord:       self.parseKeyWordIdentifier(token.ROLLBACK),
+	}
+	if self.token == token.WORK {
+		rollbackStatement.KeyWord = self.parseKeyWordIdentifier(token.WORK)
+	}
+	if self.isIdentifierName("TO") {
+		self.parseIdentifier()
+		self.expectEqualsToken(token.SAVEPOINT)
+		rollbackStatement.Savepoint = self.parseIdentifier()
+	}
+	return rollbackStatement
+}
+
+// SAVEPOINT name
+func (self *Parser) parseSavepointStatement() ast.Statement {
+	return &ast.SavepointStatement{
+		SavepointIndex: self.expect(token.SAVEPOINT),
+		Name:           self.parseIdentifier(),
+	}
+}
+
+// RELEASE SAVEPOINT name
+func (self *Parser) parseReleaseSavepointStatement() ast.Statement {
+	releaseSavepointStatement := &ast.ReleaseSavepointStatement{
+		ReleaseIndex: self.expect(token.RELEASE),
+	}
+	self.expectToken(token.SAVEPOINT)
+	releaseSavepointStatement.Name = self.parseIdentifier()
+	return releaseSavepointStatement
+}
+
+/*
+XA {START|BEGIN} xid [JOIN|RESUME]
+XA END xid [SUSPEND [FOR MIGRATE]]
+XA PREPARE xid
+XA COMMIT xid [ONE PHASE]
+XA ROLLBACK xid
+XA RECOVER [CONVERT XID]
+*/
+func (self *Parser) parseXaStatement() ast.Statement {
+	xaStatement := &ast.XaStatement{XaIndex: self.expect(token.XA)}
+	switch {
+	case self.token == token.START || self.token == token.BEGIN:
+		xaStatement.Type = ast.XaStart
+		xaStatement.KeyWord = self.parseKeyWordIdentifier(self.token)
+		self.parseXid(xaStatement)
+		if self.token == token.JOIN {
+			xaStatement.KeyWord = self.parseKeyWordIdentifier(token.JOIN)
+		} else if self.isIdentifierName("RESUME") {
+			xaStatement.KeyWord = self.parseIdentifier()
+		}
+	case self.isIdentifierName("END"):
+		xaStatement.Type = ast.XaEnd
+		xaStatement.KeyWord = self.parseIdentifier()
+		self.parseXid(xaStatement)
+		if self.isIdentifierName("SUSPEND") {
+			xaStatement.KeyWord = self.parseIdentifier()
+			if self.isIdentifierName("FOR") {
+				self.parseIdentifier()
+				xaStatement.KeyWord = self.expectIdentifierName("MIGRATE")
+			}
+		}
+	case self.isIdentifierName("PREPARE"):
+		xaStatement.Type = ast.XaPrepare
+		xaStatement.KeyWord = self.parseIdentifier()
+		self.parseXid(xaStatement)
+	case self.token == token.COMMIT:
+		xaStatement.Type = ast.XaCommit
+		xaStatement.KeyWord = self.parseKeyWordIdentifier(token.COMMIT)
+		self.parseXid(xaStatement)
+		if self.isIdentifierName("ONE") {
+			self.parseIdentifier()
+			xaStatement.KeyWord = self.expectIdentifierName("PHASE")
+			xaStatement.OnePhase = true
+		}
+	case self.token == token.ROLLBACK:
+		xaStatement.Type = ast.XaRollback
+		xaStatement.KeyWord = self.parseKeyWordIdentifier(token.ROLLBACK)
+		self.parseXid(xaStatement)
+	case self.isIdentifierName("RECOVER"):
+		xaStatement.Type = ast.XaRecover
+		xaStatement.KeyWord = self.parseIdentifier()
+		if self.isIdentifierName("CONVERT") {
+			self.parseIdentifier()
+			xaStatement.KeyWord = self.expectIdentifierName("XID")
+		}
+	default:
+		self.errorUnexpectedToken(self.token)
+	}
+	return xaStatement
+}
+
+// xid: gtrid [, bqual [, formatID]]
+func (self *Parser) parseXid(xaStatement *ast.XaStatement) {
+	xaStatement.Gtrid = self.parseStringLiteral()
+	if !self.expectEqualsToken(token.COMMA) {
+		return
+	}
+	xaStatement.Bqual = self.parseStringLiteral()
+	if self.expectEqualsToken(token.COMMA) {
+		xaStatement.FormatId = self.parseNumberLiteral()
+	}
+}
+
 func (self *Parser) parseExpressionStatement() ast.Statement {
 	return &ast.ExpressionStatement{
 		Expr: self.parseExpression(),
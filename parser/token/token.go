@@ -108,6 +108,7 @@ const (
 	OR             // or
 	BETWEEN        // between
 	LIKE           // like
+	IS             // is
 	DISTINCT       // distinct
 	UNION          // union
 	ALL            // all
@@ -119,6 +120,17 @@ const (
 	AUTO_INCREMENT // auto_increment
 	DEFAULT        // default
 	COLUMN_COMMENT // comment
+	BEGIN          // begin
+	START          // start
+	TRANSACTION    // transaction
+	COMMIT         // commit
+	ROLLBACK       // rollback
+	WORK           // work
+	SAVEPOINT      // savepoint
+	RELEASE        // release
+	XA             // xa
+	FLUSH          // flush
+	BACKUP         // backup
 
 	TINYINT   // tinyint
 	SMALLINT  // smallint
@@ -239,6 +251,7 @@ var tokenStringMap = [...]string{
 	OR:             "or",
 	BETWEEN:        "between",
 	LIKE:           "like",
+	IS:             "is",
 	DISTINCT:       "distinct",
 	UNION:          "union",
 	ALL:            "all",
@@ -250,6 +263,17 @@ var tokenStringMap = [...]string{
 	AUTO_INCREMENT: "auto_increment",
 	DEFAULT:        "default",
 	COLUMN_COMMENT: "comment",
+	BEGIN:          "begin",
+	START:          "start",
+	TRANSACTION:    "transaction",
+	COMMIT:         "commit",
+	ROLLBACK:       "rollback",
+	WORK:           "work",
+	SAVEPOINT:      "savepoint",
+	RELEASE:        "release",
+	XA:             "xa",
+	FLUSH:          "flush",
+	BACKUP:         "backup",
 	TINYINT:        "tinyint",
 	SMALLINT:       "smallint",
 	MEDIUMINT:      "mediumint",
@@ -319,6 +343,7 @@ var keywordMap = map[string]Token{
 	"or":             OR,
 	"between":        BETWEEN,
 	"like":           LIKE,
+	"is":             IS,
 	"distinct":       DISTINCT,
 	"union":          UNION,
 	"all":            ALL,
@@ -330,6 +355,17 @@ var keywordMap = map[string]Token{
 	"auto_increment": AUTO_INCREMENT,
 	"default":        DEFAULT,
 	"comment":        COLUMN_COMMENT,
+	"begin":          BEGIN,
+	"start":          START,
+	"transaction":    TRANSACTION,
+	"commit":         COMMIT,
+	"rollback":       ROLLBACK,
+	"work":           WORK,
+	"savepoint":      SAVEPOINT,
+	"release":        RELEASE,
+	"xa":             XA,
+	"flush":          FLUSH,
+	"backup":         BACKUP,
 	"tinyint":        TINYINT,
 	"smallint":       SMALLINT,
 	"mediumint":      MEDIUMINT,
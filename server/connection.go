@@ -1,6 +1,8 @@
 package server
 
 import (
+	"Relatdb/common"
+	"Relatdb/executor"
 	"Relatdb/parser"
 	"Relatdb/parser/ast"
 	"Relatdb/utils"
@@ -19,6 +21,8 @@ type Connection struct {
 	reader *bufio.Reader
 	writer *bufio.Writer
 	closed bool
+	//当前语句下一个响应包的序号, 出错时错误包接着已经写出的包编号
+	packetId byte
 
 	authPluginDataPart []byte
 	clientCapabilities uint32
@@ -37,6 +41,19 @@ func NewConnection(server *Server, conn net.Conn) *Connection {
 	}
 }
 
+func (self *Connection) GetConnectionId() uint64 {
+	return self.connId
+}
+
+func (self *Connection) GetUserName() string {
+	return self.userName
+}
+
+// 客户端要求UPDATE返回匹配的行数而不是实际修改的行数
+func (self *Connection) IsClientFoundRows() bool {
+	return self.clientCapabilities&CLIENT_FOUND_ROWS != 0
+}
+
 func (self *Connection) GetDatabase() string {
 	return self.database
 }
@@ -49,6 +66,7 @@ func (self *Connection) read(bytes []byte) []byte {
 	_, err := self.reader.Read(bytes)
 	if err != nil {
 		log.Println("conn read error:", err)
+		self.close()
 	}
 	return bytes
 }
@@ -62,23 +80,36 @@ func (self *Connection) readByte() byte {
 }
 
 func (self *Connection) write(bytes []byte) {
+	self.writeBuffered(bytes)
+	self.flush()
+}
+
+// 写入缓冲区, 缓冲区满时才会写出
+func (self *Connection) writeBuffered(bytes []byte) {
 	_, err := self.writer.Write(bytes)
 	if err != nil {
 		log.Println("conn write error:", err)
 	}
-	err = self.writer.Flush()
+}
+
+func (self *Connection) flush() {
+	err := self.writer.Flush()
 	if err != nil {
 		log.Println("conn write flush error:", err)
 	}
 }
 
 func (self *Connection) writeErrorMessage(packetId byte, errorCode uint16, message string) {
+	self.writeErrorPacket(packetId, errorCode, "HY000", message)
+}
+
+func (self *Connection) writeErrorPacket(packetId byte, errorCode uint16, sqlState string, message string) {
 	errorPacket := &ErrorPacket{}
 	errorPacket.PacketId = packetId
 	errorPacket.ErrorHeader = ERR_HEADER
 	errorPacket.ErrorCode = errorCode
 	errorPacket.SqlStateMarker = '#'
-	errorPacket.SqlState = []byte("HY000")
+	errorPacket.SqlState = []byte(sqlState)
 	errorPacket.Message = []byte(message)
 	packetBytes := errorPacket.GetPacketBytes()
 	self.write(packetBytes)
@@ -92,7 +123,7 @@ func (self *Connection) sendHandshakePacket() {
 		AuthPluginDataPart1: utils.RandomBytes(8),
 		ServerCapabilities:  self.server.getServerCapabilities(),
 		ServerCharsetIndex:  33,
-		ServerStatus:        2,
+		ServerStatus:        SERVER_STATUS_AUTOCOMMIT,
 		AuthPluginDataPart2: utils.RandomBytes(12),
 		AuthPluginName:      []byte("mysql_native_password"),
 	}
@@ -106,11 +137,23 @@ func (self *Connection) sendOkPacket(packetId byte, affectedRows uint64, insertI
 	okPacket.OkHeader = OK_HEADER
 	okPacket.AffectedRows = affectedRows
 	okPacket.InsertId = insertId
-	okPacket.ServerStatus = 2
+	okPacket.ServerStatus = self.getServerStatus()
 	okPacket.WarningCount = 0
 	self.sendDataPacket(okPacket)
 }
 
+// 根据会话的事务和自动提交状态生成状态标志
+func (self *Connection) getServerStatus() uint16 {
+	var serverStatus uint16
+	if self.session == nil || self.session.IsAutoCommit() {
+		serverStatus |= SERVER_STATUS_AUTOCOMMIT
+	}
+	if self.session != nil && self.session.GetTrx() != nil {
+		serverStatus |= SERVER_STATUS_IN_TRANS
+	}
+	return serverStatus
+}
+
 func (self *Connection) sendDataPacket(dataPacket DataPacket) {
 	packetBytes := dataPacket.GetPacketBytes()
 	self.write(packetBytes)
@@ -147,7 +190,7 @@ func (self *Connection) authentication() bool {
 	if self.database == "" {
 		self.database = "default"
 	}
-	self.session = NewSession()
+	self.session = NewSession(self.server.cloneGlobalVariables())
 	self.writeAuthOK()
 	return true
 }
@@ -239,7 +282,16 @@ func (self *Connection) heartbeat() {
 	self.ping()
 }
 
+// 关闭连接, 回滚没有提交的事务
 func (self *Connection) close() {
+	if self.closed {
+		return
+	}
+	if self.session != nil && self.session.GetTrx() != nil {
+		trx := self.session.GetTrx()
+		self.session.SetTrx(nil)
+		trx.Rollback(self.server.store)
+	}
 	self.server.removeConn(self.connId)
 	err := self.conn.Close()
 	if err != nil {
@@ -261,11 +313,16 @@ func (self *Connection) handlingQuery(querySql string) {
 	defer func() {
 		err := recover()
 		if err != nil {
-			errorMsg := fmt.Sprintf("handling sql error: sql=%s, err=%v\n", querySql, err)
-			log.Printf(errorMsg)
+			log.Printf("handling sql error: sql=%s, err=%v\n", querySql, err)
+			if sqlError, ok := err.(*common.SQLError); ok {
+				self.writeErrorPacket(self.packetId, sqlError.Code, sqlError.SqlState, sqlError.Message)
+				return
+			}
+			self.writeErrorMessage(self.packetId, ER_UNKNOWN_ERROR, fmt.Sprint(err))
 		}
 	}()
 	log.Printf("handling query: sql=%s", querySql)
+	self.packetId = 1
 	parser := parser.CreateParser(1, querySql, true, true)
 	stmts := parser.Parse()
 	stmtLength := len(stmts)
@@ -279,15 +336,36 @@ func (self *Connection) handlingQuery(querySql string) {
 }
 
 func (self *Connection) handlingStmt(ctx *Context, stmt ast.Statement, isLastStmt bool) {
+	self.packetId = 1
 	recordSet := ctx.executeStmt(stmt)
-	columns := recordSet.GetColumns()
-	rows := recordSet.GetRows()
-	if len(columns) != 0 || len(rows) != 0 {
-		selectPacket := NewTablePacket(columns, rows)
-		self.sendDataPacket(selectPacket)
+	defer recordSet.Close()
+	if recordSet.HasRows() {
+		self.sendRecordSet(recordSet)
 		return
 	}
-	self.sendOkPacket(0, recordSet.GetAffectedRows(), recordSet.GetInsertId())
+	self.sendOkPacket(self.packetId, recordSet.GetAffectedRows(), recordSet.GetInsertId())
+}
+
+/*
+逐行发送结果集, 行数据在产生时写出
+读取行出错时已经写出的包不能撤回, 由调用方接着发送错误包代替结尾的EOF包
+*/
+func (self *Connection) sendRecordSet(recordSet executor.RecordSet) {
+	columns := recordSet.GetColumns()
+	self.writeBuffered(NewResultSetHeaderPacket(self.packetId, uint64(len(columns))).GetPacketBytes())
+	self.packetId++
+	for _, column := range columns {
+		self.writeBuffered(NewColumnPacket(self.packetId, column).GetPacketBytes())
+		self.packetId++
+	}
+	self.writeBuffered(NewEofPacket(self.packetId, 0, self.getServerStatus()).GetPacketBytes())
+	self.packetId++
+	for row := recordSet.Next(); row != nil; row = recordSet.Next() {
+		self.writeBuffered(NewRowPacket(self.packetId, row).GetPacketBytes())
+		self.packetId++
+	}
+	self.writeBuffered(NewEofPacket(self.packetId, 0, self.getServerStatus()).GetPacketBytes())
+	self.flush()
 }
 
 func (self *Connection) handlingStmtPrepare() {
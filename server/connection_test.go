@@ -0,0 +1,103 @@
+package server
+
+import (
+	"Relatdb/common"
+	"Relatdb/meta"
+	"Relatdb/store"
+	"Relatdb/store/icna"
+	"Relatdb/transaction"
+	"Relatdb/utils"
+	"io"
+	"net"
+	"testing"
+)
+
+// 全表扫描读取到第failAt行时出错的存储
+type failingStore struct {
+	store.Store
+	failAt int
+}
+
+func (self *failingStore) Scan(view *transaction.ReadView, databaseName string, tableName string) meta.IndexIterator {
+	return &failingIterator{iterator: self.Store.Scan(view, databaseName, tableName), failAt: self.failAt}
+}
+
+type failingIterator struct {
+	iterator meta.IndexIterator
+	count    int
+	failAt   int
+}
+
+func (self *failingIterator) HasNext() bool {
+	return self.iterator.HasNext()
+}
+
+func (self *failingIterator) Next() meta.IndexEntry {
+	self.count++
+	if self.count == self.failAt {
+		panic(common.NewSQLError(common.ER_LOCK_WAIT_TIMEOUT, "HY000", "Lock wait timeout exceeded; try restarting transaction"))
+	}
+	return self.iterator.Next()
+}
+
+type testPacket struct {
+	packetId byte
+	data     []byte
+}
+
+func readTestPacket(t *testing.T, reader io.Reader) *testPacket {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		t.Fatal(err)
+	}
+	return &testPacket{packetId: header[3], data: data}
+}
+
+func newTestConnection(t *testing.T, store store.Store) (*Connection, net.Conn) {
+	store.Init()
+	t.Cleanup(store.Close)
+	server := NewServer(&Options{}, store)
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+		clientConn.Close()
+	})
+	conn := NewConnection(server, serverConn)
+	conn.database = "default"
+	conn.session = NewSession(server.cloneGlobalVariables())
+	return conn, clientConn
+}
+
+// 发送行的过程中出错时, 错误包接着已经发送的包编号, 不再发送结尾的EOF包
+func TestQueryErrorWhileStreaming(t *testing.T) {
+	store := &failingStore{Store: icna.NewIcnaStore(&icna.Options{Path: t.TempDir()}), failAt: 3}
+	conn, client := newTestConnection(t, store)
+	done := make(chan bool)
+	go func() {
+		conn.handlingQuery("create table T(id INT PRIMARY KEY)")
+		conn.handlingQuery("insert into T VALUES (1),(2),(3)")
+		conn.handlingQuery("select id from T")
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		if packet := readTestPacket(t, client); packet.packetId != 1 || packet.data[0] != OK_HEADER {
+			t.Fatalf("expected ok packet, got %v", packet)
+		}
+	}
+	//结果集头, 列, EOF和两行数据之后是错误包
+	for packetId := byte(1); packetId <= 5; packetId++ {
+		packet := readTestPacket(t, client)
+		if packet.packetId != packetId || packet.data[0] == ERR_HEADER {
+			t.Fatalf("unexpected packet %d: %v", packetId, packet)
+		}
+	}
+	packet := readTestPacket(t, client)
+	if packet.packetId != 6 || packet.data[0] != ERR_HEADER || utils.Uint16(packet.data[1:3], false) != common.ER_LOCK_WAIT_TIMEOUT {
+		t.Fatalf("expected error packet 6, got %v", packet)
+	}
+	<-done
+}
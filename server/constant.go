@@ -31,6 +31,14 @@ const (
 	CLIENT_PLUGIN_AUTH       = 0x00080000 // 认证插件
 )
 
+/*
+ * ServerStatus
+ */
+const (
+	SERVER_STATUS_IN_TRANS   = 0x0001 // 正在事务中
+	SERVER_STATUS_AUTOCOMMIT = 0x0002 // 自动提交模式
+)
+
 /*
  * Commond
  */
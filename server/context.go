@@ -24,6 +24,14 @@ func (self *Context) GetStore() store.Store {
 	return self.conn.server.store
 }
 
+func (self *Context) GetGlobalVariable(name string) string {
+	return self.conn.server.getGlobalVariable(name)
+}
+
+func (self *Context) SetGlobalVariable(name string, value string) {
+	self.conn.server.setGlobalVariable(name, value)
+}
+
 func NewContext(conn *Connection) *Context {
 	return &Context{
 		conn:    conn,
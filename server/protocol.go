@@ -208,7 +208,7 @@ func (self *OkPacket) GetPacketBytes() []byte {
 	buf.WriteByte(self.PacketId)
 	buf.WriteByte(self.OkHeader)
 	lengthEncodedInt(&buf, self.AffectedRows)
-	lengthEncodedInt(&buf, self.AffectedRows)
+	lengthEncodedInt(&buf, self.InsertId)
 	binary.Write(&buf, binary.LittleEndian, self.ServerStatus)
 	binary.Write(&buf, binary.LittleEndian, self.WarningCount)
 	bytes := buf.Bytes()
@@ -309,10 +309,10 @@ func (self *ColumnPacket) GetPacketBytes() []byte {
 		lengthEncodedString(&buf, self.OrgName)
 	}
 	buf.WriteByte(0x0c)
-	binary.Write(&buf, binary.LittleEndian, self.Charset)
-	binary.Write(&buf, binary.LittleEndian, self.Length)
+	binary.Write(&buf, binary.LittleEndian, uint16(self.Charset))
+	binary.Write(&buf, binary.LittleEndian, uint32(self.Length))
 	buf.WriteByte(byte(self.Type))
-	binary.Write(&buf, binary.LittleEndian, self.Flag)
+	binary.Write(&buf, binary.LittleEndian, uint16(self.Flag))
 	buf.WriteByte(self.Decimals)
 	filler := []byte{0, 0}
 	buf.Write(filler)
@@ -328,16 +328,30 @@ type RowPacket struct {
 	Values [][]byte
 }
 
+// 文本协议行数据, NULL值用nil表示
+func NewRowPacket(packetId byte, row []meta.Value) *RowPacket {
+	values := make([][]byte, len(row))
+	for i, value := range row {
+		if value != nil && value.GetType() != meta.NullValueType {
+			values[i] = []byte(value.ToString())
+		}
+	}
+	rowPacket := &RowPacket{
+		Values: values,
+	}
+	rowPacket.PacketId = packetId
+	return rowPacket
+}
+
 func (self *RowPacket) GetPacketBytes() []byte {
 	var buf bytes.Buffer
 	buf.WriteByte(self.PacketId)
 	nullMark := byte(251)
 	for _, value := range self.Values {
-		length := uint64(len(value))
-		if value == nil || length == 0 {
+		if value == nil {
 			buf.WriteByte(nullMark)
 		} else {
-			lengthEncodedInt(&buf, length)
+			lengthEncodedInt(&buf, uint64(len(value)))
 			buf.Write(value)
 		}
 	}
@@ -345,72 +359,37 @@ func (self *RowPacket) GetPacketBytes() []byte {
 	return append(getDataLengthBytes(uint32(len(bytes))-1), bytes...)
 }
 
-type TablePacket struct {
-	AbstractDataPacket
-	ColumnPackets    []*ColumnPacket
-	ColumnsEofPacket *EofPacket
-	RowPackets       []*RowPacket
-	RowsEofPacket    *EofPacket
-}
-
-func NewTablePacket(columns []meta.Value, rows [][]meta.Value) *TablePacket {
-	packetId := byte(2)
-	columnPackets := make([]*ColumnPacket, len(columns))
-	for i, column := range columns {
-		columnPacket := &ColumnPacket{
-			Catalog: CATALOG_VAL,
-			Name:    column.ToString(),
-			Type:    common.FIELD_TYPE_VAR_STRING,
-		}
-		columnPacket.PacketId = packetId
-		columnPackets[i] = columnPacket
-		packetId++
-	}
-	columnsEofPacket := NewEofPacket(packetId, 0, 2)
-	packetId++
-	rowPackets := make([]*RowPacket, len(rows))
-	for i, row := range rows {
-		values := make([][]byte, len(row))
-		for j, value := range row {
-			values[j] = value.ToValueBytes()
-		}
-		rowPacket := &RowPacket{
-			Values: values,
-		}
-		rowPacket.PacketId = packetId
-		rowPackets[i] = rowPacket
-		packetId++
-	}
-	rowsEofPacket := NewEofPacket(packetId, 0, 2)
-	selectPacket := &TablePacket{
-		ColumnPackets:    columnPackets,
-		ColumnsEofPacket: columnsEofPacket,
-		RowPackets:       rowPackets,
-		RowsEofPacket:    rowsEofPacket,
+func NewColumnPacket(packetId byte, column meta.Value) *ColumnPacket {
+	columnPacket := &ColumnPacket{
+		Catalog: CATALOG_VAL,
+		Name:    column.ToString(),
+		Charset: 33,
+		Type:    common.FIELD_TYPE_VAR_STRING,
 	}
-	selectPacket.PacketId = 1
-	return selectPacket
+	columnPacket.PacketId = packetId
+	return columnPacket
 }
 
-func (self *TablePacket) GetPacketBytes() []byte {
-	var buf bytes.Buffer
-	columnCount := uint64(len(self.ColumnPackets))
-	buf.Write(getDataLengthBytes(uint32(getIntLength(columnCount))))
-	buf.WriteByte(self.PacketId)
-	lengthEncodedInt(&buf, columnCount)
-
-	for _, columnPacket := range self.ColumnPackets {
-		bytes := columnPacket.GetPacketBytes()
-		buf.Write(bytes)
-	}
-	buf.Write(self.ColumnsEofPacket.GetPacketBytes())
+/*
+结果集头, 后面依次是: 列定义包... | EOF包 | 行数据包... | EOF包
+*/
+type ResultSetHeaderPacket struct {
+	AbstractDataPacket
+	ColumnCount uint64
+}
 
-	for _, rowPacket := range self.RowPackets {
-		bytes := rowPacket.GetPacketBytes()
-		buf.Write(bytes)
+func NewResultSetHeaderPacket(packetId byte, columnCount uint64) *ResultSetHeaderPacket {
+	headerPacket := &ResultSetHeaderPacket{
+		ColumnCount: columnCount,
 	}
-	buf.Write(self.RowsEofPacket.GetPacketBytes())
+	headerPacket.PacketId = packetId
+	return headerPacket
+}
 
+func (self *ResultSetHeaderPacket) GetPacketBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(self.PacketId)
+	lengthEncodedInt(&buf, self.ColumnCount)
 	bytes := buf.Bytes()
-	return bytes
+	return append(getDataLengthBytes(uint32(len(bytes))-1), bytes...)
 }
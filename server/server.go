@@ -1,9 +1,15 @@
 package server
 
 import (
+	"Relatdb/executor/context"
 	"Relatdb/store"
+	"Relatdb/transaction"
 	"fmt"
+	"maps"
 	"net"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type Options struct {
@@ -19,6 +25,9 @@ type Server struct {
 	autoConnId uint64
 	connMap    map[uint64]*Connection
 	store      store.Store
+
+	variableMutex   sync.Mutex
+	globalVariables map[string]string //新的会话从全局变量复制会话变量
 }
 
 func NewServer(options *Options, store store.Store) *Server {
@@ -29,10 +38,34 @@ func NewServer(options *Options, store store.Store) *Server {
 		autoConnId: 0,
 		connMap:    map[uint64]*Connection{},
 		store:      store,
+
+		globalVariables: map[string]string{
+			context.AUTO_COMMIT_VARIABLE:           "1",
+			context.TRANSACTION_ISOLATION_VARIABLE: transaction.DEFAULT_ISOLATION_LEVEL.String(),
+			context.LOCK_WAIT_TIMEOUT_VARIABLE:     strconv.Itoa(int(transaction.DEFAULT_LOCK_WAIT_TIMEOUT / time.Second)),
+		},
 	}
 	return server
 }
 
+func (self *Server) getGlobalVariable(name string) string {
+	self.variableMutex.Lock()
+	defer self.variableMutex.Unlock()
+	return self.globalVariables[name]
+}
+
+func (self *Server) setGlobalVariable(name string, value string) {
+	self.variableMutex.Lock()
+	defer self.variableMutex.Unlock()
+	self.globalVariables[name] = value
+}
+
+func (self *Server) cloneGlobalVariables() map[string]string {
+	self.variableMutex.Lock()
+	defer self.variableMutex.Unlock()
+	return maps.Clone(self.globalVariables)
+}
+
 func (self *Server) Start() {
 	self.store.Init()
 	bindAddress := fmt.Sprintf("%s:%d", self.options.BindIp, self.options.BindPort)
@@ -59,6 +92,7 @@ func (self *Server) Stop() {
 	if err != nil {
 		fmt.Println("Listening stop error:", err.Error())
 	}
+	self.store.Close()
 }
 
 func (self *Server) getServerCapabilities() uint32 {
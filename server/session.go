@@ -1,12 +1,18 @@
 package server
 
+import (
+	"Relatdb/executor/context"
+	"Relatdb/transaction"
+)
+
 type Session struct {
 	variableMap map[string]string
+	trx         *transaction.Trx //当前事务, 没有开始事务时为nil
 }
 
-func NewSession() *Session {
+func NewSession(variableMap map[string]string) *Session {
 	return &Session{
-		variableMap: make(map[string]string),
+		variableMap: variableMap,
 	}
 }
 
@@ -17,3 +23,15 @@ func (self *Session) GetVariable(name string) string {
 func (self *Session) SetVariable(name string, value string) {
 	self.variableMap[name] = value
 }
+
+func (self *Session) IsAutoCommit() bool {
+	return self.variableMap[context.AUTO_COMMIT_VARIABLE] == "1"
+}
+
+func (self *Session) GetTrx() *transaction.Trx {
+	return self.trx
+}
+
+func (self *Session) SetTrx(trx *transaction.Trx) {
+	self.trx = trx
+}
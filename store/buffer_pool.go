@@ -0,0 +1,302 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+const DEFAULT_BUFFER_POOL_SIZE = 1024
+
+type PageKey struct {
+	Path   string
+	PageNo int
+}
+
+type bufferFrame struct {
+	key        PageKey
+	page       *Page
+	pageStore  *PageStore
+	pinCount   int
+	referenced bool
+	oldestLsn  uint64 //页第一次变脏时的日志位置, 写回后清零
+}
+
+/*
+缓冲池: 按(文件, 页号)缓存页
+使用Clock算法淘汰没有被固定的干净页, 脏页只在FlushAll时成批写回文件
+没有可以淘汰的页时暂时超出容量, 并通知后台刷新, 刷新后收缩到容量以内
+单独写回一个脏页会使文件中的B+树不完整, 超出容量时由存储在下一次修改之前写回全部脏页
+脏页记录最早修改的日志位置, 检查点从最早的脏页开始重做
+*/
+type BufferPool struct {
+	mutex           sync.Mutex
+	capacity        int
+	frames          []*bufferFrame
+	frameMap        map[PageKey]*bufferFrame
+	clockHand       int
+	doubleWritePath string        //双写文件, 为空时直接写回
+	flushSignal     chan struct{} //超出容量时通知后台刷新
+	stop            chan struct{}
+	lsnSource       func() uint64 //当前的日志位置, 没有设置时脏页不记录日志位置
+	flushPaused     bool          //暂停写回脏页, 在线备份复制数据文件期间文件不变化
+	resumeCond      *sync.Cond    //恢复写回时唤醒等待写回的修改
+}
+
+func NewBufferPool(capacity int, doubleWritePath string) *BufferPool {
+	if capacity <= 0 {
+		capacity = DEFAULT_BUFFER_POOL_SIZE
+	}
+	bufferPool := &BufferPool{
+		capacity:        capacity,
+		frameMap:        make(map[PageKey]*bufferFrame),
+		doubleWritePath: doubleWritePath,
+		flushSignal:     make(chan struct{}, 1),
+	}
+	bufferPool.resumeCond = sync.NewCond(&bufferPool.mutex)
+	return bufferPool
+}
+
+/*
+设置日志位置的来源, 修改页之后才写入修改的日志
+页第一次变脏时的下一条日志位置不大于修改的日志位置, 从这里重做不会遗漏修改
+*/
+func (self *BufferPool) SetLsnSource(lsnSource func() uint64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.lsnSource = lsnSource
+}
+
+// 获取页并固定, 使用完后需要调用UnpinPage
+func (self *BufferPool) FetchPage(pageStore *PageStore, pageNo int) *Page {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	key := PageKey{Path: pageStore.GetPath(), PageNo: pageNo}
+	frame := self.frameMap[key]
+	if frame == nil {
+		frame = self.allocateFrame(key, pageStore)
+		frame.page = pageStore.ReadPage(pageNo)
+	}
+	frame.pinCount++
+	frame.referenced = true
+	return frame.page
+}
+
+func (self *BufferPool) UnpinPage(pageStore *PageStore, pageNo int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	frame := self.frameMap[PageKey{Path: pageStore.GetPath(), PageNo: pageNo}]
+	if frame != nil && frame.pinCount > 0 {
+		frame.pinCount--
+	}
+}
+
+// 放入一次修改的全部页, 页被标记为脏页, 由刷新写回文件
+func (self *BufferPool) PutPages(pageStore *PageStore, pages map[int]*Page) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for pageNo, page := range pages {
+		key := PageKey{Path: pageStore.GetPath(), PageNo: pageNo}
+		frame := self.frameMap[key]
+		if frame == nil {
+			frame = self.allocateFrame(key, pageStore)
+		}
+		page.Dirty = true
+		frame.page = page
+		frame.referenced = true
+		if frame.oldestLsn == 0 && self.lsnSource != nil {
+			frame.oldestLsn = self.lsnSource()
+		}
+	}
+}
+
+// 脏页中最早的修改的日志位置, 没有脏页时为0
+func (self *BufferPool) GetOldestDirtyLsn() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	var oldestLsn uint64
+	for _, frame := range self.frameMap {
+		if frame.isDirty() && frame.oldestLsn > 0 && (oldestLsn == 0 || frame.oldestLsn < oldestLsn) {
+			oldestLsn = frame.oldestLsn
+		}
+	}
+	return oldestLsn
+}
+
+// 分配页框, 缓冲池已满时淘汰一个干净页, 没有干净页时超出容量
+func (self *BufferPool) allocateFrame(key PageKey, pageStore *PageStore) *bufferFrame {
+	var frame *bufferFrame
+	if len(self.frames) >= self.capacity {
+		frame = self.evictFrame()
+	}
+	if frame == nil {
+		if len(self.frames) >= self.capacity {
+			select {
+			case self.flushSignal <- struct{}{}:
+			default:
+			}
+		}
+		frame = &bufferFrame{}
+		self.frames = append(self.frames, frame)
+	}
+	frame.key = key
+	frame.pageStore = pageStore
+	frame.pinCount = 0
+	frame.referenced = false
+	frame.oldestLsn = 0
+	self.frameMap[key] = frame
+	return frame
+}
+
+func (self *bufferFrame) isDirty() bool {
+	return self.page != nil && self.page.Dirty
+}
+
+// Clock淘汰: 跳过固定的页和脏页, 清除访问标记, 直到找到没有访问标记的页
+func (self *BufferPool) evictFrame() *bufferFrame {
+	for range len(self.frames) * 2 {
+		frame := self.frames[self.clockHand]
+		self.clockHand = (self.clockHand + 1) % len(self.frames)
+		if frame.pinCount > 0 || frame.isDirty() {
+			continue
+		}
+		if frame.referenced {
+			frame.referenced = false
+			continue
+		}
+		if self.frameMap[frame.key] == frame {
+			delete(self.frameMap, frame.key)
+		}
+		return frame
+	}
+	return nil
+}
+
+// 缓冲池中的页数量, 包括暂时超出容量的页
+func (self *BufferPool) GetPageCount() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.frames)
+}
+
+/*
+是否超出容量需要写回脏页, 暂停写回期间等待恢复之后再返回, 修改不会使缓冲池持续增长
+在修改之前调用, 返回true时调用方同步日志后调用FlushAll
+*/
+func (self *BufferPool) NeedFlush() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for self.flushPaused && len(self.frames) > self.capacity {
+		self.resumeCond.Wait()
+	}
+	return len(self.frames) > self.capacity
+}
+
+// 暂停写回脏页, 等待进行中的刷新结束, 之后脏页保留在缓冲池中直到恢复
+func (self *BufferPool) PauseFlush() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.flushPaused = true
+}
+
+func (self *BufferPool) ResumeFlush() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.flushPaused = false
+	self.resumeCond.Broadcast()
+}
+
+/*
+将全部脏页写回文件并同步到磁盘, 暂停期间不写回
+先将脏页写入双写文件, 写回中断时启动时从双写文件恢复, 保证文件中的页来自同一次刷新
+*/
+func (self *BufferPool) FlushAll() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	var frames []*bufferFrame
+	for _, frame := range self.frameMap {
+		if frame.isDirty() && !self.flushPaused {
+			frames = append(frames, frame)
+		}
+	}
+	if len(frames) > 0 {
+		if self.doubleWritePath != "" {
+			writeDoubleWrite(self.doubleWritePath, frames)
+		}
+		pageStores := make(map[*PageStore]bool)
+		for _, frame := range frames {
+			frame.pageStore.WritePage(frame.page, frame.key.PageNo)
+			frame.page.Dirty = false
+			frame.oldestLsn = 0
+			pageStores[frame.pageStore] = true
+		}
+		for pageStore := range pageStores {
+			pageStore.Sync()
+		}
+		if self.doubleWritePath != "" {
+			clearDoubleWrite(self.doubleWritePath)
+		}
+	}
+	self.shrink()
+}
+
+// 淘汰超出容量的干净页
+func (self *BufferPool) shrink() {
+	if len(self.frames) <= self.capacity {
+		return
+	}
+	frames := make([]*bufferFrame, 0, self.capacity)
+	for i, frame := range self.frames {
+		if len(self.frames)-i+len(frames) <= self.capacity || frame.pinCount > 0 || frame.isDirty() {
+			frames = append(frames, frame)
+			continue
+		}
+		if self.frameMap[frame.key] == frame {
+			delete(self.frameMap, frame.key)
+		}
+	}
+	self.frames = frames
+	self.clockHand = 0
+}
+
+// 丢弃文件的全部页, 用于删除文件之前
+func (self *BufferPool) DropFile(path string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for key, frame := range self.frameMap {
+		if key.Path != path {
+			continue
+		}
+		delete(self.frameMap, key)
+		frame.key = PageKey{}
+		frame.page = nil
+		frame.pinCount = 0
+		frame.referenced = false
+		frame.oldestLsn = 0
+	}
+}
+
+// 后台定时或超出容量时调用flush刷新脏页
+func (self *BufferPool) StartFlusher(interval time.Duration, flush func()) {
+	self.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-self.flushSignal:
+				flush()
+			case <-stop:
+				return
+			}
+		}
+	}(self.stop)
+}
+
+func (self *BufferPool) StopFlusher() {
+	if self.stop != nil {
+		close(self.stop)
+		self.stop = nil
+	}
+}
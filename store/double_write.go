@@ -0,0 +1,91 @@
+package store
+
+import (
+	"Relatdb/common"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+/*
+双写文件的格式:
+(PathLength(4) | Path | PageNo(4) | Page) * PageCount | PageCount(4) | CRC(4)
+Path为相对双写文件所在目录的路径, CRC为其前全部内容的校验和
+*/
+func writeDoubleWrite(path string, frames []*bufferFrame) {
+	dir := filepath.Dir(path)
+	size := 8
+	paths := make([]string, len(frames))
+	for i, frame := range frames {
+		relPath, err := filepath.Rel(dir, frame.key.Path)
+		if err != nil {
+			relPath = frame.key.Path
+		}
+		paths[i] = relPath
+		size += 4 + len(relPath) + 4 + DEFAULT_PAGE_SIZE
+	}
+	buffer := common.NewBufferBySize(uint(size))
+	for i, frame := range frames {
+		buffer.WriteInt(len(paths[i]))
+		buffer.WriteString(paths[i])
+		buffer.WriteInt(frame.key.PageNo)
+		buffer.WriteBytes(frame.page.Buffer.Data)
+	}
+	buffer.WriteInt(len(frames))
+	buffer.WriteInt(int(crc32.ChecksumIEEE(buffer.Data[:buffer.WriteIndex])))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	if _, err = file.Write(buffer.Data); err != nil {
+		panic(err)
+	}
+	if err = file.Sync(); err != nil {
+		panic(err)
+	}
+}
+
+func clearDoubleWrite(path string) {
+	if err := os.Truncate(path, 0); err != nil {
+		panic(err)
+	}
+}
+
+// 启动时将完整的双写文件重新写回, 双写文件不完整时说明数据文件还没有被修改
+func RecoverDoubleWrite(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) < 8 {
+		return
+	}
+	buffer := common.NewBuffer(data)
+	buffer.ReadIndex = uint(len(data) - 8)
+	pageCount := buffer.ReadInt()
+	checksum := uint32(buffer.ReadInt())
+	if crc32.ChecksumIEEE(data[:len(data)-4]) != checksum {
+		clearDoubleWrite(path)
+		return
+	}
+	dir := filepath.Dir(path)
+	pageStores := make(map[string]*PageStore)
+	buffer.ReadIndex = 0
+	for range pageCount {
+		pagePath := string(buffer.ReadBytes(uint(buffer.ReadInt())))
+		if !filepath.IsAbs(pagePath) {
+			pagePath = filepath.Join(dir, pagePath)
+		}
+		pageNo := buffer.ReadInt()
+		page := NewPageByBuffer(common.NewBuffer(buffer.ReadBytes(DEFAULT_PAGE_SIZE)))
+		pageStore := pageStores[pagePath]
+		if pageStore == nil {
+			pageStore = NewPageStore(pagePath)
+			pageStores[pagePath] = pageStore
+		}
+		pageStore.WritePage(page, pageNo)
+	}
+	for _, pageStore := range pageStores {
+		pageStore.Sync()
+		pageStore.Close()
+	}
+	clearDoubleWrite(path)
+}
@@ -0,0 +1,57 @@
+package icna
+
+import (
+	"Relatdb/common"
+	"Relatdb/utils"
+	"os"
+	"strings"
+)
+
+/*
+在线备份: 复制表的描述文件和数据文件, 以及恢复需要的日志, 备份期间继续接受读写
+1. 写回脏页后暂停刷新, 数据文件不再变化, 按检查点的方式计算重做LSN并保留之后的日志段
+2. 复制描述文件和数据文件后恢复刷新, 暂停期间的修改留在缓冲池中
+3. 复制重做LSN到当前的日志, 并写入重做LSN的检查点
+备份目录可以直接作为数据目录启动, 按崩溃恢复重做到备份结束时的日志, 并撤销当时没有完成的事务
+备份期间不能建表和删表
+*/
+func (self *IcnaStore) Backup(path string) {
+	if entries, _ := os.ReadDir(path); len(entries) > 0 {
+		panic(common.NewSQLError(common.ER_FILE_EXISTS_ERROR, "HY000", "Backup directory '"+path+"' is not empty"))
+	}
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		panic(err)
+	}
+	self.ddlMutex.Lock()
+	defer self.ddlMutex.Unlock()
+
+	//持有锁暂停, 等待写回的修改持有锁, 暂停之后才能开始等待
+	self.flush()
+	self.mutex.Lock()
+	self.bufferPool.PauseFlush()
+	redoLsn := self.getRedoLsn()
+	self.logStore.RetainLogs(redoLsn)
+	self.mutex.Unlock()
+	defer self.logStore.ReleaseLogs()
+	func() {
+		defer self.bufferPool.ResumeFlush()
+		self.copyTableFiles(path)
+	}()
+	self.logStore.Backup(utils.ConcatFilePaths(path, LOG_DIR), redoLsn)
+}
+
+func (self *IcnaStore) copyTableFiles(path string) {
+	entries, err := os.ReadDir(self.path)
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if !strings.HasSuffix(fileName, META_SUFFIX) && !strings.HasSuffix(fileName, DATA_SUFFIX) {
+			continue
+		}
+		if err = utils.CopyFile(utils.ConcatFilePaths(self.path, fileName), utils.ConcatFilePaths(path, fileName)); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package icna
+
+import (
+	"Relatdb/meta"
+	"Relatdb/store"
+	"Relatdb/transaction"
+	"errors"
+	"strconv"
+)
+
+var errRowNotExists = errors.New("row not exists")
+
+func (self *IcnaStore) BeginTrx(isolationLevel transaction.IsolationLevel) *transaction.Trx {
+	return self.logStore.BeginTrx(isolationLevel)
+}
+
+// 同步日志后写回全部脏页
+func (self *IcnaStore) flush() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.logStore.Sync()
+	self.bufferPool.FlushAll()
+}
+
+/*
+修改之前缓冲池超出容量时先写回全部脏页, 持有锁的修改期间后台刷新不能运行
+调用时持有锁, 之前的修改已经完成并写入日志, 写回的页是完整的B+树
+*/
+func (self *IcnaStore) reserveBuffer() {
+	if self.bufferPool.NeedFlush() {
+		self.logStore.Sync()
+		self.bufferPool.FlushAll()
+	}
+}
+
+/*
+模糊检查点: 不写回脏页, 记录恢复时开始重做的LSN, 之前的日志段被删除或归档
+重做LSN不能越过最早的脏页, 未完成的事务的开始记录, 以及还没有清除的删除标记行的删除日志
+*/
+func (self *IcnaStore) checkpoint() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.logStore.Checkpoint(self.getRedoLsn())
+}
+
+// 从当前的数据文件恢复时开始重做的LSN, 调用时持有锁
+func (self *IcnaStore) getRedoLsn() uint64 {
+	redoLsn := self.logStore.GetRedoLsn()
+	for _, row := range self.purgeRows {
+		redoLsn = min(redoLsn, row.lsn)
+	}
+	if oldestLsn := self.bufferPool.GetOldestDirtyLsn(); oldestLsn > 0 {
+		redoLsn = min(redoLsn, oldestLsn)
+	}
+	return redoLsn
+}
+
+// FLUSH LOGS: 写回脏页后切换到新的日志段并写入检查点, 之前的段不再需要时被删除或归档
+func (self *IcnaStore) FlushLogs() {
+	self.flush()
+	self.logStore.SwitchSegment()
+	self.checkpoint()
+}
+
+func (self *IcnaStore) GetStatus() []store.StatusVariable {
+	status := self.logStore.GetStatus()
+	return []store.StatusVariable{
+		{Name: "Icna_checkpoints", Value: strconv.FormatUint(status.Checkpoints, 10)},
+		{Name: "Icna_checkpoint_lsn", Value: strconv.FormatUint(status.CheckpointLsn, 10)},
+		{Name: "Icna_log_lsn", Value: strconv.FormatUint(status.LastLsn, 10)},
+		{Name: "Icna_log_segments", Value: strconv.Itoa(status.Segments)},
+		{Name: "Icna_log_segments_removed", Value: strconv.FormatUint(status.RemovedSegments, 10)},
+		{Name: "Icna_log_syncs", Value: strconv.FormatUint(status.Syncs, 10)},
+		{Name: "Icna_buffer_pool_pages", Value: strconv.Itoa(self.bufferPool.GetPageCount())},
+	}
+}
+
+// 实现transaction.RowApplier, 表已经删除时忽略, 没有主键的表按写入的行推进行ID
+func (self *IcnaStore) ApplyRow(databaseName string, tableName string, before meta.IndexEntry, after meta.IndexEntry) {
+	table := self.findTable(databaseName, tableName)
+	if table == nil {
+		return
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.reserveBuffer()
+	desc := table.GetIndexDesc()
+	if before != nil {
+		self.removeRow(table, meta.NewClusterIndexEntry(before.GetValues(), desc))
+	}
+	if after != nil {
+		entry := meta.NewClusterIndexEntry(after.GetValues(), desc)
+		self.removeRow(table, entry)
+		self.putRow(table, entry)
+		if rowIdField := table.GetRowIdField(); rowIdField != nil {
+			table.RowId = max(table.RowId, after.GetValues()[rowIdField.Index].ToInt64())
+		}
+	}
+}
+
+// 按主键删除当前的行
+func (self *IcnaStore) removeRow(table *meta.Table, key meta.IndexEntry) {
+	if current := table.ClusterIndex.Get(key); current != nil {
+		table.Delete(current)
+	}
+}
+
+/*
+写入行, 与唯一索引冲突时删除冲突的行
+冲突的行来自日志中之后的修改, 会在之后重新应用, 带删除标记的行不会冲突
+*/
+func (self *IcnaStore) putRow(table *meta.Table, entry meta.IndexEntry) {
+	err := table.Insert(entry)
+	if err == nil {
+		return
+	}
+	var conflicts []meta.IndexEntry
+	values := entry.GetValues()
+	iterator := table.ClusterIndex.Iterator()
+	for iterator.HasNext() {
+		row := iterator.Next()
+		if table.IsDeletedRow(row.GetValues()) {
+			continue
+		}
+		for _, index := range table.SecondaryIndexes {
+			if index.IsUnique() && isSameKey(index, values, row.GetValues()) {
+				conflicts = append(conflicts, row)
+				break
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		panic(err)
+	}
+	for _, conflict := range conflicts {
+		table.Delete(conflict)
+	}
+	if err = table.Insert(entry); err != nil {
+		panic(err)
+	}
+}
+
+// 唯一索引的值是否相同, NULL与任何值都不相同
+func isSameKey(index meta.Index, a []meta.Value, b []meta.Value) bool {
+	for _, field := range index.GetFields() {
+		if a[field.Index].GetType() == meta.NullValueType || a[field.Index].Compare(b[field.Index]) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,547 @@
+package icna
+
+import (
+	"Relatdb/meta"
+	"Relatdb/transaction"
+	"slices"
+)
+
+const SCAN_BATCH_SIZE = 128
+
+// 隐藏行ID写入描述页的间隔
+const ROW_ID_WRITE_MARGIN = 256
+
+// 等待清除的删除标记行
+type purgeRow struct {
+	databaseName string
+	tableName    string
+	values       []meta.Value //带删除标记的行
+	trxId        uint         //删除行的事务
+	lsn          uint64       //删除日志的LSN, 清除之前检查点不能越过
+}
+
+func (self *IcnaStore) CreateReadView() *transaction.ReadView {
+	return self.logStore.CreateReadView(0)
+}
+
+func (self *IcnaStore) CloseReadView(view *transaction.ReadView) {
+	self.logStore.CloseReadView(view)
+}
+
+// 按读视图读取表的行, view为nil时读取最新的版本
+func (self *IcnaStore) Scan(view *transaction.ReadView, databaseName string, tableName string) meta.IndexIterator {
+	return &scanIterator{
+		store: self,
+		table: self.GetTable(databaseName, tableName),
+		view:  view,
+	}
+}
+
+/*
+锁定读: 读取最新的版本, 对读到的行加锁, 锁在事务结束时释放
+可重复读和串行化使用next-key锁并锁定最后一个记录之后的间隙, 其他的行不能插入到读取的范围内
+*/
+func (self *IcnaStore) LockingScan(trx *transaction.Trx, mode transaction.LockMode, databaseName string, tableName string) meta.IndexIterator {
+	return &scanIterator{
+		store:    self,
+		table:    self.GetTable(databaseName, tableName),
+		trx:      trx,
+		lockMode: mode,
+	}
+}
+
+/*
+按索引查找索引字段的前缀等于key的行, 按读视图读取, view为nil时读取最新的版本
+二级索引按Entry中的主键到聚簇索引读取完整的行, 一次加锁读取全部匹配的行
+读视图创建时还没有结束的事务改变过二级索引的值时, 旧的版本在索引中找不到, 改为扫描聚簇索引
+*/
+func (self *IcnaStore) IndexLookup(
+	view *transaction.ReadView, databaseName string, tableName string, indexName string, key []meta.Value,
+) meta.IndexIterator {
+	table := self.GetTable(databaseName, tableName)
+	index := table.GetIndex(indexName)
+	if index == nil {
+		panic("index not exists: " + indexName)
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.checkTable(table)
+	if index != table.ClusterIndex && view != nil && !view.IsEndedBefore(self.indexChanges[index]) {
+		return &filterIterator{
+			iterator: self.Scan(view, databaseName, tableName),
+			match: func(values []meta.Value) bool {
+				return matchIndexKey(index, values, key)
+			},
+		}
+	}
+	fieldCount := len(table.Fields)
+	bound := meta.NewIndexBound(meta.NewNotLeafIndexEntry(key, nil), true)
+	iterator := index.Scan(bound, bound, false)
+	lookup := &lookupIterator{}
+	for iterator.HasNext() {
+		row := iterator.Next()
+		if index != table.ClusterIndex {
+			if row = table.ClusterIndex.Get(table.GetBookmarkKey(row)); row == nil {
+				continue
+			}
+		}
+		//索引中是最新的版本的值, 可见的版本可能不匹配
+		values := self.undoStore.GetVisibleValues(view, row.GetValues(), fieldCount)
+		if values != nil && matchIndexKey(index, values, key) {
+			lookup.rows = append(lookup.rows, meta.NewIndexEntry(values, nil))
+		}
+	}
+	return lookup
+}
+
+/*
+锁定读按完整的主键读取最新的版本, 只锁定这一行
+行不存在时, 可重复读和串行化锁定主键所在的间隙, 防止其他事务插入
+*/
+func (self *IcnaStore) LockingGet(
+	trx *transaction.Trx, mode transaction.LockMode, databaseName string, tableName string, key []meta.Value,
+) meta.IndexIterator {
+	table := self.GetTable(databaseName, tableName)
+	values := make([]meta.Value, len(table.Fields))
+	for i, field := range table.PrimaryFields {
+		values[field.Index] = key[i]
+	}
+	entry := meta.NewClusterIndexEntry(values, table.GetIndexDesc())
+	for {
+		lookup, request := self.tryLockingGet(trx, mode, table, entry)
+		if request == nil {
+			return lookup
+		}
+		if err := trx.Lock(request); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// 加锁读取一行, 遇到其他事务持有的锁时返回需要等待的锁
+func (self *IcnaStore) tryLockingGet(
+	trx *transaction.Trx, mode transaction.LockMode, table *meta.Table, key meta.IndexEntry,
+) (*lookupIterator, *transaction.LockRequest) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.checkTable(table)
+	lookup := &lookupIterator{}
+	row := table.ClusterIndex.Get(key)
+	if row == nil {
+		if trx.IsGapLocking() {
+			request := transaction.NewLockRequest(getNextLockKey(table, key), mode, transaction.LOCK_GAP)
+			if !trx.TryLock(request) {
+				return nil, request
+			}
+		}
+		return lookup, nil
+	}
+	request := transaction.NewLockRequest(getLockKey(table, row.GetValues()), mode, transaction.LOCK_REC_NOT_GAP)
+	if !trx.TryLock(request) {
+		return nil, request
+	}
+	if values := self.undoStore.GetVisibleValues(nil, row.GetValues(), len(table.Fields)); values != nil {
+		lookup.rows = append(lookup.rows, meta.NewIndexEntry(values, nil))
+	}
+	return lookup, nil
+}
+
+// 行中索引字段的前缀是否等于key
+func matchIndexKey(index meta.Index, values []meta.Value, key []meta.Value) bool {
+	fieldValues := make([]meta.Value, len(key))
+	for i := range key {
+		fieldValues[i] = values[index.GetFields()[i].Index]
+	}
+	return meta.ComparePrefix(meta.NewNotLeafIndexEntry(fieldValues, nil), meta.NewNotLeafIndexEntry(key, nil)) == 0
+}
+
+type lookupIterator struct {
+	rows     []meta.IndexEntry
+	position int
+}
+
+func (self *lookupIterator) HasNext() bool {
+	return self.position < len(self.rows)
+}
+
+func (self *lookupIterator) Next() meta.IndexEntry {
+	if !self.HasNext() {
+		return nil
+	}
+	entry := self.rows[self.position]
+	self.position++
+	return entry
+}
+
+// 不能使用索引查找时扫描全部的行, 只返回匹配的行
+type filterIterator struct {
+	iterator meta.IndexIterator
+	match    func(values []meta.Value) bool
+	next     meta.IndexEntry
+}
+
+func (self *filterIterator) HasNext() bool {
+	for self.next == nil && self.iterator.HasNext() {
+		if entry := self.iterator.Next(); self.match(entry.GetValues()) {
+			self.next = entry
+		}
+	}
+	return self.next != nil
+}
+
+func (self *filterIterator) Next() meta.IndexEntry {
+	if !self.HasNext() {
+		return nil
+	}
+	entry := self.next
+	self.next = nil
+	return entry
+}
+
+// 行锁按主键锁定
+func getLockKey(table *meta.Table, values []meta.Value) transaction.LockKey {
+	return transaction.NewRecordLockKey(table.DatabaseName, table.Name, table.GetPrimaryKey(values))
+}
+
+func getSupremumLockKey(table *meta.Table) transaction.LockKey {
+	return transaction.NewSupremumLockKey(table.DatabaseName, table.Name)
+}
+
+// key之后的第一个记录, 保护key所在的间隙, 没有时为supremum
+func getNextLockKey(table *meta.Table, key meta.IndexEntry) transaction.LockKey {
+	iterator := table.ClusterIndex.IteratorAfter(key)
+	if iterator.HasNext() {
+		return getLockKey(table, iterator.Next().GetValues())
+	}
+	return getSupremumLockKey(table)
+}
+
+/*
+按批次读取聚簇索引, 每批读取期间持有锁, 批次之间允许修改
+下一批从上一批最后一个主键之后开始, 读视图不可见的版本沿回滚指针读取
+锁定读在读取每一行之前加锁, 需要等待时结束本批, 获得锁之后从同一行继续
+*/
+type scanIterator struct {
+	store    *IcnaStore
+	table    *meta.Table
+	view     *transaction.ReadView
+	trx      *transaction.Trx //锁定读所在的事务, 一致性读时为nil
+	lockMode transaction.LockMode
+	rows     []meta.IndexEntry
+	position int
+	lastKey  meta.IndexEntry
+	finished bool
+}
+
+func (self *scanIterator) fetch() {
+	for {
+		request := self.tryFetch()
+		if request == nil {
+			return
+		}
+		if err := self.trx.Lock(request); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// 读取一批行, 遇到其他事务持有的锁时返回需要等待的锁
+func (self *scanIterator) tryFetch() *transaction.LockRequest {
+	self.store.mutex.Lock()
+	defer self.store.mutex.Unlock()
+	self.store.checkTable(self.table)
+	self.rows = nil
+	self.position = 0
+	fieldCount := len(self.table.Fields)
+	iterator := self.table.ClusterIndex.IteratorAfter(self.lastKey)
+	for range SCAN_BATCH_SIZE {
+		if !iterator.HasNext() {
+			if self.trx != nil && self.trx.IsGapLocking() {
+				request := transaction.NewLockRequest(getSupremumLockKey(self.table), self.lockMode, transaction.LOCK_GAP)
+				if !self.trx.TryLock(request) {
+					return request
+				}
+			}
+			self.finished = true
+			return nil
+		}
+		entry := iterator.Next()
+		if self.trx != nil {
+			request := transaction.NewLockRequest(getLockKey(self.table, entry.GetValues()), self.lockMode, self.getLockType())
+			if !self.trx.TryLock(request) {
+				return request
+			}
+		}
+		self.lastKey = entry
+		if values := self.store.undoStore.GetVisibleValues(self.view, entry.GetValues(), fieldCount); values != nil {
+			self.rows = append(self.rows, meta.NewIndexEntry(values, nil))
+		}
+	}
+	return nil
+}
+
+func (self *scanIterator) getLockType() transaction.LockType {
+	if self.trx.IsGapLocking() {
+		return transaction.LOCK_ORDINARY
+	}
+	return transaction.LOCK_REC_NOT_GAP
+}
+
+func (self *scanIterator) HasNext() bool {
+	for self.position >= len(self.rows) && !self.finished {
+		self.fetch()
+	}
+	return self.position < len(self.rows)
+}
+
+func (self *scanIterator) Next() meta.IndexEntry {
+	if !self.HasNext() {
+		return nil
+	}
+	entry := self.rows[self.position]
+	self.position++
+	return entry
+}
+
+/*
+没有主键的表插入的行使用单调递增的行ID, 删除和清除之后也不会重新使用, 调用时持有锁
+每分配ROW_ID_WRITE_MARGIN个行ID写入一次描述页, 而不是每次插入都写入
+*/
+func (self *IcnaStore) nextRowId(table *meta.Table) meta.Value {
+	table.RowId++
+	if table.RowId%ROW_ID_WRITE_MARGIN == 0 {
+		self.writeTable(table)
+	}
+	return meta.Int64Value(table.RowId)
+}
+
+/*
+启动时描述页中的行ID之后, 到下一次写入之前的行ID可能已经分配, 从下一次写入的位置继续
+恢复时重做的行再推进行ID, 恢复之后写入描述页
+*/
+func restoreRowId(rowId int64) int64 {
+	return (rowId/ROW_ID_WRITE_MARGIN+1)*ROW_ID_WRITE_MARGIN - 1
+}
+
+// 唯一索引在行中的值, 包含NULL的值不会冲突, 不需要加锁
+func getUniqueLockKeys(table *meta.Table, rows ...[]meta.Value) []transaction.LockKey {
+	var lockKeys []transaction.LockKey
+	for _, index := range table.SecondaryIndexes {
+		if !index.IsUnique() {
+			continue
+		}
+		for _, values := range rows {
+			key := make([]meta.Value, 0, len(index.GetFields()))
+			for _, field := range index.GetFields() {
+				if values[field.Index].GetType() == meta.NullValueType {
+					break
+				}
+				key = append(key, values[field.Index])
+			}
+			if len(key) == len(index.GetFields()) {
+				lockKeys = append(lockKeys, transaction.NewUniqueLockKey(table.DatabaseName, table.Name, index.GetName(), key))
+			}
+		}
+	}
+	return lockKeys
+}
+
+/*
+二级索引的值改变时记录修改的事务, 修改之前的版本在索引中已经找不到
+事务结束之前创建的读视图不能按这个索引查找
+*/
+func (self *IcnaStore) addIndexChanges(table *meta.Table, oldValues []meta.Value, newValues []meta.Value, trxId uint) {
+	for _, index := range table.SecondaryIndexes {
+		for _, field := range index.GetFields() {
+			oldValue, newValue := oldValues[field.Index], newValues[field.Index]
+			if oldValue.GetType() != newValue.GetType() || oldValue.Compare(newValue) != 0 {
+				self.indexChanges[index] = max(self.indexChanges[index], trxId)
+				break
+			}
+		}
+	}
+}
+
+/*
+写入行的新版本, 写入之前对主键加排他记录锁, 插入新的记录之前检查下一个记录上的间隙锁
+修改唯一索引的行同时对修改之前和之后的值加排他锁
+需要等待时先释放存储的锁, 获得行锁之后重新读取
+*/
+func (self *IcnaStore) writeRow(
+	trx *transaction.Trx, table *meta.Table, opType transaction.OpType, values []meta.Value,
+) error {
+	for {
+		request, err := self.tryWriteRow(trx, table, opType, values)
+		if request == nil {
+			return err
+		}
+		if err = trx.Lock(request); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+隐藏列记录当前事务和指向上一个版本的回滚指针
+插入时可以覆盖已删除的行, 修改和删除时行必须存在
+修改成功后写入行日志, 日志的前镜像作为撤销记录
+*/
+func (self *IcnaStore) tryWriteRow(
+	trx *transaction.Trx, table *meta.Table, opType transaction.OpType, values []meta.Value,
+) (*transaction.LockRequest, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.checkTable(table)
+	self.reserveBuffer()
+	if rowIdField := table.GetRowIdField(); rowIdField != nil && opType == transaction.INSERT {
+		values = slices.Clone(values)
+		values[rowIdField.Index] = self.nextRowId(table)
+	}
+	request := transaction.NewLockRequest(getLockKey(table, values), transaction.LOCK_X, transaction.LOCK_REC_NOT_GAP)
+	if !trx.TryLock(request) {
+		return request, nil
+	}
+	desc := table.GetIndexDesc()
+	fieldCount := len(table.Fields)
+	key := meta.NewClusterIndexEntry(values, desc)
+	before := table.ClusterIndex.Get(key)
+	exists := before != nil && !transaction.GetRowVersion(before.GetValues(), fieldCount).Deleted
+	if opType == transaction.INSERT && exists {
+		return nil, meta.NewDuplicateEntryError(table.ClusterIndex, key)
+	}
+	if opType != transaction.INSERT && !exists {
+		return nil, errRowNotExists
+	}
+	if before == nil {
+		request = transaction.NewLockRequest(getNextLockKey(table, key), transaction.LOCK_X, transaction.LOCK_INSERT_INTENTION)
+		if !trx.TryLock(request) {
+			return request, nil
+		}
+	}
+	if opType == transaction.DELETE {
+		values = before.GetValues()
+	}
+	rows := [][]meta.Value{values}
+	if before != nil {
+		rows = append(rows, before.GetValues())
+	}
+	for _, lockKey := range getUniqueLockKeys(table, rows...) {
+		request = transaction.NewLockRequest(lockKey, transaction.LOCK_X, transaction.LOCK_REC_NOT_GAP)
+		if !trx.TryLock(request) {
+			return request, nil
+		}
+	}
+	version := &transaction.RowVersion{
+		TrxId:   trx.GetTrxId(),
+		RollPtr: self.undoStore.AllocateRollPtr(),
+		Deleted: opType == transaction.DELETE,
+	}
+	after := meta.NewClusterIndexEntry(transaction.NewRowValues(values, fieldCount, version), desc)
+	var err error
+	if before == nil {
+		err = table.Insert(after)
+	} else {
+		err = table.Update(before, after)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if before != nil {
+		self.addIndexChanges(table, before.GetValues(), values, trx.GetTrxId())
+	}
+	log := trx.AddLog(table.DatabaseName, table.Name, opType, before, after)
+	self.undoStore.AddUndoLog(version.RollPtr, log)
+	if version.Deleted {
+		self.addPurgeRow(table.DatabaseName, table.Name, after.GetValues(), log)
+	}
+	return nil, nil
+}
+
+func (self *IcnaStore) addPurgeRow(databaseName string, tableName string, values []meta.Value, log *transaction.TrxLog) {
+	self.purgeRows = append(self.purgeRows, &purgeRow{
+		databaseName: databaseName,
+		tableName:    tableName,
+		values:       values,
+		trxId:        log.GetTrxId(),
+		lsn:          log.GetLsn(),
+	})
+}
+
+// 恢复后从日志中找到还没有清除的删除标记行
+func (self *IcnaStore) recoverPurgeRows() {
+	self.logStore.ReadLogs(self.logStore.GetCheckpointLsn(), func(log *transaction.TrxLog) {
+		if log.GetLogType() != transaction.ROW || log.GetOpType() != transaction.DELETE || log.GetAfter() == nil {
+			return
+		}
+		table := self.findTable(log.GetDatabaseName(), log.GetTableName())
+		values := log.GetAfter().GetValues()
+		if table != nil && transaction.GetRowVersion(values, len(table.Fields)).Deleted {
+			self.addPurgeRow(log.GetDatabaseName(), log.GetTableName(), values, log)
+		}
+	})
+}
+
+/*
+清除: 删除所有读视图都不再需要的撤销记录和删除标记行
+物理删除写入不属于任何事务的行日志, 恢复时只重做不撤销
+*/
+func (self *IcnaStore) purge() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	purgeLimit := self.logStore.GetPurgeLimit()
+	self.undoStore.Purge(purgeLimit)
+	var pendingRows []*purgeRow
+	for _, row := range self.purgeRows {
+		if row.trxId >= purgeLimit {
+			pendingRows = append(pendingRows, row)
+			continue
+		}
+		self.reserveBuffer()
+		table := self.findTable(row.databaseName, row.tableName)
+		if table == nil {
+			continue
+		}
+		desc := table.GetIndexDesc()
+		current := table.ClusterIndex.Get(meta.NewClusterIndexEntry(row.values, desc))
+		if current == nil {
+			continue
+		}
+		//删除之后被重新插入或者删除已经回滚
+		version := transaction.GetRowVersion(current.GetValues(), len(table.Fields))
+		if !version.Deleted || version.TrxId != row.trxId {
+			continue
+		}
+		table.Delete(current)
+		self.logStore.AppendLog(transaction.NewRowLog(0, table.DatabaseName, table.Name, transaction.DELETE, current, nil))
+		self.logStore.GetLockManager().InheritGapLocks(getLockKey(table, row.values), getNextLockKey(table, current))
+	}
+	self.purgeRows = pendingRows
+}
+
+// 丢弃表的删除标记行, 用于删除表之前, 调用时持有锁
+func (self *IcnaStore) dropPurgeRows(databaseName string, tableName string) {
+	var pendingRows []*purgeRow
+	for _, row := range self.purgeRows {
+		if row.databaseName != databaseName || row.tableName != tableName {
+			pendingRows = append(pendingRows, row)
+		}
+	}
+	self.purgeRows = pendingRows
+}
+
+func (self *IcnaStore) dropIndexChanges(table *meta.Table) {
+	for _, index := range table.SecondaryIndexes {
+		delete(self.indexChanges, index)
+	}
+}
+
+// 查找表, 不存在时返回nil, 后台清除和恢复也会调用
+func (self *IcnaStore) findTable(databaseName string, tableName string) *meta.Table {
+	self.metaMutex.RLock()
+	defer self.metaMutex.RUnlock()
+	database := self.databaseMap[databaseName]
+	if database == nil {
+		return nil
+	}
+	return database.GetTable(tableName)
+}
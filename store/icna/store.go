@@ -1,45 +1,142 @@
 package icna
 
 import (
-	"Relatdb/common"
 	"Relatdb/index/bptree"
 	"Relatdb/meta"
 	"Relatdb/store"
+	"Relatdb/transaction"
 	"Relatdb/utils"
+	"errors"
 	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	META_SUFFIX = ".meta"
 	DATA_SUFFIX = ".data"
+	LOG_DIR     = "wal"
+
+	DOUBLE_WRITE_FILE = "doublewrite"
+
+	DEFAULT_FLUSH_INTERVAL = time.Second
 )
 
 type Options struct {
-	Path string
+	Path           string
+	BufferPoolSize int           //缓冲池的页数量, 为0时使用默认值
+	FlushInterval  time.Duration //后台刷新脏页的间隔, 为0时使用默认值
+	LogSegmentSize int64         //预写日志的段大小, 为0时使用默认值
+	LogArchivePath string        //检查点之后不再需要的日志段移动到的目录, 为空时删除
+	//时间点恢复的目标, 设置时数据目录为基础备份, 按归档的日志恢复到目标, 恢复之后应当去掉
+	RecoveryTarget *transaction.RecoveryTarget
 }
 
 type IcnaStore struct {
-	path        string
-	databaseMap map[string]*meta.DataBase
+	mutex          sync.Mutex //修改行和写入日志期间不能写回脏页, 读取行期间不能修改
+	path           string
+	databaseMap    map[string]*meta.DataBase
+	bufferPool     *store.BufferPool
+	flushInterval  time.Duration
+	logStore       *transaction.LogStore
+	logSegmentSize int64
+	logArchivePath string
+	recoveryTarget *transaction.RecoveryTarget
+	undoStore      *transaction.UndoStore
+	purgeRows      []*purgeRow         //等待清除的删除标记行
+	indexChanges   map[meta.Index]uint //二级索引最后一次改变索引值的事务
+	ddlMutex       sync.Mutex          //建表和删表与在线备份互斥
+	metaMutex      sync.RWMutex        //保护数据库和表的映射, 持有期间不获取其他的锁
 }
 
 func NewIcnaStore(options *Options) *IcnaStore {
+	flushInterval := options.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = DEFAULT_FLUSH_INTERVAL
+	}
 	store := &IcnaStore{
-		path:        options.Path,
-		databaseMap: make(map[string]*meta.DataBase),
+		path:           options.Path,
+		databaseMap:    make(map[string]*meta.DataBase),
+		bufferPool:     store.NewBufferPool(options.BufferPoolSize, utils.ConcatFilePaths(options.Path, DOUBLE_WRITE_FILE)),
+		flushInterval:  flushInterval,
+		logSegmentSize: options.LogSegmentSize,
+		logArchivePath: options.LogArchivePath,
+		recoveryTarget: options.RecoveryTarget,
+		undoStore:      transaction.NewUndoStore(),
+		indexChanges:   make(map[meta.Index]uint),
 	}
 	_ = os.MkdirAll(store.path, os.ModePerm)
 	return store
 }
 
+/*
+先从双写文件恢复数据文件, 打开表之后按预写日志恢复, 设置了恢复目标时先准备恢复到目标的日志
+恢复时重做的修改早于当前的日志位置, 写回之后脏页才开始记录日志位置
+后台定时清除, 写回脏页并写入检查点
+*/
 func (self *IcnaStore) Init() {
+	store.RecoverDoubleWrite(utils.ConcatFilePaths(self.path, DOUBLE_WRITE_FILE))
+	logPath := utils.ConcatFilePaths(self.path, LOG_DIR)
+	if self.recoveryTarget != nil {
+		transaction.RestoreLogs(logPath, self.logSegmentSize, self.logArchivePath, self.recoveryTarget)
+	}
+	self.logStore = transaction.NewLogStore(logPath, self.logSegmentSize, self.logArchivePath)
 	self.InitDatabases()
 	self.InitTables()
+	for _, trx := range transaction.Recover(self.logStore, self) {
+		self.recoverPreparedTrx(trx)
+	}
+	self.saveRowIds()
+	self.recoverPurgeRows()
+	self.purge()
+	self.flush()
+	self.bufferPool.SetLsnSource(self.logStore.GetNextLsn)
+	self.checkpoint()
+	self.bufferPool.StartFlusher(self.flushInterval, func() {
+		self.purge()
+		self.flush()
+		self.checkpoint()
+	})
+}
+
+// 恢复之后写入没有主键的表的行ID, 重做的日志在检查点之后不再重做
+func (self *IcnaStore) saveRowIds() {
+	for _, table := range self.getTables() {
+		if table.GetRowIdField() != nil {
+			self.writeTable(table)
+		}
+	}
+}
+
+// 停止后台刷新, 写回脏页后写入检查点并关闭日志和索引
+func (self *IcnaStore) Close() {
+	self.bufferPool.StopFlusher()
+	self.purge()
+	self.flush()
+	self.checkpoint()
+	self.logStore.Close()
+	for _, table := range self.getTables() {
+		self.closeIndexes(table)
+	}
+}
+
+// 全部数据库的表的快照, 遍历期间可以建表和删表
+func (self *IcnaStore) getTables() []*meta.Table {
+	self.metaMutex.RLock()
+	defer self.metaMutex.RUnlock()
+	var tables []*meta.Table
+	for _, database := range self.databaseMap {
+		for _, table := range database.TableMap {
+			tables = append(tables, table)
+		}
+	}
+	return tables
 }
 
 func (self *IcnaStore) InitDatabases() {
-	self.databaseMap["default"] = meta.NewDataBase("default")
+	self.CreateDatabase(meta.NewDataBase("default"))
 }
 
 func (self *IcnaStore) InitTables() {
@@ -50,13 +147,27 @@ func (self *IcnaStore) InitTables() {
 			continue
 		}
 		table := self.readTable(utils.ConcatFilePaths(self.path, fileName))
-		database := self.databaseMap[table.DatabaseName]
-		database.TableMap[table.Name] = table
+		table.RowId = restoreRowId(table.RowId)
+		self.openIndexes(table)
+		self.addTable(table)
 	}
 }
 
+// 加入表所在的数据库, 数据库不存在时创建
+func (self *IcnaStore) addTable(table *meta.Table) {
+	self.metaMutex.Lock()
+	defer self.metaMutex.Unlock()
+	database := self.databaseMap[table.DatabaseName]
+	if database == nil {
+		database = meta.NewDataBase(table.DatabaseName)
+		self.databaseMap[database.Name] = database
+	}
+	database.TableMap[table.Name] = table
+}
+
 func (self *IcnaStore) readTable(path string) *meta.Table {
 	pageStore := store.NewPageStore(path)
+	defer pageStore.Close()
 	page := pageStore.ReadPage(0)
 	items := page.ReadItems()
 	var entries []meta.IndexEntry
@@ -67,14 +178,10 @@ func (self *IcnaStore) readTable(path string) *meta.Table {
 	databaseName := entries[1].GetValues()[0].ToString()
 	tableName := entries[2].GetValues()[0].ToString()
 	var fields []*meta.Field
-	var primaryFiled *meta.Field
 	fieldMap := make(map[string]*meta.Field, metaQuantity-3)
 	for i := 3; i <= metaQuantity; i++ {
 		values := entries[i].GetValues()
 		field := meta.NewFieldByValues(values)
-		if field.Flag&common.PRIMARY_KEY_FLAG != 0 {
-			primaryFiled = field
-		}
 		fields = append(fields, field)
 		fieldMap[field.Name] = field
 	}
@@ -99,15 +206,30 @@ func (self *IcnaStore) readTable(path string) *meta.Table {
 		}
 		indexStartOffset += indexMetaSize + 1
 	}
-	table := meta.NewTable(databaseName, tableName, fields, primaryFiled, fieldMap, clusterIndex, secondaryIndexes)
+	//主键的字段按聚簇索引中的顺序排列
+	var primaryFields []*meta.Field
+	for _, field := range clusterIndex.GetFields() {
+		primaryFields = append(primaryFields, fields[field.Index])
+	}
+	table := meta.NewTable(databaseName, tableName, fields, primaryFields, fieldMap, clusterIndex, secondaryIndexes)
+	if indexStartOffset < len(entries) {
+		table.RowId = entries[indexStartOffset].GetValues()[0].ToInt64()
+	}
 	table.MetaPath = path
 	table.DataPath = strings.ReplaceAll(path, META_SUFFIX, DATA_SUFFIX)
 	return table
 }
 
-func (self *IcnaStore) writeTable(table *meta.Table) {
+// 写入表的描述页, 返回页的内容用于建表日志
+func (self *IcnaStore) writeTable(table *meta.Table) []byte {
 	pageStore := store.NewPageStore(table.MetaPath)
+	defer pageStore.Close()
+	page := self.newTablePage(table)
+	pageStore.WritePage(page, 0)
+	return page.Buffer.Data
+}
 
+func (self *IcnaStore) newTablePage(table *meta.Table) *store.Page {
 	//写入字段
 	var fields []*store.Item
 	for _, field := range table.Fields {
@@ -128,27 +250,70 @@ func (self *IcnaStore) writeTable(table *meta.Table) {
 	for _, secondaryIndex := range table.SecondaryIndexes {
 		page.WriteItem(store.IndexToItems(secondaryIndex)...)
 	}
+	//写入隐藏行ID
+	page.WriteItem(store.IndexEntryToItem(meta.NewIndexEntry([]meta.Value{meta.Int64Value(table.RowId)}, nil)))
+	return page
+}
 
-	pageStore.WritePage(page, 0)
+// 索引的存储文件, 聚簇索引使用表的数据文件
+func (self *IcnaStore) getIndexPath(table *meta.Table, index meta.Index) string {
+	if index == table.ClusterIndex {
+		return table.DataPath
+	}
+	return strings.ReplaceAll(table.DataPath, DATA_SUFFIX, "_"+index.GetName()+DATA_SUFFIX)
+}
+
+func (self *IcnaStore) getIndexes(table *meta.Table) []meta.Index {
+	return append([]meta.Index{table.ClusterIndex}, table.SecondaryIndexes...)
+}
+
+func (self *IcnaStore) openIndexes(table *meta.Table) {
+	desc := table.GetIndexDesc()
+	for _, index := range self.getIndexes(table) {
+		index.(*bptree.BPTree).Open(self.getIndexPath(table, index), desc, self.bufferPool)
+	}
+}
+
+func (self *IcnaStore) closeIndexes(table *meta.Table) {
+	for _, index := range self.getIndexes(table) {
+		self.bufferPool.DropFile(self.getIndexPath(table, index))
+		index.(*bptree.BPTree).Close()
+	}
+}
+
+func (self *IcnaStore) removeIndexFiles(table *meta.Table) {
+	for _, index := range self.getIndexes(table) {
+		path := self.getIndexPath(table, index)
+		self.bufferPool.DropFile(path)
+		os.Remove(path)
+	}
 }
 
 func (self *IcnaStore) CreateDatabase(database *meta.DataBase) {
+	self.metaMutex.Lock()
+	defer self.metaMutex.Unlock()
 	self.databaseMap[database.Name] = database
 }
 
 func (self *IcnaStore) DropDatabase(databaseName string) {
-	database := self.databaseMap[databaseName]
-	for _, table := range database.TableMap {
-		self.DropTable(database.Name, table.Name)
+	self.GetDatabase(databaseName)
+	for _, table := range self.getTables() {
+		if table.DatabaseName == databaseName {
+			self.DropTable(databaseName, table.Name)
+		}
 	}
-	delete(self.databaseMap, database.Name)
+	self.metaMutex.Lock()
+	defer self.metaMutex.Unlock()
+	delete(self.databaseMap, databaseName)
 }
 
 func (self *IcnaStore) GetDatabase(databaseName string) *meta.DataBase {
 	if databaseName == "" {
 		panic("no database selected")
 	}
+	self.metaMutex.RLock()
 	database := self.databaseMap[databaseName]
+	self.metaMutex.RUnlock()
 	if database == nil {
 		panic("database not exists: " + databaseName)
 	}
@@ -156,8 +321,9 @@ func (self *IcnaStore) GetDatabase(databaseName string) *meta.DataBase {
 }
 
 func (self *IcnaStore) CreateTable(table *meta.Table) {
-	database := self.GetDatabase(table.DatabaseName)
-	if database.GetTable(table.Name) != nil {
+	self.ddlMutex.Lock()
+	defer self.ddlMutex.Unlock()
+	if self.ExistTable(table.DatabaseName, table.Name) {
 		panic("table already exists: " + table.Name)
 	}
 	if table.ClusterIndex == nil {
@@ -165,25 +331,176 @@ func (self *IcnaStore) CreateTable(table *meta.Table) {
 	}
 	table.MetaPath = utils.ConcatFilePaths(self.path, table.Name+META_SUFFIX)
 	table.DataPath = utils.ConcatFilePaths(self.path, table.Name+DATA_SUFFIX)
+	tableMeta := self.writeTable(table)
+	self.logStore.AppendLog(transaction.NewCreateTableLog(table.DatabaseName, table.Name, tableMeta))
+	self.removeIndexFiles(table)
+	self.openIndexes(table)
+	self.addTable(table)
+}
+
+// 先写入删除表的日志, 恢复时之前的行日志应用到被删除的表, 之后同名的表重新创建
+func (self *IcnaStore) DropTable(databaseName string, tableName string) {
+	self.ddlMutex.Lock()
+	defer self.ddlMutex.Unlock()
+	table := self.GetTable(databaseName, tableName)
+	self.logStore.AppendLog(transaction.NewDropTableLog(databaseName, tableName))
+	self.removeTable(table)
+}
+
+/*
+持有锁移出表的映射之后关闭索引, 其他连接进行中的读写在关闭之前结束
+分批扫描的下一批和之后的读写发现表已经删除, 不会读取关闭的索引
+*/
+func (self *IcnaStore) removeTable(table *meta.Table) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.dropPurgeRows(table.DatabaseName, table.Name)
+	self.dropIndexChanges(table)
+	self.metaMutex.Lock()
+	delete(self.databaseMap[table.DatabaseName].TableMap, table.Name)
+	self.metaMutex.Unlock()
+	self.closeIndexes(table)
+	self.removeIndexFiles(table)
+	os.Remove(table.MetaPath)
+}
+
+// 表已经删除时不能继续读写, 调用时持有锁
+func (self *IcnaStore) checkTable(table *meta.Table) {
+	if self.findTable(table.DatabaseName, table.Name) != table {
+		panic("table not exists: " + table.Name)
+	}
+}
+
+// 表的聚簇索引和二级索引的快照, 建索引和删索引持有锁修改二级索引
+func (self *IcnaStore) GetIndexes(databaseName string, tableName string) []meta.Index {
+	table := self.GetTable(databaseName, tableName)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.getIndexes(table)
+}
+
+// 实现transaction.TableApplier, 按建表日志中的描述页重新创建空表, 同名的表已经存在时先删除
+func (self *IcnaStore) ApplyCreateTable(databaseName string, tableName string, tableMeta []byte) {
+	self.ApplyDropTable(databaseName, tableName)
+	metaPath := utils.ConcatFilePaths(self.path, tableName+META_SUFFIX)
+	if err := os.WriteFile(metaPath, tableMeta, os.ModePerm); err != nil {
+		panic(err)
+	}
+	table := self.readTable(metaPath)
+	self.removeIndexFiles(table)
+	self.openIndexes(table)
+	self.addTable(table)
+}
+
+func (self *IcnaStore) ApplyDropTable(databaseName string, tableName string) {
+	if table := self.findTable(databaseName, tableName); table != nil {
+		self.removeTable(table)
+	}
+}
+
+/*
+CREATE INDEX: 从聚簇索引回填新的二级索引, 回填期间不能读写行
+唯一索引有重复的值时删除索引文件, 返回重复的错误
+*/
+func (self *IcnaStore) CreateIndex(databaseName string, tableName string, index meta.Index) {
+	self.ddlMutex.Lock()
+	defer self.ddlMutex.Unlock()
+	table := self.GetTable(databaseName, tableName)
+	if table.GetSecondaryIndex(index.GetName()) != nil {
+		panic("index already exists: " + index.GetName())
+	}
+	//先清除已删除的行, 减少回填的行
+	self.purge()
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if err := self.buildIndex(table, index); err != nil {
+		panic(err)
+	}
+	table.SecondaryIndexes = append(table.SecondaryIndexes, index)
+	self.alterTable(table)
+	//回填的是最新的版本, 已经开始的事务结束之前创建的读视图不能使用新的索引
+	self.indexChanges[index] = self.logStore.GetNextTrxId()
+}
+
+func (self *IcnaStore) DropIndex(databaseName string, tableName string, indexName string) {
+	self.ddlMutex.Lock()
+	defer self.ddlMutex.Unlock()
+	table := self.GetTable(databaseName, tableName)
+	index := table.GetSecondaryIndex(indexName)
+	if index == nil {
+		panic("index not exists: " + indexName)
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	table.SecondaryIndexes = slices.DeleteFunc(table.SecondaryIndexes, func(secondaryIndex meta.Index) bool {
+		return secondaryIndex == index
+	})
+	self.alterTable(table)
+	self.removeIndex(table, index)
+	delete(self.indexChanges, index)
+}
+
+// 先写入修改表的日志再写入描述页, 写入描述页之前中断时恢复按日志中的描述页重建二级索引
+func (self *IcnaStore) alterTable(table *meta.Table) {
+	tableMeta := self.newTablePage(table).Buffer.Data
+	self.logStore.AppendLog(transaction.NewAlterTableLog(table.DatabaseName, table.Name, tableMeta))
 	self.writeTable(table)
+}
 
-	database.TableMap[table.Name] = table
+// 打开新的二级索引并从聚簇索引回填, 失败时删除索引文件, 调用时持有锁
+func (self *IcnaStore) buildIndex(table *meta.Table, index meta.Index) error {
+	path := self.getIndexPath(table, index)
+	self.bufferPool.DropFile(path)
+	os.Remove(path)
+	desc := table.GetIndexDesc()
+	index.(*bptree.BPTree).Open(path, desc, self.bufferPool)
+	iterator := table.ClusterIndex.Iterator()
+	for iterator.HasNext() {
+		row := iterator.Next()
+		//表的描述页中还没有新的索引, 回填期间写回索引的页不影响恢复
+		self.reserveBuffer()
+		if err := index.Insert(table.GetIndexEntry(index, row)); err != nil {
+			self.removeIndex(table, index)
+			if errors.Is(err, meta.ErrDuplicateKey) {
+				return meta.NewDuplicateEntryError(index, row)
+			}
+			return err
+		}
+	}
+	return nil
 }
 
-func (self *IcnaStore) DropTable(databaseName string, tableName string) {
-	database := self.GetDatabase(databaseName)
-	table := database.GetTable(tableName)
+// 关闭二级索引并删除存储文件
+func (self *IcnaStore) removeIndex(table *meta.Table, index meta.Index) {
+	path := self.getIndexPath(table, index)
+	self.bufferPool.DropFile(path)
+	index.(*bptree.BPTree).Close()
+	os.Remove(path)
+}
+
+// 实现transaction.TableApplier, 按修改之后的描述页重建全部二级索引, 表不存在时忽略
+func (self *IcnaStore) ApplyAlterTable(databaseName string, tableName string, tableMeta []byte) {
+	table := self.findTable(databaseName, tableName)
 	if table == nil {
-		panic("table not exists: " + tableName)
+		return
+	}
+	if err := os.WriteFile(table.MetaPath, tableMeta, os.ModePerm); err != nil {
+		panic(err)
+	}
+	for _, index := range table.SecondaryIndexes {
+		self.removeIndex(table, index)
+	}
+	table.SecondaryIndexes = self.readTable(table.MetaPath).SecondaryIndexes
+	for _, index := range table.SecondaryIndexes {
+		if err := self.buildIndex(table, index); err != nil {
+			panic(err)
+		}
 	}
-	os.Remove(table.DataPath)
-	os.Remove(table.MetaPath)
-	delete(database.TableMap, tableName)
 }
 
 func (self *IcnaStore) GetTable(databaseName string, tableName string) *meta.Table {
-	database := self.GetDatabase(databaseName)
-	table := database.GetTable(tableName)
+	self.GetDatabase(databaseName)
+	table := self.findTable(databaseName, tableName)
 	if table == nil {
 		panic("table not exists: " + tableName)
 	}
@@ -191,12 +508,12 @@ func (self *IcnaStore) GetTable(databaseName string, tableName string) *meta.Tab
 }
 
 func (self *IcnaStore) ExistTable(databaseName string, tableName string) bool {
-	database := self.GetDatabase(databaseName)
-	table := database.GetTable(tableName)
-	return table != nil
+	self.GetDatabase(databaseName)
+	return self.findTable(databaseName, tableName) != nil
 }
 
-func (self *IcnaStore) Insert(databaseName string, tableName string, columns []string, rows [][]meta.Value) {
+// 在事务中插入行, 插入失败时由调用方撤销本次已经插入的行
+func (self *IcnaStore) Insert(trx *transaction.Trx, databaseName string, tableName string, columns []string, rows [][]meta.Value) {
 	table := self.GetTable(databaseName, tableName)
 	columnMap := make(map[string]int, len(columns))
 	for i, column := range columns {
@@ -209,15 +526,58 @@ func (self *IcnaStore) Insert(databaseName string, tableName string, columns []s
 			for i, field := range table.Fields {
 				if index, ok := columnMap[field.Name]; ok {
 					fullValues[i] = values[index]
+				} else {
+					fullValues[i] = field.DefaultValue
 				}
 			}
 		} else {
-			for i := 0; i < min(len(table.Fields), len(values)); i++ {
-				fullValues[i] = values[i]
+			for i, field := range table.Fields {
+				if i < len(values) {
+					fullValues[i] = values[i]
+				} else {
+					fullValues[i] = field.DefaultValue
+				}
 			}
 		}
-		desc := meta.NewIndexDescByAllArgs(table.Fields, table.PrimaryFiled, table.FieldMap)
-		entry := meta.NewClusterIndexEntry(fullValues, desc)
-		table.Insert(entry)
+		if err := self.writeRow(trx, table, transaction.INSERT, fullValues); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// 在事务中按主键给行加上删除标记, 返回实际删除的行数, 已经不存在的行不计入
+func (self *IcnaStore) Delete(trx *transaction.Trx, databaseName string, tableName string, rows [][]meta.Value) uint64 {
+	table := self.GetTable(databaseName, tableName)
+	affectedRows := uint64(0)
+	for _, values := range rows {
+		err := self.writeRow(trx, table, transaction.DELETE, values)
+		if err == errRowNotExists {
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+		affectedRows++
+	}
+	return affectedRows
+}
+
+/*
+在事务中修改行, 修改失败时由调用方撤销本次已经修改的行
+主键改变时旧的行加上删除标记, 之前的读视图仍然可以读到
+*/
+func (self *IcnaStore) Update(trx *transaction.Trx, databaseName string, tableName string, oldRows [][]meta.Value, newRows [][]meta.Value) {
+	table := self.GetTable(databaseName, tableName)
+	for i := range oldRows {
+		var err error
+		oldKey := meta.NewNotLeafIndexEntry(table.GetPrimaryKey(oldRows[i]), nil)
+		if oldKey.CompareEntry(meta.NewNotLeafIndexEntry(table.GetPrimaryKey(newRows[i]), nil)) == 0 {
+			err = self.writeRow(trx, table, transaction.UPDATE, newRows[i])
+		} else if err = self.writeRow(trx, table, transaction.DELETE, oldRows[i]); err == nil {
+			err = self.writeRow(trx, table, transaction.INSERT, newRows[i])
+		}
+		if err != nil {
+			panic(err)
+		}
 	}
 }
@@ -0,0 +1,49 @@
+package icna
+
+import (
+	"Relatdb/meta"
+	"Relatdb/transaction"
+)
+
+func (self *IcnaStore) TakePreparedTrx(xid transaction.Xid) *transaction.Trx {
+	return self.logStore.TakePreparedTrx(xid)
+}
+
+func (self *IcnaStore) GetPreparedXids() []transaction.Xid {
+	return self.logStore.GetPreparedXids()
+}
+
+/*
+恢复已经准备的事务: 重新登记撤销记录并对修改过的行和唯一索引的值加排他锁, 提交或回滚之前其他事务读不到也改不了这些行
+补偿日志的后镜像是之前写入的版本, 同一个回滚指针只登记第一次写入的日志
+*/
+func (self *IcnaStore) recoverPreparedTrx(trx *transaction.Trx) {
+	rollPtrs := make(map[uint64]bool)
+	for _, log := range trx.GetLogs() {
+		table := self.findTable(log.GetDatabaseName(), log.GetTableName())
+		if table == nil {
+			continue
+		}
+		row := log.GetAfter()
+		if row == nil {
+			row = log.GetBefore()
+		}
+		lockKeys := []transaction.LockKey{getLockKey(table, row.GetValues())}
+		rows := [][]meta.Value{row.GetValues()}
+		if log.GetBefore() != nil && log.GetAfter() != nil {
+			rows = append(rows, log.GetBefore().GetValues())
+			self.addIndexChanges(table, log.GetBefore().GetValues(), log.GetAfter().GetValues(), trx.GetTrxId())
+		}
+		for _, lockKey := range append(lockKeys, getUniqueLockKeys(table, rows...)...) {
+			trx.TryLock(transaction.NewLockRequest(lockKey, transaction.LOCK_X, transaction.LOCK_REC_NOT_GAP))
+		}
+		if log.GetAfter() == nil {
+			continue
+		}
+		version := transaction.GetRowVersion(log.GetAfter().GetValues(), len(table.Fields))
+		if version.TrxId == trx.GetTrxId() && !rollPtrs[version.RollPtr] {
+			rollPtrs[version.RollPtr] = true
+			self.undoStore.AddUndoLog(version.RollPtr, log)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"Relatdb/common"
 	"Relatdb/meta"
 )
 
@@ -60,32 +59,11 @@ func IndexToItems(index meta.Index) []*Item {
 }
 
 func ItemToIndexEntry(item *Item) meta.IndexEntry {
-	buffer := common.NewBuffer(item.Data.Data)
-	var values []meta.Value
-	for buffer.Remaining() > 0 {
-		var value meta.Value
-		fieldType := meta.ValueType(buffer.ReadByte())
-		switch fieldType {
-		case meta.StringValueType:
-			length := buffer.ReadInt()
-			value = meta.StringValue(buffer.ReadBytes(uint(length)))
-		case meta.Int64ValueType:
-			value = meta.Int64Value(buffer.ReadInt64())
-		case meta.IntValueType:
-			value = meta.IntValue(buffer.ReadInt())
-		case meta.NullValueType:
-			value = meta.CONST_NULL_VALUE
-		}
-		values = append(values, value)
-	}
-	return meta.NewIndexEntry(values, nil)
+	return meta.NewIndexEntry(meta.BytesToValues(item.Data.Data), nil)
 }
 
 func IndexEntryToItem(entry meta.IndexEntry) *Item {
-	var data []byte
-	for _, value := range entry.GetValues() {
-		data = append(data, value.ToBytes()...)
-	}
+	data := meta.ValuesToBytes(entry.GetValues())
 	itemPointer := NewItemPointer(-1, len(data))
 	itemData := NewItemData(data, itemPointer.TupleLength)
 	return NewItem(itemPointer, itemData)
@@ -17,7 +17,7 @@ const (
 )
 
 const (
-	PAGE_HEADER_SIZE          = 24
+	PAGE_HEADER_SIZE          = TUPLE_COUNT_WRITE_POINTER + 4
 	MAGIC_WORD                = "MagicWord"
 	LOWER_WRITE_POINTER       = uint(len(MAGIC_WORD)) + 1
 	UPPER_WRITE_POINTER       = LOWER_WRITE_POINTER + 4
@@ -71,6 +71,8 @@ func NewPageByBuffer(buffer *common.Buffer) *Page {
 	pageHeader.UpperOffset = buffer.ReadInt()
 	pageHeader.Special = buffer.ReadInt()
 	pageHeader.TupleCount = buffer.ReadInt()
+	//继续写入时从剩余空间起始偏移开始
+	buffer.WriteIndex = uint(pageHeader.LowerOffset)
 	page.Buffer = buffer
 	return page
 }
@@ -137,6 +139,7 @@ func (self *Page) readItem() *Item {
 }
 
 func (self *Page) ReadItems() (items []*Item) {
+	self.Buffer.ReadIndex = uint(self.Header.HeaderLength)
 	for _ = range self.Header.TupleCount {
 		item := self.readItem()
 		if item == nil {
@@ -18,6 +18,10 @@ func NewPageStore(path string) *PageStore {
 	}
 }
 
+func (self *PageStore) GetPath() string {
+	return self.path
+}
+
 func (self *PageStore) ReadPage(pageIndex int) *Page {
 	readPos := int64(pageIndex * DEFAULT_PAGE_SIZE)
 	buf := make([]byte, DEFAULT_PAGE_SIZE)
@@ -32,3 +36,20 @@ func (self *PageStore) WritePage(page *Page, pageIndex int) {
 	self.file.Seek(writePos, 0)
 	self.file.Write(page.Buffer.Data)
 }
+
+// 文件中的页数量
+func (self *PageStore) GetPageCount() int {
+	info, err := self.file.Stat()
+	if err != nil {
+		return 0
+	}
+	return int(info.Size() / DEFAULT_PAGE_SIZE)
+}
+
+func (self *PageStore) Sync() {
+	self.file.Sync()
+}
+
+func (self *PageStore) Close() {
+	self.file.Close()
+}
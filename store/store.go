@@ -1,15 +1,43 @@
 package store
 
-import "Relatdb/meta"
+import (
+	"Relatdb/meta"
+	"Relatdb/transaction"
+)
+
+// SHOW STATUS显示的存储状态
+type StatusVariable struct {
+	Name  string
+	Value string
+}
 
 type Store interface {
+	transaction.LogApplier
 	Init()
+	Close()
+	FlushLogs()
+	Backup(path string)
+	GetStatus() []StatusVariable
+	BeginTrx(isolationLevel transaction.IsolationLevel) *transaction.Trx
+	TakePreparedTrx(xid transaction.Xid) *transaction.Trx
+	GetPreparedXids() []transaction.Xid
+	CreateReadView() *transaction.ReadView
+	CloseReadView(view *transaction.ReadView)
+	Scan(view *transaction.ReadView, databaseName string, tableName string) meta.IndexIterator
+	LockingScan(trx *transaction.Trx, mode transaction.LockMode, databaseName string, tableName string) meta.IndexIterator
+	IndexLookup(view *transaction.ReadView, databaseName string, tableName string, indexName string, key []meta.Value) meta.IndexIterator
+	LockingGet(trx *transaction.Trx, mode transaction.LockMode, databaseName string, tableName string, key []meta.Value) meta.IndexIterator
 	CreateDatabase(database *meta.DataBase)
 	DropDatabase(databaseName string)
 	GetDatabase(databaseName string) *meta.DataBase
 	CreateTable(table *meta.Table)
 	DropTable(databaseName string, tableName string)
+	CreateIndex(databaseName string, tableName string, index meta.Index)
+	DropIndex(databaseName string, tableName string, indexName string)
 	GetTable(databaseName string, tableName string) *meta.Table
+	GetIndexes(databaseName string, tableName string) []meta.Index
 	ExistTable(databaseName string, tableName string) bool
-	Insert(databaseName string, tableName string, columns []string, rows [][]meta.Value)
+	Insert(trx *transaction.Trx, databaseName string, tableName string, columns []string, rows [][]meta.Value)
+	Update(trx *transaction.Trx, databaseName string, tableName string, oldRows [][]meta.Value, newRows [][]meta.Value)
+	Delete(trx *transaction.Trx, databaseName string, tableName string, rows [][]meta.Value) uint64
 }
@@ -0,0 +1,34 @@
+package transaction
+
+import (
+	"Relatdb/utils"
+	"os"
+	"slices"
+)
+
+/*
+在线备份日志: 复制包含redoLsn到当前最后一条记录的段, 调用方需要先保留redoLsn之后的段
+复制时当前段仍在写入, 截断到复制开始时同步的最后一条记录, 最后写入redoLsn的检查点
+之后的检查点基于更新的数据文件, 从备份启动时由写入的检查点开始重做
+*/
+func (self *LogStore) Backup(path string, redoLsn uint64) {
+	self.mutex.Lock()
+	self.waitSynced(self.nextLsn - 1)
+	lastLsn := self.nextLsn - 1
+	segments := slices.Clone(self.segments)
+	self.mutex.Unlock()
+
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		panic(err)
+	}
+	for i, startLsn := range segments {
+		if startLsn > lastLsn || (i+1 < len(segments) && segments[i+1] <= redoLsn) {
+			continue
+		}
+		if err := utils.CopyFile(self.getSegmentPath(startLsn), getSegmentPath(path, startLsn)); err != nil {
+			panic(err)
+		}
+	}
+	truncateLogs(path, lastLsn)
+	writeCheckpoint(path, self.segmentSize, redoLsn)
+}
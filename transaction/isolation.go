@@ -0,0 +1,42 @@
+package transaction
+
+import "strings"
+
+/*
+隔离级别:
+读未提交读取最新的版本, 读已提交每条语句使用新的读视图, 可重复读在事务中使用同一个读视图
+串行化在可重复读的基础上, 事务中的查询加共享锁读取, 由行锁和间隙锁阻止并发的修改
+*/
+type IsolationLevel int
+
+const (
+	_ IsolationLevel = iota
+	READ_UNCOMMITTED
+	READ_COMMITTED
+	REPEATABLE_READ
+	SERIALIZABLE
+)
+
+const DEFAULT_ISOLATION_LEVEL = REPEATABLE_READ
+
+var isolationLevelNames = map[IsolationLevel]string{
+	READ_UNCOMMITTED: "READ-UNCOMMITTED",
+	READ_COMMITTED:   "READ-COMMITTED",
+	REPEATABLE_READ:  "REPEATABLE-READ",
+	SERIALIZABLE:     "SERIALIZABLE",
+}
+
+func (self IsolationLevel) String() string {
+	return isolationLevelNames[self]
+}
+
+// 解析隔离级别, 单词之间可以使用空格或者'-'分隔, 不区分大小写
+func ParseIsolationLevel(name string) (IsolationLevel, bool) {
+	name = strings.ToUpper(strings.Join(strings.Fields(strings.ReplaceAll(name, "-", " ")), "-"))
+	for level, levelName := range isolationLevelNames {
+		if levelName == name {
+			return level, true
+		}
+	}
+	return 0, false
+}
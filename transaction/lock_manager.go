@@ -0,0 +1,333 @@
+package transaction
+
+import (
+	"Relatdb/common"
+	"Relatdb/meta"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LockMode int
+
+const (
+	_ LockMode = iota
+	LOCK_S
+	LOCK_X
+)
+
+type LockType int
+
+const (
+	_ LockType = iota
+	//记录锁, 只锁定记录本身
+	LOCK_REC_NOT_GAP
+	//间隙锁, 锁定记录之前的间隙, 间隙锁之间不冲突
+	LOCK_GAP
+	//next-key锁, 锁定记录和记录之前的间隙
+	LOCK_ORDINARY
+	//插入意向锁, 插入之前检查下一个记录上的间隙锁, 获得后不保留
+	LOCK_INSERT_INTENTION
+)
+
+const DEFAULT_LOCK_WAIT_TIMEOUT = 50 * time.Second
+
+/*
+锁定的记录: 表和主键, supremum表示表的最后一个记录, 只能锁定它之前的间隙
+index不为空时锁定的是唯一索引的值
+*/
+type LockKey struct {
+	table    string
+	index    string
+	key      string
+	supremum bool
+}
+
+func NewRecordLockKey(databaseName string, tableName string, key []meta.Value) LockKey {
+	return LockKey{table: getTableKey(databaseName, tableName), key: joinLockKey(key)}
+}
+
+// 唯一索引的值, 写入或者去掉这个值的事务结束之前其他事务不能写入相同的值
+func NewUniqueLockKey(databaseName string, tableName string, indexName string, key []meta.Value) LockKey {
+	return LockKey{table: getTableKey(databaseName, tableName), index: indexName, key: joinLockKey(key)}
+}
+
+func joinLockKey(key []meta.Value) string {
+	values := make([]string, len(key))
+	for i, value := range key {
+		values[i] = value.ToString()
+	}
+	return strings.Join(values, "\x00")
+}
+
+func getTableKey(databaseName string, tableName string) string {
+	return databaseName + "." + tableName
+}
+
+func NewSupremumLockKey(databaseName string, tableName string) LockKey {
+	return LockKey{table: getTableKey(databaseName, tableName), supremum: true}
+}
+
+type LockRequest struct {
+	Key      LockKey
+	Mode     LockMode
+	LockType LockType
+}
+
+func NewLockRequest(key LockKey, mode LockMode, lockType LockType) *LockRequest {
+	if key.supremum && lockType != LOCK_INSERT_INTENTION {
+		lockType = LOCK_GAP
+	}
+	return &LockRequest{Key: key, Mode: mode, LockType: lockType}
+}
+
+type lock struct {
+	trxId    uint
+	mode     LockMode
+	lockType LockType
+}
+
+/*
+请求的锁与其他事务持有或者等待的锁是否冲突:
+插入意向锁只与间隙锁和next-key锁冲突, 其他的锁只有记录部分冲突, 共享锁之间不冲突
+等待的插入意向锁不阻塞其他的锁
+*/
+func (self *lock) conflicts(held *lock) bool {
+	if self.trxId == held.trxId || held.lockType == LOCK_INSERT_INTENTION {
+		return false
+	}
+	if self.lockType == LOCK_INSERT_INTENTION {
+		return held.lockType == LOCK_GAP || held.lockType == LOCK_ORDINARY
+	}
+	if self.lockType == LOCK_GAP || held.lockType == LOCK_GAP {
+		return false
+	}
+	return self.mode == LOCK_X || held.mode == LOCK_X
+}
+
+// 已经持有的锁包含请求的锁时不需要再次加锁
+func (self *lock) covers(request *lock) bool {
+	if self.trxId != request.trxId || self.mode < request.mode {
+		return false
+	}
+	return self.lockType == request.lockType || self.lockType == LOCK_ORDINARY
+}
+
+type lockWaiter struct {
+	key     LockKey
+	lock    *lock
+	granted bool
+	done    chan struct{}
+}
+
+type lockQueue struct {
+	granted []*lock
+	waiters []*lockWaiter
+}
+
+/*
+锁管理器: 记录上已经授予的锁和等待的请求, 事务结束时释放全部的锁
+新的请求与更早的等待者冲突时排在后面等待, 持续的共享锁不会使等待的排他锁饿死
+等待关系形成环时请求的事务作为死锁的牺牲者, 等待超过超时时间时返回错误
+*/
+type LockManager struct {
+	mutex   sync.Mutex
+	queues  map[LockKey]*lockQueue
+	trxKeys map[uint][]LockKey   //事务加锁的记录
+	waiters map[uint]*lockWaiter //等待中的事务, 每个事务同时只等待一个锁
+}
+
+func NewLockManager() *LockManager {
+	return &LockManager{
+		queues:  make(map[LockKey]*lockQueue),
+		trxKeys: make(map[uint][]LockKey),
+		waiters: make(map[uint]*lockWaiter),
+	}
+}
+
+// 不等待地加锁, 与其他事务的锁冲突时返回false
+func (self *LockManager) TryLock(trxId uint, request *LockRequest) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	lock := &lock{trxId: trxId, mode: request.Mode, lockType: request.LockType}
+	return self.grant(request.Key, lock, self.getWaiters(request.Key))
+}
+
+// 加锁, 冲突时等待持有锁的事务结束, 死锁或者等待超时时返回错误
+func (self *LockManager) Lock(trxId uint, request *LockRequest, timeout time.Duration) error {
+	self.mutex.Lock()
+	lock := &lock{trxId: trxId, mode: request.Mode, lockType: request.LockType}
+	if self.grant(request.Key, lock, self.getWaiters(request.Key)) {
+		self.mutex.Unlock()
+		return nil
+	}
+	if self.isDeadlock(request.Key, lock, self.getWaiters(request.Key)) {
+		self.mutex.Unlock()
+		return common.NewSQLError(common.ER_LOCK_DEADLOCK, "40001", "Deadlock found when trying to get lock; try restarting transaction")
+	}
+	waiter := &lockWaiter{key: request.Key, lock: lock, done: make(chan struct{})}
+	queue := self.getQueue(request.Key)
+	queue.waiters = append(queue.waiters, waiter)
+	self.waiters[trxId] = waiter
+	self.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-waiter.done:
+		return nil
+	case <-timer.C:
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if waiter.granted {
+		return nil
+	}
+	queue.waiters = slices.DeleteFunc(queue.waiters, func(other *lockWaiter) bool {
+		return other == waiter
+	})
+	delete(self.waiters, trxId)
+	self.removeEmptyQueue(request.Key, queue)
+	return common.NewSQLError(common.ER_LOCK_WAIT_TIMEOUT, "HY000", "Lock wait timeout exceeded; try restarting transaction")
+}
+
+func (self *LockManager) getQueue(key LockKey) *lockQueue {
+	queue := self.queues[key]
+	if queue == nil {
+		queue = &lockQueue{}
+		self.queues[key] = queue
+	}
+	return queue
+}
+
+// 记录上等待中的请求, 按请求的顺序排列
+func (self *LockManager) getWaiters(key LockKey) []*lockWaiter {
+	if queue := self.queues[key]; queue != nil {
+		return queue.waiters
+	}
+	return nil
+}
+
+func (self *LockManager) removeEmptyQueue(key LockKey, queue *lockQueue) {
+	if len(queue.granted) == 0 && len(queue.waiters) == 0 {
+		delete(self.queues, key)
+	}
+}
+
+/*
+与已经授予的锁和排在前面的等待者都没有冲突时授予锁
+已经持有的锁包含请求的锁时直接授予, 不需要排在等待者后面
+*/
+func (self *LockManager) grant(key LockKey, lock *lock, waiters []*lockWaiter) bool {
+	queue := self.queues[key]
+	if queue != nil {
+		for _, held := range queue.granted {
+			if lock.conflicts(held) {
+				return false
+			}
+		}
+		for _, held := range queue.granted {
+			if held.covers(lock) {
+				return true
+			}
+		}
+		for _, waiter := range waiters {
+			if lock.conflicts(waiter.lock) {
+				return false
+			}
+		}
+	}
+	if lock.lockType == LOCK_INSERT_INTENTION {
+		return true
+	}
+	queue = self.getQueue(key)
+	queue.granted = append(queue.granted, lock)
+	self.trxKeys[lock.trxId] = append(self.trxKeys[lock.trxId], key)
+	return true
+}
+
+/*
+沿等待关系查找持有冲突锁或者排在前面等待冲突锁的事务, 回到请求的事务时形成死锁
+ahead为请求前面的等待者
+*/
+func (self *LockManager) isDeadlock(key LockKey, request *lock, ahead []*lockWaiter) bool {
+	visited := make(map[uint]bool)
+	var waitsFor func(key LockKey, lock *lock, ahead []*lockWaiter) bool
+	waitsFor = func(key LockKey, lock *lock, ahead []*lockWaiter) bool {
+		queue := self.queues[key]
+		if queue == nil {
+			return false
+		}
+		locks := slices.Clone(queue.granted)
+		for _, waiter := range ahead {
+			locks = append(locks, waiter.lock)
+		}
+		for _, held := range locks {
+			if !lock.conflicts(held) {
+				continue
+			}
+			if held.trxId == request.trxId {
+				return true
+			}
+			if visited[held.trxId] {
+				continue
+			}
+			visited[held.trxId] = true
+			waiter := self.waiters[held.trxId]
+			if waiter == nil {
+				continue
+			}
+			waiters := self.getWaiters(waiter.key)
+			if waitsFor(waiter.key, waiter.lock, waiters[:slices.Index(waiters, waiter)]) {
+				return true
+			}
+		}
+		return false
+	}
+	return waitsFor(key, request, ahead)
+}
+
+// 释放事务的全部锁, 唤醒可以获得锁的等待者
+func (self *LockManager) ReleaseLocks(trxId uint) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	keys := self.trxKeys[trxId]
+	delete(self.trxKeys, trxId)
+	for _, key := range keys {
+		queue := self.queues[key]
+		if queue == nil {
+			continue
+		}
+		queue.granted = slices.DeleteFunc(queue.granted, func(held *lock) bool {
+			return held.trxId == trxId
+		})
+		waiters := queue.waiters
+		queue.waiters = nil
+		for _, waiter := range waiters {
+			if self.grant(key, waiter.lock, queue.waiters) {
+				waiter.granted = true
+				delete(self.waiters, waiter.lock.trxId)
+				close(waiter.done)
+			} else {
+				queue.waiters = append(queue.waiters, waiter)
+			}
+		}
+		self.removeEmptyQueue(key, queue)
+	}
+}
+
+// 记录被物理删除后, 记录上的间隙锁由下一个记录继承, 间隙仍然受到保护
+func (self *LockManager) InheritGapLocks(from LockKey, to LockKey) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	queue := self.queues[from]
+	if queue == nil {
+		return
+	}
+	for _, held := range slices.Clone(queue.granted) {
+		if held.lockType == LOCK_GAP || held.lockType == LOCK_ORDINARY {
+			self.grant(to, &lock{trxId: held.trxId, mode: held.mode, lockType: LOCK_GAP}, nil)
+		}
+	}
+}
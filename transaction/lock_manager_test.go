@@ -0,0 +1,170 @@
+package transaction
+
+import (
+	"Relatdb/common"
+	"Relatdb/meta"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLockKey(id int) LockKey {
+	return NewRecordLockKey("default", "t", []meta.Value{meta.IntValue(id)})
+}
+
+// 在另一个goroutine中加锁, 返回加锁的结果
+func lockAsync(manager *LockManager, trxId uint, request *LockRequest, timeout time.Duration) chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.Lock(trxId, request, timeout)
+	}()
+	return done
+}
+
+// 等待另一个goroutine中的请求进入等待队列
+func waitQueued(t *testing.T, manager *LockManager, trxId uint) {
+	t.Helper()
+	for range 100 {
+		manager.mutex.Lock()
+		waiter := manager.waiters[trxId]
+		manager.mutex.Unlock()
+		if waiter != nil {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected trx %d to wait", trxId)
+}
+
+func assertLockError(t *testing.T, err error, code uint16) {
+	t.Helper()
+	var sqlError *common.SQLError
+	if !errors.As(err, &sqlError) || sqlError.Code != code {
+		t.Fatalf("expected error %d, got %v", code, err)
+	}
+}
+
+func TestLockConflicts(t *testing.T) {
+	manager := NewLockManager()
+	key := newTestLockKey(1)
+	if !manager.TryLock(1, NewLockRequest(key, LOCK_S, LOCK_REC_NOT_GAP)) || !manager.TryLock(2, NewLockRequest(key, LOCK_S, LOCK_ORDINARY)) {
+		t.Fatal("expected shared locks to be compatible")
+	}
+	if manager.TryLock(3, NewLockRequest(key, LOCK_X, LOCK_REC_NOT_GAP)) {
+		t.Fatal("expected an exclusive lock to conflict with shared locks")
+	}
+	//已经持有的next-key锁包含记录锁
+	if !manager.TryLock(2, NewLockRequest(key, LOCK_S, LOCK_REC_NOT_GAP)) {
+		t.Fatal("expected the held next-key lock to cover the record lock")
+	}
+	manager.ReleaseLocks(1)
+	manager.ReleaseLocks(2)
+	if !manager.TryLock(3, NewLockRequest(key, LOCK_X, LOCK_REC_NOT_GAP)) {
+		t.Fatal("expected the exclusive lock after the shared locks are released")
+	}
+}
+
+func TestGapLock(t *testing.T) {
+	manager := NewLockManager()
+	key := newTestLockKey(1)
+	//间隙锁之间不冲突, 也不与记录锁冲突
+	if !manager.TryLock(1, NewLockRequest(key, LOCK_X, LOCK_GAP)) || !manager.TryLock(2, NewLockRequest(key, LOCK_X, LOCK_GAP)) {
+		t.Fatal("expected gap locks to be compatible")
+	}
+	if !manager.TryLock(3, NewLockRequest(key, LOCK_X, LOCK_REC_NOT_GAP)) {
+		t.Fatal("expected a record lock to be compatible with gap locks")
+	}
+	//插入意向锁与间隙锁冲突, 获得后不保留
+	if manager.TryLock(4, NewLockRequest(key, LOCK_X, LOCK_INSERT_INTENTION)) {
+		t.Fatal("expected the insert intention lock to conflict with gap locks")
+	}
+	manager.ReleaseLocks(1)
+	done := lockAsync(manager, 4, NewLockRequest(key, LOCK_X, LOCK_INSERT_INTENTION), time.Second)
+	waitQueued(t, manager, 4)
+	//等待的插入意向锁不阻塞其他的锁
+	if !manager.TryLock(5, NewLockRequest(key, LOCK_S, LOCK_GAP)) {
+		t.Fatal("expected a waiting insert intention lock not to block gap locks")
+	}
+	manager.ReleaseLocks(2)
+	manager.ReleaseLocks(5)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(manager.trxKeys[4]) != 0 {
+		t.Fatal("expected the insert intention lock not to be kept")
+	}
+
+	//supremum只能锁定间隙
+	supremum := NewSupremumLockKey("default", "t")
+	if !manager.TryLock(1, NewLockRequest(supremum, LOCK_X, LOCK_ORDINARY)) || !manager.TryLock(2, NewLockRequest(supremum, LOCK_X, LOCK_ORDINARY)) {
+		t.Fatal("expected locks on the supremum to be gap locks")
+	}
+}
+
+// 排在前面等待的排他锁阻止之后的共享锁, 不会被持续的共享锁饿死
+func TestLockWaitFifo(t *testing.T) {
+	manager := NewLockManager()
+	key := newTestLockKey(1)
+	manager.TryLock(1, NewLockRequest(key, LOCK_S, LOCK_REC_NOT_GAP))
+	done := lockAsync(manager, 2, NewLockRequest(key, LOCK_X, LOCK_REC_NOT_GAP), time.Second)
+	waitQueued(t, manager, 2)
+	if manager.TryLock(3, NewLockRequest(key, LOCK_S, LOCK_REC_NOT_GAP)) {
+		t.Fatal("expected a shared lock to wait behind the exclusive waiter")
+	}
+	//已经持有的锁不需要排队
+	if !manager.TryLock(1, NewLockRequest(key, LOCK_S, LOCK_REC_NOT_GAP)) {
+		t.Fatal("expected the held lock to be granted again")
+	}
+	shared := lockAsync(manager, 3, NewLockRequest(key, LOCK_S, LOCK_REC_NOT_GAP), time.Second)
+	waitQueued(t, manager, 3)
+	manager.ReleaseLocks(1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-shared:
+		t.Fatalf("expected the shared lock to wait for the exclusive lock, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	manager.ReleaseLocks(2)
+	if err := <-shared; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockWaitTimeout(t *testing.T) {
+	manager := NewLockManager()
+	key := newTestLockKey(1)
+	manager.TryLock(1, NewLockRequest(key, LOCK_X, LOCK_REC_NOT_GAP))
+	assertLockError(t, manager.Lock(2, NewLockRequest(key, LOCK_S, LOCK_REC_NOT_GAP), 10*time.Millisecond), common.ER_LOCK_WAIT_TIMEOUT)
+	//超时的请求离开等待队列
+	manager.ReleaseLocks(1)
+	if len(manager.queues) != 0 || len(manager.waiters) != 0 {
+		t.Fatalf("expected no lock queues, got %v", manager.queues)
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	manager := NewLockManager()
+	a, b := newTestLockKey(1), newTestLockKey(2)
+	manager.TryLock(1, NewLockRequest(a, LOCK_X, LOCK_REC_NOT_GAP))
+	manager.TryLock(2, NewLockRequest(b, LOCK_X, LOCK_REC_NOT_GAP))
+	done := lockAsync(manager, 1, NewLockRequest(b, LOCK_X, LOCK_REC_NOT_GAP), time.Second)
+	waitQueued(t, manager, 1)
+	assertLockError(t, manager.Lock(2, NewLockRequest(a, LOCK_X, LOCK_REC_NOT_GAP), time.Second), common.ER_LOCK_DEADLOCK)
+	manager.ReleaseLocks(2)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	//等待排在前面的等待者同样形成死锁: 3持有共享锁, 4等待排他锁, 3升级为排他锁时排在4后面
+	manager = NewLockManager()
+	manager.TryLock(3, NewLockRequest(a, LOCK_S, LOCK_REC_NOT_GAP))
+	done = lockAsync(manager, 4, NewLockRequest(a, LOCK_X, LOCK_REC_NOT_GAP), time.Second)
+	waitQueued(t, manager, 4)
+	assertLockError(t, manager.Lock(3, NewLockRequest(a, LOCK_X, LOCK_REC_NOT_GAP), time.Second), common.ER_LOCK_DEADLOCK)
+	manager.ReleaseLocks(3)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,11 @@
 package transaction
 
-import "Relatdb/meta"
+import (
+	"Relatdb/common"
+	"Relatdb/meta"
+	"hash/crc32"
+	"time"
+)
 
 type LogType int
 
@@ -10,6 +15,11 @@ const (
 	ROLL_BACK
 	COMMIT
 	ROW
+	CHECKPOINT
+	PREPARE
+	CREATE_TABLE
+	DROP_TABLE
+	ALTER_TABLE
 )
 
 type OpType int
@@ -22,38 +32,225 @@ const (
 )
 
 type TrxLog struct {
-	lsn       uint64
-	logType   LogType
-	trxId     uint
-	tableName string
-	opType    OpType
-	before    meta.IndexEntry
-	after     meta.IndexEntry
+	lsn          uint64
+	logType      LogType
+	trxId        uint
+	databaseName string
+	tableName    string
+	opType       OpType
+	before       meta.IndexEntry
+	after        meta.IndexEntry
 }
 
 func NewTrxLog(
 	trxId uint, logType LogType,
-	tableName string, opType OpType,
+	databaseName string, tableName string, opType OpType,
 	before meta.IndexEntry, after meta.IndexEntry,
 ) *TrxLog {
 	return &TrxLog{
-		lsn:       0,
-		logType:   logType,
-		trxId:     trxId,
-		tableName: tableName,
-		opType:    opType,
-		before:    before,
-		after:     after,
+		lsn:          0,
+		logType:      logType,
+		trxId:        trxId,
+		databaseName: databaseName,
+		tableName:    tableName,
+		opType:       opType,
+		before:       before,
+		after:        after,
 	}
 }
 
 func NewTrxStartLog(trxId uint) *TrxLog {
-	return NewTrxLog(trxId, TRX_START, "", 0, nil, nil)
+	return NewTrxLog(trxId, TRX_START, "", "", 0, nil, nil)
+}
+
+// 提交记录保存提交的时间, 用于按时间点恢复
+func NewTrxCommitLog(trxId uint) *TrxLog {
+	return NewTrxLog(trxId, COMMIT, "", "", 0, nil, newTimeEntry())
+}
+
+func NewTrxRollbackLog(trxId uint) *TrxLog {
+	return NewTrxLog(trxId, ROLL_BACK, "", "", 0, nil, nil)
+}
+
+// 检查点记录保存恢复时开始重做的LSN和下一个事务ID
+func NewCheckpointLog(redoLsn uint64, nextTrxId uint) *TrxLog {
+	values := []meta.Value{meta.Int64Value(redoLsn), meta.Int64Value(nextTrxId)}
+	return NewTrxLog(0, CHECKPOINT, "", "", 0, nil, meta.NewIndexEntry(values, nil))
+}
+
+func (self *TrxLog) getRedoLsn() uint64 {
+	return uint64(self.after.GetValues()[0].ToInt64())
+}
+
+func (self *TrxLog) getNextTrxId() uint {
+	return uint(self.after.GetValues()[1].ToInt64())
+}
+
+// 建表记录保存时间和表的描述页, 恢复时重新创建空表
+func NewCreateTableLog(databaseName string, tableName string, tableMeta []byte) *TrxLog {
+	values := []meta.Value{meta.Int64Value(time.Now().UnixNano()), meta.StringValue(tableMeta)}
+	return NewTrxLog(0, CREATE_TABLE, databaseName, tableName, 0, nil, meta.NewIndexEntry(values, nil))
+}
+
+// 修改表定义的记录与建表记录相同, 保存修改之后的描述页, 恢复时按描述页重建二级索引
+func NewAlterTableLog(databaseName string, tableName string, tableMeta []byte) *TrxLog {
+	values := []meta.Value{meta.Int64Value(time.Now().UnixNano()), meta.StringValue(tableMeta)}
+	return NewTrxLog(0, ALTER_TABLE, databaseName, tableName, 0, nil, meta.NewIndexEntry(values, nil))
+}
+
+func NewDropTableLog(databaseName string, tableName string) *TrxLog {
+	return NewTrxLog(0, DROP_TABLE, databaseName, tableName, 0, nil, newTimeEntry())
+}
+
+func newTimeEntry() meta.IndexEntry {
+	return meta.NewIndexEntry([]meta.Value{meta.Int64Value(time.Now().UnixNano())}, nil)
+}
+
+// 提交和表定义记录的时间, 旧版本的提交记录没有时间
+func (self *TrxLog) getTime() (time.Time, bool) {
+	switch self.logType {
+	case COMMIT, CREATE_TABLE, DROP_TABLE, ALTER_TABLE:
+		if self.after != nil {
+			return time.Unix(0, self.after.GetValues()[0].ToInt64()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (self *TrxLog) GetTableMeta() []byte {
+	return []byte(self.after.GetValues()[1].ToString())
 }
 
 func NewRowLog(
-	trxId uint, tableName string, opType OpType,
+	trxId uint, databaseName string, tableName string, opType OpType,
 	before meta.IndexEntry, after meta.IndexEntry,
 ) *TrxLog {
-	return NewTrxLog(trxId, ROW, tableName, opType, before, after)
+	return NewTrxLog(trxId, ROW, databaseName, tableName, opType, before, after)
+}
+
+func (self *TrxLog) GetLsn() uint64 {
+	return self.lsn
+}
+
+func (self *TrxLog) GetLogType() LogType {
+	return self.logType
+}
+
+func (self *TrxLog) GetTrxId() uint {
+	return self.trxId
+}
+
+func (self *TrxLog) GetDatabaseName() string {
+	return self.databaseName
+}
+
+func (self *TrxLog) GetTableName() string {
+	return self.tableName
+}
+
+func (self *TrxLog) GetOpType() OpType {
+	return self.opType
+}
+
+// 从日志文件读取的前后镜像只包含字段值, 需要按表的描述重新构建ClusterIndexEntry
+func (self *TrxLog) GetBefore() meta.IndexEntry {
+	return self.before
+}
+
+func (self *TrxLog) GetAfter() meta.IndexEntry {
+	return self.after
+}
+
+// 撤销行日志的补偿日志, 前后镜像互换
+func (self *TrxLog) newCompensationLog() *TrxLog {
+	opType := self.opType
+	switch opType {
+	case INSERT:
+		opType = DELETE
+	case DELETE:
+		opType = INSERT
+	}
+	return NewRowLog(self.trxId, self.databaseName, self.tableName, opType, self.after, self.before)
+}
+
+/*
+日志记录的格式(小端):
+Length(4) | CRC(4) | LSN(8) | LogType(1) | TrxId(8) | OpType(1) | DatabaseName | TableName | Before | After
+字符串和镜像以4字节长度开头, 镜像长度为-1时表示没有, CRC为其后全部内容的校验和
+*/
+const LOG_HEADER_SIZE = 8
+
+func writeLogString(buffer *common.Buffer, s string) {
+	buffer.WriteInt(len(s))
+	buffer.WriteString(s)
+}
+
+func readLogString(buffer *common.Buffer) string {
+	return string(buffer.ReadBytes(uint(buffer.ReadInt())))
+}
+
+func entryToBytes(entry meta.IndexEntry) []byte {
+	if entry == nil {
+		return nil
+	}
+	return meta.ValuesToBytes(entry.GetValues())
+}
+
+func writeLogEntry(buffer *common.Buffer, data []byte, exist bool) {
+	if !exist {
+		buffer.WriteInt(-1)
+		return
+	}
+	buffer.WriteInt(len(data))
+	buffer.WriteBytes(data)
+}
+
+func readLogEntry(buffer *common.Buffer) meta.IndexEntry {
+	length := int32(buffer.ReadInt())
+	if length < 0 {
+		return nil
+	}
+	return meta.NewIndexEntry(meta.BytesToValues(buffer.ReadBytes(uint(length))), nil)
+}
+
+func (self *TrxLog) encode() []byte {
+	before, after := entryToBytes(self.before), entryToBytes(self.after)
+	payloadSize := 8 + 1 + 8 + 1 + 4 + len(self.databaseName) + 4 + len(self.tableName) + 4 + len(before) + 4 + len(after)
+	buffer := common.NewBufferBySize(uint(LOG_HEADER_SIZE + payloadSize))
+	buffer.WriteInt(payloadSize)
+	buffer.WriteInt(0)
+	buffer.WriteInt64(int64(self.lsn))
+	buffer.WriteByte(byte(self.logType))
+	buffer.WriteInt64(int64(self.trxId))
+	buffer.WriteByte(byte(self.opType))
+	writeLogString(buffer, self.databaseName)
+	writeLogString(buffer, self.tableName)
+	writeLogEntry(buffer, before, self.before != nil)
+	writeLogEntry(buffer, after, self.after != nil)
+	buffer.WriteIntByPos(4, int(crc32.ChecksumIEEE(buffer.Data[LOG_HEADER_SIZE:])))
+	return buffer.Data
+}
+
+// 解码一条日志记录, 返回记录占用的字节数, 数据不完整或校验失败时返回0
+func decodeTrxLog(data []byte) (*TrxLog, int) {
+	if len(data) < LOG_HEADER_SIZE {
+		return nil, 0
+	}
+	buffer := common.NewBuffer(data)
+	payloadSize := buffer.ReadInt()
+	checksum := uint32(buffer.ReadInt())
+	size := LOG_HEADER_SIZE + payloadSize
+	if payloadSize <= 0 || size > len(data) || crc32.ChecksumIEEE(data[LOG_HEADER_SIZE:size]) != checksum {
+		return nil, 0
+	}
+	log := &TrxLog{}
+	log.lsn = uint64(buffer.ReadInt64())
+	log.logType = LogType(buffer.ReadByte())
+	log.trxId = uint(buffer.ReadInt64())
+	log.opType = OpType(buffer.ReadByte())
+	log.databaseName = readLogString(buffer)
+	log.tableName = readLogString(buffer)
+	log.before = readLogEntry(buffer)
+	log.after = readLogEntry(buffer)
+	return log, size
 }
@@ -1,8 +1,550 @@
 package transaction
 
+import (
+	"Relatdb/utils"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	LOG_SUFFIX               = ".wal"
+	DEFAULT_LOG_SEGMENT_SIZE = 64 * 1024 * 1024
+)
+
+/*
+预写日志: 只追加写入, LSN从1开始单调递增
+日志按段存储, 段文件以其第一条记录的LSN命名, 当前段超过段大小时切换到新段
+提交和回滚记录写入后等待同步到磁盘, 同时提交的事务由一次同步完成(组提交)
+检查点之后, 全部位于重做LSN之前的段不再需要, 设置了归档目录时移动到归档目录, 否则删除
+*/
 type LogStore struct {
+	mutex         sync.Mutex
+	path          string          //日志目录
+	archivePath   string          //归档目录, 为空时删除不再需要的段
+	segmentSize   int64           //段大小
+	segments      []uint64        //各段第一条记录的LSN
+	file          *os.File        //当前段
+	fileSize      int64           //当前段大小
+	nextLsn       uint64          //下一条记录的LSN
+	syncedLsn     uint64          //已同步到磁盘的LSN
+	syncing       bool            //组提交的同步进行中, 同步时不持有锁
+	syncCond      *sync.Cond      //等待组提交的同步结束
+	retiredFiles  []*os.File      //同步进行中切换出的段, 同步结束后关闭
+	syncCount     uint64          //启动之后同步的次数
+	nextTrxId     uint            //下一个事务ID
+	activeTrxs    map[uint]uint64 //未完成的事务及其开始记录的LSN
+	checkpointLsn uint64          //最后一个检查点的重做LSN
+	checkpointPos uint64          //最后一个检查点记录的LSN
+	checkpoints   uint64          //启动之后写入的检查点数量
+	removedCount  uint64          //启动之后删除或归档的段数量
+	retainLsn     uint64          //在线备份需要的第一个LSN, 包含之后日志的段不删除, 为0时不保留
+	readViews     map[*ReadView]bool
+	lockManager   *LockManager
+	xaTrxs        map[Xid]*Trx //未结束的XA事务
+}
+
+func NewLogStore(path string, segmentSize int64, archivePath string) *LogStore {
+	if segmentSize <= 0 {
+		segmentSize = DEFAULT_LOG_SEGMENT_SIZE
+	}
+	_ = os.MkdirAll(path, os.ModePerm)
+	if archivePath != "" {
+		_ = os.MkdirAll(archivePath, os.ModePerm)
+	}
+	logStore := &LogStore{
+		path:          path,
+		archivePath:   archivePath,
+		segmentSize:   segmentSize,
+		nextLsn:       1,
+		nextTrxId:     1,
+		activeTrxs:    make(map[uint]uint64),
+		checkpointLsn: 1,
+		readViews:     make(map[*ReadView]bool),
+		lockManager:   NewLockManager(),
+		xaTrxs:        make(map[Xid]*Trx),
+	}
+	logStore.syncCond = sync.NewCond(&logStore.mutex)
+	logStore.open()
+	logStore.ReadLogs(1, logStore.trackLog)
+	return logStore
+}
+
+func (self *LogStore) getSegmentPath(startLsn uint64) string {
+	return getSegmentPath(self.path, startLsn)
+}
+
+func getSegmentPath(path string, startLsn uint64) string {
+	return utils.ConcatFilePaths(path, fmt.Sprintf("%020d%s", startLsn, LOG_SUFFIX))
+}
+
+// 目录中的段, 按第一条记录的LSN排序
+func listSegments(path string) []uint64 {
+	var segments []uint64
+	entries, _ := os.ReadDir(path)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if !strings.HasSuffix(fileName, LOG_SUFFIX) {
+			continue
+		}
+		startLsn, err := strconv.ParseUint(strings.TrimSuffix(fileName, LOG_SUFFIX), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, startLsn)
+	}
+	slices.Sort(segments)
+	return segments
+}
+
+// 打开最后一个段, 截断末尾不完整的记录
+func (self *LogStore) open() {
+	self.segments = listSegments(self.path)
+	if len(self.segments) == 0 {
+		self.createSegment(self.nextLsn)
+		return
+	}
+	startLsn := self.segments[len(self.segments)-1]
+	segmentPath := self.getSegmentPath(startLsn)
+	data, err := os.ReadFile(segmentPath)
+	if err != nil {
+		panic(err)
+	}
+	self.nextLsn = startLsn
+	offset := 0
+	for {
+		log, size := decodeTrxLog(data[offset:])
+		if log == nil {
+			break
+		}
+		self.nextLsn = log.lsn + 1
+		offset += size
+	}
+	file, err := os.OpenFile(segmentPath, os.O_RDWR, os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+	if offset < len(data) {
+		if err = file.Truncate(int64(offset)); err != nil {
+			panic(err)
+		}
+	}
+	if _, err = file.Seek(int64(offset), 0); err != nil {
+		panic(err)
+	}
+	self.file = file
+	self.fileSize = int64(offset)
+	self.syncedLsn = self.nextLsn - 1
+}
+
+func (self *LogStore) createSegment(startLsn uint64) {
+	file, err := os.OpenFile(self.getSegmentPath(startLsn), os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+	self.segments = append(self.segments, startLsn)
+	self.file = file
+	self.fileSize = 0
+}
+
+// 当前段写满时同步并切换到新段, 组提交正在同步当前段时由它关闭
+func (self *LogStore) rotate() {
+	self.sync()
+	if self.syncing {
+		self.retiredFiles = append(self.retiredFiles, self.file)
+	} else {
+		self.file.Close()
+	}
+	self.createSegment(self.nextLsn)
+}
+
+// 记录事务的开始和结束, 以及检查点
+func (self *LogStore) trackLog(log *TrxLog) {
+	switch log.logType {
+	case TRX_START:
+		self.activeTrxs[log.trxId] = log.lsn
+	case COMMIT, ROLL_BACK:
+		delete(self.activeTrxs, log.trxId)
+	case CHECKPOINT:
+		self.checkpointLsn = log.getRedoLsn()
+		self.checkpointPos = log.lsn
+		self.nextTrxId = max(self.nextTrxId, log.getNextTrxId())
+	}
+	self.nextTrxId = max(self.nextTrxId, log.trxId+1)
+}
+
+// 追加日志并分配LSN, 提交和回滚记录会同步到磁盘
+func (self *LogStore) AppendLog(log *TrxLog) uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	lsn := self.appendLog(log)
+	if isDurableLog(log) {
+		self.waitSynced(lsn)
+	}
+	return lsn
+}
+
+// 写入后需要同步到磁盘的日志
+func isDurableLog(log *TrxLog) bool {
+	switch log.logType {
+	case COMMIT, ROLL_BACK, CHECKPOINT, PREPARE, CREATE_TABLE, DROP_TABLE, ALTER_TABLE:
+		return true
+	}
+	return false
+}
+
+/*
+组提交: 等待lsn之前的日志同步到磁盘, 调用时持有锁
+没有同步进行中时, 作为领导者释放锁后同步当前已写入的全部日志, 同步期间其他事务继续写入并等待
+同步结束后唤醒等待者, 还没有被同步的等待者中的一个成为下一次同步的领导者
+日志按LSN顺序写入, 同步到某个LSN时之前的日志都已经持久化
+*/
+func (self *LogStore) waitSynced(lsn uint64) {
+	for self.syncedLsn < lsn {
+		if self.syncing {
+			self.syncCond.Wait()
+			continue
+		}
+		self.syncing = true
+		file, lastLsn := self.file, self.nextLsn-1
+		self.mutex.Unlock()
+		err := file.Sync()
+		self.mutex.Lock()
+		self.syncing = false
+		for _, retiredFile := range self.retiredFiles {
+			retiredFile.Close()
+		}
+		self.retiredFiles = nil
+		self.syncCond.Broadcast()
+		if err != nil {
+			panic(err)
+		}
+		self.syncedLsn = max(self.syncedLsn, lastLsn)
+		self.syncCount++
+	}
+}
+
+func (self *LogStore) appendLog(log *TrxLog) uint64 {
+	if self.fileSize >= self.segmentSize {
+		self.rotate()
+	}
+	log.lsn = self.nextLsn
+	data := log.encode()
+	if _, err := self.file.Write(data); err != nil {
+		panic(err)
+	}
+	self.nextLsn++
+	self.fileSize += int64(len(data))
+	self.trackLog(log)
+	return log.lsn
+}
+
+// 分配事务ID并写入开始记录, 读视图创建时事务要么还没有分配ID, 要么已经是活跃的事务
+func (self *LogStore) BeginTrx(isolationLevel IsolationLevel) *Trx {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	trx := NewTrx(self.nextTrxId, self)
+	trx.isolationLevel = isolationLevel
+	self.appendLog(NewTrxStartLog(trx.trxId))
+	trx.state = TRX_STATE_ACTIVE
+	return trx
+}
+
+/*
+写入提交记录, 提交记录写入后事务对新的读视图可见
+等待同步时释放锁, 同步之后事务才释放行锁
+*/
+func (self *LogStore) commitTrx(trx *Trx) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if trx.xid != nil {
+		delete(self.xaTrxs, *trx.xid)
+	}
+	self.waitSynced(self.appendLog(NewTrxCommitLog(trx.trxId)))
+}
+
+func (self *LogStore) GetLockManager() *LockManager {
+	return self.lockManager
+}
+
+// 登记XA事务, xid已经存在时返回false
+func (self *LogStore) startXa(trx *Trx, xid Xid) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.xaTrxs[xid] != nil {
+		return false
+	}
+	self.xaTrxs[xid] = trx
+	return true
+}
+
+// 写入准备记录, 准备记录同步到磁盘后事务只能由协调者提交或回滚
+func (self *LogStore) prepareTrx(trx *Trx) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.waitSynced(self.appendLog(NewTrxPrepareLog(trx.trxId, trx.xid)))
+}
+
+func (self *LogStore) removeXaTrx(trx *Trx) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if trx.xid != nil && self.xaTrxs[*trx.xid] == trx {
+		delete(self.xaTrxs, *trx.xid)
+	}
+}
+
+// 取出已经准备的XA事务用于提交或回滚, 同一个事务只能被取出一次
+func (self *LogStore) TakePreparedTrx(xid Xid) *Trx {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	trx := self.xaTrxs[xid]
+	if trx == nil || trx.state != TRX_STATE_PREPARED {
+		return nil
+	}
+	delete(self.xaTrxs, xid)
+	return trx
 }
 
-func (self *LogStore) AppendLog(log *TrxLog) {
+// 已经准备的XA事务, 按事务ID排序
+func (self *LogStore) GetPreparedXids() []Xid {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	var trxs []*Trx
+	for _, trx := range self.xaTrxs {
+		if trx.state == TRX_STATE_PREPARED {
+			trxs = append(trxs, trx)
+		}
+	}
+	slices.SortFunc(trxs, func(a *Trx, b *Trx) int {
+		return int(a.trxId) - int(b.trxId)
+	})
+	xids := make([]Xid, len(trxs))
+	for i, trx := range trxs {
+		xids[i] = *trx.xid
+	}
+	return xids
+}
+
+// 按当前活跃的事务创建读视图, 使用完后需要调用CloseReadView
+func (self *LogStore) CreateReadView(creatorTrxId uint) *ReadView {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	view := &ReadView{
+		creatorTrxId: creatorTrxId,
+		upLimitId:    self.nextTrxId,
+		lowLimitId:   self.nextTrxId,
+		activeTrxIds: make(map[uint]bool, len(self.activeTrxs)),
+	}
+	for trxId := range self.activeTrxs {
+		view.activeTrxIds[trxId] = true
+		view.upLimitId = min(view.upLimitId, trxId)
+	}
+	self.readViews[view] = true
+	return view
+}
+
+func (self *LogStore) CloseReadView(view *ReadView) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.readViews, view)
+}
+
+// 清除的界限: 之前的事务都已经结束, 并且它们的修改对所有读视图可见
+func (self *LogStore) GetPurgeLimit() uint {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.getPurgeLimit()
+}
+
+func (self *LogStore) getPurgeLimit() uint {
+	purgeLimit := self.nextTrxId
+	for trxId := range self.activeTrxs {
+		purgeLimit = min(purgeLimit, trxId)
+	}
+	for view := range self.readViews {
+		purgeLimit = min(purgeLimit, view.upLimitId)
+	}
+	return purgeLimit
+}
+
+// 恢复时需要重做的第一个LSN: 未完成事务的最小开始LSN, 没有未完成事务时为下一条记录的LSN
+func (self *LogStore) GetRedoLsn() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	redoLsn := self.nextLsn
+	for _, lsn := range self.activeTrxs {
+		redoLsn = min(redoLsn, lsn)
+	}
+	return redoLsn
+}
+
+/*
+写入检查点记录, redoLsn之前的修改必须已经写回数据文件
+上一个检查点之后没有新的日志, 并且重做的范围没有变化时不再写入
+检查点记录同步到磁盘之后, 删除或归档redoLsn之前的段
+*/
+func (self *LogStore) Checkpoint(redoLsn uint64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.checkpointPos > 0 && self.checkpointPos == self.nextLsn-1 && min(redoLsn, self.checkpointPos) == self.checkpointLsn {
+		return
+	}
+	self.waitSynced(self.appendLog(NewCheckpointLog(redoLsn, self.nextTrxId)))
+	self.checkpoints++
+	self.removeSegments(redoLsn)
+}
+
+// 保留包含retainLsn及之后日志的段, 直到ReleaseLogs
+func (self *LogStore) RetainLogs(retainLsn uint64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.retainLsn = retainLsn
+}
+
+func (self *LogStore) ReleaseLogs() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.retainLsn = 0
+}
+
+// 删除或归档全部位于redoLsn之前的段, 当前段和需要保留的段不删除
+func (self *LogStore) removeSegments(redoLsn uint64) {
+	if self.retainLsn > 0 {
+		redoLsn = min(redoLsn, self.retainLsn)
+	}
+	count := 0
+	for count+1 < len(self.segments) && self.segments[count+1] <= redoLsn {
+		segmentPath := self.getSegmentPath(self.segments[count])
+		var err error
+		if self.archivePath != "" {
+			err = utils.MoveFile(segmentPath, getSegmentPath(self.archivePath, self.segments[count]))
+		} else {
+			err = os.Remove(segmentPath)
+		}
+		if err != nil {
+			panic(err)
+		}
+		count++
+	}
+	self.segments = self.segments[count:]
+	self.removedCount += uint64(count)
+}
+
+// 当前段不为空时切换到新段, 之前的段在之后的检查点可以被删除或归档
+func (self *LogStore) SwitchSegment() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.fileSize > 0 {
+		self.rotate()
+	}
+}
+
+// 下一条记录的LSN
+func (self *LogStore) GetNextLsn() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.nextLsn
+}
+
+// 下一个开始的事务的ID, 之前开始的事务都已经分配
+func (self *LogStore) GetNextTrxId() uint {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.nextTrxId
+}
+
+// 日志的状态, 用于SHOW STATUS
+type LogStatus struct {
+	LastLsn         uint64
+	CheckpointLsn   uint64
+	Checkpoints     uint64
+	Segments        int
+	RemovedSegments uint64
+	Syncs           uint64
+}
+
+func (self *LogStore) GetStatus() LogStatus {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return LogStatus{
+		LastLsn:         self.nextLsn - 1,
+		CheckpointLsn:   self.checkpointLsn,
+		Checkpoints:     self.checkpoints,
+		Segments:        len(self.segments),
+		RemovedSegments: self.removedCount,
+		Syncs:           self.syncCount,
+	}
+}
+
+// 最后一个检查点的重做LSN, 没有检查点时为1
+func (self *LogStore) GetCheckpointLsn() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.checkpointLsn
+}
+
+func (self *LogStore) sync() {
+	if self.syncedLsn+1 == self.nextLsn {
+		return
+	}
+	if err := self.file.Sync(); err != nil {
+		panic(err)
+	}
+	self.syncedLsn = self.nextLsn - 1
+	self.syncCount++
+}
+
+// 将已写入的日志同步到磁盘
+func (self *LogStore) Sync() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.sync()
+}
+
+// 最后一条记录的LSN, 没有记录时为0
+func (self *LogStore) GetLastLsn() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.nextLsn - 1
+}
+
+// 按LSN顺序读取不小于fromLsn的日志
+func (self *LogStore) ReadLogs(fromLsn uint64, handler func(log *TrxLog)) {
+	self.mutex.Lock()
+	segments := slices.Clone(self.segments)
+	lastLsn := self.nextLsn - 1
+	self.mutex.Unlock()
+	for i, startLsn := range segments {
+		if i+1 < len(segments) && segments[i+1] <= fromLsn {
+			continue
+		}
+		data, err := os.ReadFile(self.getSegmentPath(startLsn))
+		if err != nil {
+			panic(err)
+		}
+		offset := 0
+		for {
+			log, size := decodeTrxLog(data[offset:])
+			if log == nil || log.lsn > lastLsn {
+				break
+			}
+			offset += size
+			if log.lsn >= fromLsn {
+				handler(log)
+			}
+		}
+	}
+}
 
+func (self *LogStore) Close() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for self.syncing {
+		self.syncCond.Wait()
+	}
+	self.sync()
+	self.file.Close()
 }
@@ -0,0 +1,108 @@
+package transaction
+
+import (
+	"Relatdb/meta"
+	"os"
+	"testing"
+)
+
+func newTestRowLog(trxId uint, id int) *TrxLog {
+	after := meta.NewClusterIndexEntry([]meta.Value{meta.IntValue(id)}, nil)
+	return NewRowLog(trxId, "default", "t", INSERT, nil, after)
+}
+
+// 按顺序读取全部日志的LSN
+func readLsns(logStore *LogStore) []uint64 {
+	var lsns []uint64
+	logStore.ReadLogs(1, func(log *TrxLog) {
+		lsns = append(lsns, log.GetLsn())
+	})
+	return lsns
+}
+
+func assertLsns(t *testing.T, lsns []uint64, count int) {
+	t.Helper()
+	if len(lsns) != count {
+		t.Fatalf("expected %d logs, got %d", count, len(lsns))
+	}
+	for i, lsn := range lsns {
+		if lsn != uint64(i+1) {
+			t.Fatalf("expected lsn %d, got %d", i+1, lsn)
+		}
+	}
+}
+
+// 当前段写满时切换到以下一条记录的LSN命名的新段, 重新打开后继续追加
+func TestLogSegments(t *testing.T) {
+	path := t.TempDir()
+	logStore := NewLogStore(path, 256, "")
+	for id := 1; id <= 100; id++ {
+		logStore.AppendLog(newTestRowLog(1, id))
+	}
+	logStore.Close()
+	segments := listSegments(path)
+	if len(segments) < 2 || segments[0] != 1 {
+		t.Fatalf("expected several segments from lsn 1, got %v", segments)
+	}
+
+	logStore = NewLogStore(path, 256, "")
+	defer logStore.Close()
+	if logStore.GetLastLsn() != 100 {
+		t.Fatalf("expected last lsn 100, got %d", logStore.GetLastLsn())
+	}
+	if lsn := logStore.AppendLog(newTestRowLog(1, 101)); lsn != 101 {
+		t.Fatalf("expected lsn 101, got %d", lsn)
+	}
+	assertLsns(t, readLsns(logStore), 101)
+	//从中间的段开始读取
+	var lsns []uint64
+	logStore.ReadLogs(segments[1]+1, func(log *TrxLog) {
+		lsns = append(lsns, log.GetLsn())
+	})
+	if len(lsns) != int(101-segments[1]) || lsns[0] != segments[1]+1 {
+		t.Fatalf("expected logs from lsn %d, got %v", segments[1]+1, lsns)
+	}
+}
+
+// 末尾不完整或者校验和不一致的记录在打开时被截断, 之后的记录重新使用它的LSN
+func TestLogTornTail(t *testing.T) {
+	path := t.TempDir()
+	logStore := NewLogStore(path, 0, "")
+	for id := 1; id <= 3; id++ {
+		logStore.AppendLog(newTestRowLog(1, id))
+	}
+	logStore.Close()
+	segmentPath := getSegmentPath(path, 1)
+	data, err := os.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(newTestRowLog(1, 3).encode())
+
+	//最后一条记录只写入了一部分
+	if err = os.WriteFile(segmentPath, data[:len(data)-size/2], os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	logStore = NewLogStore(path, 0, "")
+	assertLsns(t, readLsns(logStore), 2)
+	if info, _ := os.Stat(segmentPath); info.Size() != int64(len(data)-size) {
+		t.Fatalf("expected the torn record to be truncated, got size %d", info.Size())
+	}
+	if lsn := logStore.AppendLog(newTestRowLog(1, 3)); lsn != 3 {
+		t.Fatalf("expected lsn 3, got %d", lsn)
+	}
+	logStore.Close()
+
+	//最后一条记录的内容损坏, 校验和不一致
+	data, _ = os.ReadFile(segmentPath)
+	data[len(data)-1] ^= 0xff
+	if err = os.WriteFile(segmentPath, data, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	logStore = NewLogStore(path, 0, "")
+	defer logStore.Close()
+	assertLsns(t, readLsns(logStore), 2)
+	if segments := listSegments(path); len(segments) != 1 {
+		t.Fatalf("expected one segment, got %v", segments)
+	}
+}
@@ -0,0 +1,61 @@
+package transaction
+
+import (
+	"Relatdb/meta"
+	"slices"
+)
+
+type RowVersion struct {
+	TrxId   uint
+	RollPtr uint64
+	Deleted bool
+}
+
+// 读取行的隐藏列, 没有隐藏列的行视为所有事务可见
+func GetRowVersion(values []meta.Value, fieldCount int) *RowVersion {
+	if len(values) < fieldCount+meta.HIDDEN_COLUMN_COUNT {
+		return &RowVersion{}
+	}
+	hidden := values[fieldCount:]
+	return &RowVersion{
+		TrxId:   uint(hidden[meta.ROW_TRX_ID].ToInt64()),
+		RollPtr: uint64(hidden[meta.ROW_ROLL_PTR].ToInt64()),
+		Deleted: hidden[meta.ROW_DELETE_MARK].ToInt() != 0,
+	}
+}
+
+// 在字段值之后追加隐藏列
+func NewRowValues(values []meta.Value, fieldCount int, version *RowVersion) []meta.Value {
+	deleteMark := 0
+	if version.Deleted {
+		deleteMark = 1
+	}
+	return append(slices.Clip(values[:fieldCount]),
+		meta.Int64Value(version.TrxId), meta.Int64Value(version.RollPtr), meta.IntValue(deleteMark))
+}
+
+/*
+读视图: 创建时活跃的事务和之后开始的事务的修改不可见
+upLimitId之前的事务都已经结束, lowLimitId为创建时的下一个事务ID
+*/
+type ReadView struct {
+	creatorTrxId uint
+	upLimitId    uint
+	lowLimitId   uint
+	activeTrxIds map[uint]bool
+}
+
+func (self *ReadView) IsVisible(trxId uint) bool {
+	if trxId == self.creatorTrxId || trxId < self.upLimitId {
+		return true
+	}
+	if trxId >= self.lowLimitId {
+		return false
+	}
+	return !self.activeTrxIds[trxId]
+}
+
+// trxId和之前开始的事务在创建读视图时都已经结束
+func (self *ReadView) IsEndedBefore(trxId uint) bool {
+	return trxId < self.upLimitId
+}
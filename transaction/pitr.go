@@ -0,0 +1,96 @@
+package transaction
+
+import (
+	"Relatdb/utils"
+	"os"
+	"time"
+)
+
+// 时间点恢复的目标, 两个条件都设置时先到达的生效
+type RecoveryTarget struct {
+	Lsn  uint64    //恢复到这条日志为止, 为0时不限制
+	Time time.Time //恢复这个时间之前提交的事务和表定义的修改, 为零值时不限制
+}
+
+// 日志是否已经超过恢复目标
+func (self *RecoveryTarget) isReached(log *TrxLog) bool {
+	if self.Lsn > 0 && log.lsn > self.Lsn {
+		return true
+	}
+	logTime, ok := log.getTime()
+	return ok && !self.Time.IsZero() && logTime.After(self.Time)
+}
+
+/*
+时间点恢复之前准备日志: 日志目录来自基础备份, 停止服务时的日志段需要已经复制到归档目录
+1. 读取基础备份的检查点, 之后的检查点基于更新的数据文件, 不能使用
+2. 从归档目录复制基础备份之后的段, 归档的段比基础备份中的同名段更完整
+3. 截断恢复目标之后的日志, 日志不连续时截断到缺失的段之前
+4. 在末尾写入基础备份的检查点, 之后按崩溃恢复重做到末尾, 并撤销没有提交的事务
+恢复之后的日志与归档目录中目标之后的段不再连续, 之后应当使用新的归档目录
+*/
+func RestoreLogs(path string, segmentSize int64, archivePath string, target *RecoveryTarget) {
+	logStore := NewLogStore(path, segmentSize, "")
+	redoLsn := logStore.GetCheckpointLsn()
+	firstLsn := logStore.segments[0]
+	logStore.Close()
+	for _, startLsn := range listSegments(archivePath) {
+		if startLsn < firstLsn {
+			continue
+		}
+		if err := utils.CopyFile(getSegmentPath(archivePath, startLsn), getSegmentPath(path, startLsn)); err != nil {
+			panic(err)
+		}
+	}
+
+	logStore = NewLogStore(path, segmentSize, "")
+	var lastLsn uint64
+	reached := false
+	logStore.ReadLogs(1, func(log *TrxLog) {
+		if reached || (lastLsn > 0 && log.lsn != lastLsn+1) || target.isReached(log) {
+			reached = true
+			return
+		}
+		lastLsn = log.lsn
+	})
+	logStore.Close()
+	truncateLogs(path, lastLsn)
+	writeCheckpoint(path, segmentSize, redoLsn)
+}
+
+// 在日志末尾写入检查点, 从对应的数据文件启动时从redoLsn开始重做
+func writeCheckpoint(path string, segmentSize int64, redoLsn uint64) {
+	logStore := NewLogStore(path, segmentSize, "")
+	defer logStore.Close()
+	logStore.AppendLog(NewCheckpointLog(redoLsn, logStore.nextTrxId))
+}
+
+// 删除lastLsn之后的日志
+func truncateLogs(path string, lastLsn uint64) {
+	for _, startLsn := range listSegments(path) {
+		segmentPath := getSegmentPath(path, startLsn)
+		if startLsn > lastLsn {
+			if err := os.Remove(segmentPath); err != nil {
+				panic(err)
+			}
+			continue
+		}
+		data, err := os.ReadFile(segmentPath)
+		if err != nil {
+			panic(err)
+		}
+		offset := 0
+		for {
+			log, size := decodeTrxLog(data[offset:])
+			if log == nil || log.lsn > lastLsn {
+				break
+			}
+			offset += size
+		}
+		if offset < len(data) {
+			if err = os.Truncate(segmentPath, int64(offset)); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
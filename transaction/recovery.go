@@ -0,0 +1,64 @@
+package transaction
+
+import "slices"
+
+// 恢复时按顺序应用行日志和表定义日志
+type LogApplier interface {
+	RowApplier
+	TableApplier
+}
+
+/*
+崩溃恢复:
+1. 从最后一个检查点的重做LSN开始按顺序重新应用全部行日志和表定义日志, 包括未完成的事务和回滚时写入的补偿日志
+2. 按相反的顺序撤销没有提交或回滚记录的事务, 并写入回滚记录
+3. 已经准备的XA事务不撤销, 返回后由协调者提交或回滚
+行日志按前后镜像覆盖写入, 数据文件中已经包含的修改重复应用不影响结果
+*/
+func Recover(logStore *LogStore, applier LogApplier) []*Trx {
+	trxMap := make(map[uint]*Trx)
+	logStore.ReadLogs(logStore.GetCheckpointLsn(), func(log *TrxLog) {
+		switch log.logType {
+		case TRX_START:
+			trxMap[log.trxId] = NewTrx(log.trxId, logStore)
+		case COMMIT, ROLL_BACK:
+			delete(trxMap, log.trxId)
+		case PREPARE:
+			if trx := trxMap[log.trxId]; trx != nil {
+				trx.xid = log.getXid()
+				trx.state = TRX_STATE_PREPARED
+				trx.xaState = XA_PREPARED
+			}
+		case CREATE_TABLE:
+			applier.ApplyCreateTable(log.databaseName, log.tableName, log.GetTableMeta())
+		case DROP_TABLE:
+			applier.ApplyDropTable(log.databaseName, log.tableName)
+		case ALTER_TABLE:
+			applier.ApplyAlterTable(log.databaseName, log.tableName, log.GetTableMeta())
+		case ROW:
+			applier.ApplyRow(log.databaseName, log.tableName, log.before, log.after)
+			if trx := trxMap[log.trxId]; trx != nil {
+				trx.logs = append(trx.logs, log)
+			}
+		}
+	})
+	//后开始的事务先撤销
+	trxIds := make([]uint, 0, len(trxMap))
+	for trxId := range trxMap {
+		trxIds = append(trxIds, trxId)
+	}
+	slices.Sort(trxIds)
+	var preparedTrxs []*Trx
+	for i := len(trxIds) - 1; i >= 0; i-- {
+		trx := trxMap[trxIds[i]]
+		if trx.state == TRX_STATE_PREPARED {
+			logStore.startXa(trx, *trx.xid)
+			preparedTrxs = append(preparedTrxs, trx)
+			continue
+		}
+		trx.Undo(applier)
+		logStore.AppendLog(NewTrxRollbackLog(trx.trxId))
+	}
+	slices.Reverse(preparedTrxs)
+	return preparedTrxs
+}
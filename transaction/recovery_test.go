@@ -0,0 +1,93 @@
+package transaction
+
+import (
+	"Relatdb/meta"
+	"slices"
+	"testing"
+)
+
+// 记录恢复时应用的日志
+type recordingApplier struct {
+	applied []string
+}
+
+func entryToString(entry meta.IndexEntry) string {
+	if entry == nil {
+		return "-"
+	}
+	return entry.GetValues()[0].ToString()
+}
+
+func (self *recordingApplier) ApplyRow(databaseName string, tableName string, before meta.IndexEntry, after meta.IndexEntry) {
+	self.applied = append(self.applied, tableName+":"+entryToString(before)+">"+entryToString(after))
+}
+
+func (self *recordingApplier) ApplyCreateTable(databaseName string, tableName string, tableMeta []byte) {
+	self.applied = append(self.applied, "create:"+tableName)
+}
+
+func (self *recordingApplier) ApplyAlterTable(databaseName string, tableName string, tableMeta []byte) {
+	self.applied = append(self.applied, "alter:"+tableName)
+}
+
+func (self *recordingApplier) ApplyDropTable(databaseName string, tableName string) {
+	self.applied = append(self.applied, "drop:"+tableName)
+}
+
+func newTestClusterEntry(id int) meta.IndexEntry {
+	return meta.NewClusterIndexEntry([]meta.Value{meta.IntValue(id)}, nil)
+}
+
+/*
+重做全部的行日志, 按相反的顺序撤销没有完成的事务并写入回滚记录
+已经准备的XA事务保留到协调者提交或回滚
+*/
+func TestRecover(t *testing.T) {
+	path := t.TempDir()
+	logStore := NewLogStore(path, 0, "")
+	logStore.AppendLog(NewCreateTableLog("default", "t", nil))
+	committed := logStore.BeginTrx(REPEATABLE_READ)
+	committed.AddLog("default", "t", INSERT, nil, newTestClusterEntry(1))
+	committed.Commit()
+	unfinished := logStore.BeginTrx(REPEATABLE_READ)
+	unfinished.AddLog("default", "t", INSERT, nil, newTestClusterEntry(2))
+	unfinished.AddLog("default", "t", UPDATE, newTestClusterEntry(2), newTestClusterEntry(3))
+	prepared := logStore.BeginTrx(REPEATABLE_READ)
+	xid := Xid{FormatId: 1, Gtrid: "g1", Bqual: "b1"}
+	prepared.StartXa(xid)
+	prepared.AddLog("default", "t", INSERT, nil, newTestClusterEntry(4))
+	prepared.EndXa()
+	prepared.Prepare()
+	logStore.AppendLog(NewDropTableLog("default", "u"))
+	logStore.Close()
+
+	logStore = NewLogStore(path, 0, "")
+	applier := &recordingApplier{}
+	preparedTrxs := Recover(logStore, applier)
+	expected := []string{"create:t", "t:->1", "t:->2", "t:2>3", "t:->4", "drop:u", "t:3>2", "t:2>-"}
+	if !slices.Equal(applier.applied, expected) {
+		t.Fatalf("expected %v, got %v", expected, applier.applied)
+	}
+	if len(preparedTrxs) != 1 || *preparedTrxs[0].GetXid() != xid || len(preparedTrxs[0].GetLogs()) != 1 {
+		t.Fatalf("expected the prepared trx %v, got %v", xid, preparedTrxs)
+	}
+	if !slices.Equal(logStore.GetPreparedXids(), []Xid{xid}) {
+		t.Fatalf("expected prepared xids %v, got %v", []Xid{xid}, logStore.GetPreparedXids())
+	}
+	logStore.Close()
+
+	//回滚记录写入后再次恢复不会重复撤销
+	logStore = NewLogStore(path, 0, "")
+	defer logStore.Close()
+	applier = &recordingApplier{}
+	preparedTrxs = Recover(logStore, applier)
+	if !slices.Equal(applier.applied, expected[:len(expected)-2]) {
+		t.Fatalf("expected %v, got %v", expected[:len(expected)-2], applier.applied)
+	}
+	if len(preparedTrxs) != 1 || preparedTrxs[0].GetTrxId() != prepared.GetTrxId() {
+		t.Fatalf("expected the prepared trx %d, got %v", prepared.GetTrxId(), preparedTrxs)
+	}
+	if logStore.GetNextTrxId() <= prepared.GetTrxId() {
+		t.Fatalf("expected trx ids after %d, got %d", prepared.GetTrxId(), logStore.GetNextTrxId())
+	}
+}
@@ -2,6 +2,9 @@ package transaction
 
 import (
 	"Relatdb/meta"
+	"slices"
+	"strings"
+	"time"
 )
 
 type TrxState int
@@ -19,13 +22,111 @@ const (
 )
 
 type Trx struct {
-	trxId    uint
-	state    TrxState
-	logs     []*TrxLog
-	logStore *LogStore
+	trxId           uint
+	state           TrxState
+	isolationLevel  IsolationLevel
+	logs            []*TrxLog
+	logStore        *LogStore
+	readView        *ReadView     //一致性读的读视图, 第一次读取时创建
+	lockWaitTimeout time.Duration //等待行锁的超时时间
+	savepoints      []*savepoint  //按设置顺序排列的命名保存点
+	xid             *Xid          //XA事务的标识, 普通事务为nil
+	xaState         XaState
 }
 
+// 命名的保存点, 记录设置时的日志位置
+type savepoint struct {
+	name     string
+	position int
+}
+
+// 按前后镜像修改行: 删除before对应的行, 再写入after, 已经是目标状态时不改变
+type RowApplier interface {
+	ApplyRow(databaseName string, tableName string, before meta.IndexEntry, after meta.IndexEntry)
+}
+
+// 恢复时与行日志按顺序重新创建, 修改和删除表, 同名的表已经存在时先删除
+type TableApplier interface {
+	ApplyCreateTable(databaseName string, tableName string, tableMeta []byte)
+	ApplyAlterTable(databaseName string, tableName string, tableMeta []byte)
+	ApplyDropTable(databaseName string, tableName string)
+}
+
+func NewTrx(trxId uint, logStore *LogStore) *Trx {
+	return &Trx{
+		trxId:           trxId,
+		state:           TRX_STATE_NOT_STARTED,
+		isolationLevel:  DEFAULT_ISOLATION_LEVEL,
+		logStore:        logStore,
+		lockWaitTimeout: DEFAULT_LOCK_WAIT_TIMEOUT,
+	}
+}
+
+func (self *Trx) GetTrxId() uint {
+	return self.trxId
+}
+
+func (self *Trx) GetIsolationLevel() IsolationLevel {
+	return self.isolationLevel
+}
+
+func (self *Trx) GetXid() *Xid {
+	return self.xid
+}
+
+func (self *Trx) GetXaState() XaState {
+	return self.xaState
+}
+
+// 作为XA事务开始, xid已经被其他事务使用时返回false
+func (self *Trx) StartXa(xid Xid) bool {
+	if !self.logStore.startXa(self, xid) {
+		return false
+	}
+	self.xid = &xid
+	self.xaState = XA_ACTIVE
+	return true
+}
+
+// XA END: 之后不能再执行语句
+func (self *Trx) EndXa() {
+	self.xaState = XA_IDLE
+}
+
+// XA PREPARE: 写入准备记录, 之后事务只能提交或回滚, 重启后仍然保持准备状态和持有的行锁
+func (self *Trx) Prepare() {
+	self.logStore.prepareTrx(self)
+	self.state = TRX_STATE_PREPARED
+	self.xaState = XA_PREPARED
+}
+
+// 事务的行日志, 用于恢复已经准备的事务
+func (self *Trx) GetLogs() []*TrxLog {
+	return self.logs
+}
+
+func (self *Trx) SetLockWaitTimeout(timeout time.Duration) {
+	self.lockWaitTimeout = timeout
+}
+
+// 可重复读和串行化使用next-key锁防止幻读, 读已提交和读未提交只锁定记录
+func (self *Trx) IsGapLocking() bool {
+	return self.isolationLevel >= REPEATABLE_READ
+}
+
+// 不等待地加锁, 与其他事务的锁冲突时返回false
+func (self *Trx) TryLock(request *LockRequest) bool {
+	return self.logStore.lockManager.TryLock(self.trxId, request)
+}
+
+// 加锁, 冲突时等待, 死锁或者等待超时时返回错误
+func (self *Trx) Lock(request *LockRequest) error {
+	return self.logStore.lockManager.Lock(self.trxId, request, self.lockWaitTimeout)
+}
+
+// 写入预写日志后加入事务的日志列表
 func (self *Trx) AddLogByTrxLog(log *TrxLog) {
+	self.logStore.AppendLog(log)
 	self.logs = append(self.logs, log)
 }
 
@@ -38,31 +139,121 @@ func checkIndexEntry(indexEntry meta.IndexEntry) {
 	}
 }
 
-func (self *Trx) AddLog(tableName string, opType OpType, before meta.IndexEntry, after meta.IndexEntry) {
+func (self *Trx) AddLog(databaseName string, tableName string, opType OpType, before meta.IndexEntry, after meta.IndexEntry) *TrxLog {
 	checkIndexEntry(before)
 	checkIndexEntry(after)
-	log := NewRowLog(self.trxId, tableName, opType, before, after)
+	log := NewRowLog(self.trxId, databaseName, tableName, opType, before, after)
 	self.AddLogByTrxLog(log)
+	return log
 }
 
-func (self *Trx) Redo() {
+// 按顺序重新应用事务的行日志
+func (self *Trx) Redo(applier RowApplier) {
+	for _, log := range self.logs {
+		applier.ApplyRow(log.databaseName, log.tableName, log.before, log.after)
+	}
+}
 
+// 按相反的顺序撤销事务的行日志
+func (self *Trx) Undo(applier RowApplier) {
+	for i := len(self.logs) - 1; i >= 0; i-- {
+		log := self.logs[i]
+		applier.ApplyRow(log.databaseName, log.tableName, log.after, log.before)
+	}
 }
 
-func (self *Trx) Undo() {
+/*
+事务的读视图, 读未提交时为nil, 读取最新的版本
+可重复读和串行化在事务中使用同一个读视图, 事务结束时释放
+*/
+func (self *Trx) GetReadView() *ReadView {
+	if self.isolationLevel == READ_UNCOMMITTED {
+		return nil
+	}
+	if self.readView == nil {
+		self.readView = self.logStore.CreateReadView(self.trxId)
+	}
+	return self.readView
+}
 
+// 语句结束, 读已提交释放语句的读视图, 下一条语句重新创建
+func (self *Trx) EndStatement() {
+	if self.isolationLevel == READ_COMMITTED {
+		self.closeReadView()
+	}
 }
 
-func (self *Trx) Begin() {
-	log := NewTrxStartLog(self.trxId)
-	self.logStore.AppendLog(log)
-	self.state = TRX_STATE_ACTIVE
+func (self *Trx) closeReadView() {
+	if self.readView != nil {
+		self.logStore.CloseReadView(self.readView)
+		self.readView = nil
+	}
 }
 
-func (self *Trx) Rollback() {
+// 当前的日志位置, 回滚到该位置时撤销之后的修改
+func (self *Trx) GetSavepoint() int {
+	return len(self.logs)
+}
 
+// 撤销savepoint之后的行日志并写入补偿日志
+func (self *Trx) RollbackToSavepoint(savepoint int, applier RowApplier) {
+	for i := len(self.logs) - 1; i >= savepoint; i-- {
+		log := self.logs[i]
+		applier.ApplyRow(log.databaseName, log.tableName, log.after, log.before)
+		self.logStore.AppendLog(log.newCompensationLog())
+	}
+	self.logs = self.logs[:savepoint]
 }
 
-func (self *Trx) Commit() {
+// 设置命名的保存点, 同名的保存点被替换, 保存点名称不区分大小写
+func (self *Trx) SetSavepoint(name string) {
+	self.savepoints = slices.DeleteFunc(self.savepoints, func(savepoint *savepoint) bool {
+		return strings.EqualFold(savepoint.name, name)
+	})
+	self.savepoints = append(self.savepoints, &savepoint{name: name, position: len(self.logs)})
+}
+
+func (self *Trx) findSavepoint(name string) int {
+	return slices.IndexFunc(self.savepoints, func(savepoint *savepoint) bool {
+		return strings.EqualFold(savepoint.name, name)
+	})
+}
+
+// 回滚到命名的保存点, 之后设置的保存点被删除, 保存点不存在时返回false
+func (self *Trx) RollbackToNamedSavepoint(name string, applier RowApplier) bool {
+	index := self.findSavepoint(name)
+	if index < 0 {
+		return false
+	}
+	self.RollbackToSavepoint(self.savepoints[index].position, applier)
+	self.savepoints = self.savepoints[:index+1]
+	return true
+}
+
+// 删除命名的保存点和之后设置的保存点, 不撤销修改, 保存点不存在时返回false
+func (self *Trx) ReleaseSavepoint(name string) bool {
+	index := self.findSavepoint(name)
+	if index < 0 {
+		return false
+	}
+	self.savepoints = self.savepoints[:index]
+	return true
+}
 
+// 撤销事务的全部修改, 最后写入回滚记录
+func (self *Trx) Rollback(applier RowApplier) {
+	self.RollbackToSavepoint(0, applier)
+	self.logStore.AppendLog(NewTrxRollbackLog(self.trxId))
+	self.logStore.removeXaTrx(self)
+	self.state = TRX_STATE_COMPLETED
+	self.closeReadView()
+	self.logStore.lockManager.ReleaseLocks(self.trxId)
+}
+
+// 写入提交记录, 提交记录同步到磁盘后事务完成并释放行锁
+func (self *Trx) Commit() {
+	self.logStore.commitTrx(self)
+	self.state = TRX_STATE_COMPLETED
+	self.closeReadView()
+	self.logStore.lockManager.ReleaseLocks(self.trxId)
 }
@@ -0,0 +1,83 @@
+package transaction
+
+import (
+	"Relatdb/meta"
+	"sync"
+)
+
+/*
+撤销记录: 行日志的前镜像就是行的上一个版本, 按回滚指针保存在内存中
+读视图不可见的版本沿回滚指针找到可见的版本
+重启后没有读视图需要旧版本, 撤销记录不需要持久化
+*/
+type UndoStore struct {
+	mutex       sync.Mutex
+	nextRollPtr uint64
+	logs        map[uint64]*TrxLog
+	trxRollPtrs map[uint][]uint64 //各事务的撤销记录
+}
+
+func NewUndoStore() *UndoStore {
+	return &UndoStore{
+		nextRollPtr: 1,
+		logs:        make(map[uint64]*TrxLog),
+		trxRollPtrs: make(map[uint][]uint64),
+	}
+}
+
+// 分配回滚指针, 写入新版本之前分配, 写入成功后保存撤销记录
+func (self *UndoStore) AllocateRollPtr() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	rollPtr := self.nextRollPtr
+	self.nextRollPtr++
+	return rollPtr
+}
+
+func (self *UndoStore) AddUndoLog(rollPtr uint64, log *TrxLog) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	//恢复的撤销记录使用重启之前分配的回滚指针
+	self.nextRollPtr = max(self.nextRollPtr, rollPtr+1)
+	self.logs[rollPtr] = log
+	self.trxRollPtrs[log.trxId] = append(self.trxRollPtrs[log.trxId], rollPtr)
+}
+
+// 清除purgeLimit之前的事务的撤销记录, 这些事务的修改对所有读视图可见
+func (self *UndoStore) Purge(purgeLimit uint) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for trxId, rollPtrs := range self.trxRollPtrs {
+		if trxId >= purgeLimit {
+			continue
+		}
+		for _, rollPtr := range rollPtrs {
+			delete(self.logs, rollPtr)
+		}
+		delete(self.trxRollPtrs, trxId)
+	}
+}
+
+/*
+返回读视图可见的版本的字段值, 不存在可见的版本或可见的版本已删除时返回nil
+view为nil时读取最新的版本
+*/
+func (self *UndoStore) GetVisibleValues(view *ReadView, values []meta.Value, fieldCount int) []meta.Value {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for values != nil {
+		version := GetRowVersion(values, fieldCount)
+		if view == nil || view.IsVisible(version.TrxId) {
+			if version.Deleted {
+				return nil
+			}
+			return values[:fieldCount:fieldCount]
+		}
+		log := self.logs[version.RollPtr]
+		if log == nil || log.before == nil {
+			return nil
+		}
+		values = log.before.GetValues()
+	}
+	return nil
+}
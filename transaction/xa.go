@@ -0,0 +1,54 @@
+package transaction
+
+import (
+	"Relatdb/meta"
+	"fmt"
+)
+
+// XA事务的标识, 由外部的协调者分配
+type Xid struct {
+	FormatId int64
+	Gtrid    string
+	Bqual    string
+}
+
+func (self Xid) String() string {
+	return fmt.Sprintf("'%s','%s',%d", self.Gtrid, self.Bqual, self.FormatId)
+}
+
+type XaState int
+
+const (
+	_ XaState = iota
+	//XA START之后, 可以执行语句
+	XA_ACTIVE
+	//XA END之后, 等待PREPARE或者一阶段提交
+	XA_IDLE
+	//PREPARE之后与会话分离, 重启后仍然保留, 由协调者提交或回滚
+	XA_PREPARED
+)
+
+var xaStateNames = map[XaState]string{
+	XA_ACTIVE:   "ACTIVE",
+	XA_IDLE:     "IDLE",
+	XA_PREPARED: "PREPARED",
+}
+
+func (self XaState) String() string {
+	return xaStateNames[self]
+}
+
+// 准备记录的后镜像保存xid, 恢复时找到已经准备的事务
+func NewTrxPrepareLog(trxId uint, xid *Xid) *TrxLog {
+	values := []meta.Value{meta.Int64Value(xid.FormatId), meta.StringValue(xid.Gtrid), meta.StringValue(xid.Bqual)}
+	return NewTrxLog(trxId, PREPARE, "", "", 0, nil, meta.NewIndexEntry(values, nil))
+}
+
+func (self *TrxLog) getXid() *Xid {
+	values := self.after.GetValues()
+	return &Xid{
+		FormatId: values[0].ToInt64(),
+		Gtrid:    values[1].ToString(),
+		Bqual:    values[2].ToString(),
+	}
+}
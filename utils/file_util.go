@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"os"
 	"strings"
 )
@@ -8,3 +9,32 @@ import (
 func ConcatFilePaths(paths ...string) string {
 	return strings.Join(paths, string(os.PathSeparator))
 }
+
+// 复制文件并同步到磁盘
+func CopyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(to, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	if _, err = io.Copy(target, source); err != nil {
+		return err
+	}
+	return target.Sync()
+}
+
+// 移动文件, 不能重命名时(例如跨文件系统)复制后删除
+func MoveFile(from string, to string) error {
+	if os.Rename(from, to) == nil {
+		return nil
+	}
+	if err := CopyFile(from, to); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}